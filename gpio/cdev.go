@@ -0,0 +1,147 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/youngkin/gpio/gpiocdev"
+)
+
+// errCdevUnsupported is returned by the cdev backend's PWMPin and SPI methods
+var errCdevUnsupported = errors.New("the GPIO character device doesn't support hardware PWM or SPI, use the rpio backend")
+
+// cdevBoard is a Board implemented with the GPIO character device
+type cdevBoard struct {
+	chip *gpiocdev.Chip
+
+	mu   sync.Mutex
+	pins []*cdevPin
+}
+
+// OpenCdev opens the board using GPIO character device 'chip', e.g., 'gpiochip0'
+func OpenCdev(chip string) (Board, error) {
+	c, err := gpiocdev.OpenChip(chip)
+	if err != nil {
+		return nil, err
+	}
+	return &cdevBoard{chip: c}, nil
+}
+
+func (b *cdevBoard) Pin(bcm int) (Pin, error) {
+	if err := checkPin(bcm); err != nil {
+		return nil, err
+	}
+	// The line is requested when the pin is first used, check now whether
+	// another program has it so the error isn't deferred until Close.
+	info, err := b.chip.LineInfo(bcm)
+	if err != nil {
+		return nil, err
+	}
+	if info.Used {
+		return nil, fmt.Errorf("BCM pin %d is being used by %q", bcm, info.Consumer)
+	}
+	p := &cdevPin{bcm: bcm, pin: b.chip.Pin(bcm, filepath.Base(os.Args[0]))}
+	b.mu.Lock()
+	b.pins = append(b.pins, p)
+	b.mu.Unlock()
+	return p, nil
+}
+
+func (b *cdevBoard) PWMPin(bcm int) (PWMPin, error) {
+	return nil, errCdevUnsupported
+}
+
+func (b *cdevBoard) SPI() (SPI, error) {
+	return nil, errCdevUnsupported
+}
+
+// Close releases the lines and returns the first error any of the pins encountered
+func (b *cdevBoard) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	for _, p := range b.pins {
+		if err == nil {
+			err = p.pin.Err()
+		}
+		if err == nil {
+			err = p.err
+		}
+	}
+	if cerr := b.chip.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// cdevPin adapts gpiocdev.Pin to Pin
+type cdevPin struct {
+	bcm int
+	pin *gpiocdev.Pin
+	err error // the first unsupported mode requested
+}
+
+func (p *cdevPin) BCM() int {
+	return p.bcm
+}
+
+func (p *cdevPin) Mode(m Mode) {
+	switch m {
+	case Input:
+		p.pin.Input()
+	case Output:
+		p.pin.Output()
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("BCM pin %d: %s mode isn't supported by the GPIO character device", p.bcm, m)
+		}
+	}
+}
+
+func (p *cdevPin) Output() {
+	p.pin.Output()
+}
+
+func (p *cdevPin) Input() {
+	p.pin.Input()
+}
+
+func (p *cdevPin) High() {
+	p.pin.High()
+}
+
+func (p *cdevPin) Low() {
+	p.pin.Low()
+}
+
+func (p *cdevPin) Write(s State) {
+	if s == Low {
+		p.pin.Low()
+	} else {
+		p.pin.High()
+	}
+}
+
+func (p *cdevPin) Read() State {
+	return State(p.pin.Read())
+}
+
+func (p *cdevPin) Pull(pull Pull) {
+	switch pull {
+	case PullOff:
+		p.pin.PullOff()
+	case PullDown:
+		p.pin.PullDown()
+	case PullUp:
+		p.pin.PullUp()
+	}
+}
@@ -0,0 +1,364 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Function is what a claimed pin is used for
+type Function uint8
+
+// Functions
+const (
+	FuncGPIO Function = iota // a digital input or output
+	FuncPWM                  // a hardware PWM output
+	FuncSPI                  // SPI0, see the SPI0 pins
+	FuncI2C                  // I2C1, see the I2C1 pins
+)
+
+func (f Function) String() string {
+	switch f {
+	case FuncGPIO:
+		return "GPIO"
+	case FuncPWM:
+		return "PWM"
+	case FuncSPI:
+		return "SPI"
+	case FuncI2C:
+		return "I2C"
+	default:
+		return fmt.Sprintf("Function(%d)", f)
+	}
+}
+
+// parseFunction is the inverse of Function.String
+func parseFunction(s string) (Function, bool) {
+	for f := FuncGPIO; f <= FuncI2C; f++ {
+		if f.String() == s {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// ErrClaimed is returned, wrapped, when a pin can't be claimed because of another
+// claim
+var ErrClaimed = errors.New("pin conflict")
+
+// Claim is a claim on a pin
+type Claim struct {
+	BCM      int
+	Function Function
+	Purpose  string // what the pin is used for, e.g., 'bar graph segment 1'
+	Program  string // the program that claimed the pin
+	PID      int    // the process that claimed the pin
+}
+
+func (c Claim) String() string {
+	return fmt.Sprintf("%s (pid %d) for %s, %s", c.Program, c.PID, c.Function, c.Purpose)
+}
+
+// conflict returns an error if claim 'c' can't be made because of 'other'
+func (c Claim) conflict(other Claim) error {
+	if c.BCM == other.BCM {
+		switch {
+		case c == other:
+			// Claiming a pin again for the same thing is harmless
+			return nil
+		case c.Function == FuncI2C && other.Function == FuncI2C:
+			// The I2C bus is shared by its devices
+			return nil
+		case c.Function == FuncSPI && other.Function == FuncSPI && c.BCM != SPI0CE0 && c.BCM != SPI0CE1:
+			// So is the SPI bus, but each device has its own chip select
+			return nil
+		}
+		return fmt.Errorf("%w, BCM %d is claimed by %s", ErrClaimed, c.BCM, other)
+	}
+	if c.Function == FuncPWM && other.Function == FuncPWM {
+		ch, _ := PWMChannel(c.BCM)
+		if otherCh, ok := PWMChannel(other.BCM); ok && ch == otherCh {
+			return fmt.Errorf("%w, BCM %d shares PWM channel %d with BCM %d, claimed by %s", ErrClaimed, c.BCM, ch, other.BCM, other)
+		}
+	}
+	return nil
+}
+
+// checkFunction returns an error if pin 'bcm' can't be used for 'f'
+func checkFunction(bcm int, f Function) error {
+	if err := checkPin(bcm); err != nil {
+		return err
+	}
+	switch f {
+	case FuncGPIO:
+	case FuncPWM:
+		return checkPWMPin(bcm)
+	case FuncSPI:
+		for _, p := range spiPins {
+			if p == bcm {
+				return nil
+			}
+		}
+		return fmt.Errorf("BCM pin %d isn't an SPI0 pin, they're %v", bcm, spiPins)
+	case FuncI2C:
+		if bcm != I2C1SDA && bcm != I2C1SCL {
+			return fmt.Errorf("BCM pin %d isn't an I2C1 pin, they're %d (SDA) and %d (SCL)", bcm, I2C1SDA, I2C1SCL)
+		}
+	default:
+		return fmt.Errorf("invalid function %s", f)
+	}
+	return nil
+}
+
+// Registry records which pins are being used, and what for, so that conflicting
+// uses are caught before they cause trouble: a pin claimed by two drivers, a pin
+// used as a GPIO pin by one driver and by SPI or I2C for another, or two PWM pins
+// that share a PWM channel, 12 and 18 or 13 and 19, claimed for PWM. A pin can be
+// claimed more than once for the same thing, and the SPI and I2C bus pins can be
+// claimed by more than one device, but each SPI device needs its own chip select.
+//
+// A registry's claims are only seen by the program that made them, unless it's
+// opened with a claims file. Programs that share a claims file see each other's
+// claims, the file is locked while it's being changed. Claims are released when the
+// registry is closed, or when the program that made them exits.
+//
+// Anyone who can write to a claims file can add claims to it, so sharing one is
+// opt-in. Lines in the file that aren't claims are dropped, see Warnings, and the
+// file isn't opened if it's a symbolic link, so it can't be used to overwrite
+// another file.
+type Registry struct {
+	mu       sync.Mutex
+	path     string  // the claims file, if any
+	claims   []Claim // the claims if there's no file
+	program  string
+	pid      int
+	warnings []string
+}
+
+// ClaimsFile returns the claims file shared by the demos, $GPIO_CLAIMS, e.g.,
+// /run/lock/gpio-claims. It's "" if $GPIO_CLAIMS isn't set, the claims aren't
+// shared then.
+func ClaimsFile() string {
+	return os.Getenv("GPIO_CLAIMS")
+}
+
+// OpenRegistry opens a registry whose claims are shared with other programs using
+// claims file 'path', which is created if it doesn't exist. A 'path' of "" opens a
+// registry that's private to the program.
+func OpenRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:    path,
+		program: filepath.Base(os.Args[0]),
+		pid:     os.Getpid(),
+	}
+	if path != "" {
+		// Make sure the file can be used
+		if err := r.update(func(claims []Claim) ([]Claim, error) { return claims, nil }); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Warnings returns, and forgets, the warnings about lines in the claims file that
+// weren't claims. They're dropped from the file.
+func (r *Registry) Warnings() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	warnings := r.warnings
+	r.warnings = nil
+	return warnings
+}
+
+// Claim claims pin 'bcm' for 'f', 'purpose' describes what it's used for
+func (r *Registry) Claim(bcm int, f Function, purpose string) error {
+	return r.claim(r.newClaim(bcm, f, purpose))
+}
+
+// ClaimSPI claims SPI0's clock and data pins, and the chip select pin of 'cs', 0
+// (CE0) or 1 (CE1), for an SPI device
+func (r *Registry) ClaimSPI(cs int, purpose string) error {
+	ce := SPI0CE0
+	switch cs {
+	case 0:
+	case 1:
+		ce = SPI0CE1
+	default:
+		return fmt.Errorf("invalid SPI chip select %d, must be 0 or 1", cs)
+	}
+	return r.claim(
+		r.newClaim(SPI0SCLK, FuncSPI, purpose),
+		r.newClaim(SPI0MOSI, FuncSPI, purpose),
+		r.newClaim(SPI0MISO, FuncSPI, purpose),
+		r.newClaim(ce, FuncSPI, purpose))
+}
+
+// ClaimI2C claims I2C1's pins for an I2C device
+func (r *Registry) ClaimI2C(purpose string) error {
+	return r.claim(
+		r.newClaim(I2C1SDA, FuncI2C, purpose),
+		r.newClaim(I2C1SCL, FuncI2C, purpose))
+}
+
+func (r *Registry) newClaim(bcm int, f Function, purpose string) Claim {
+	return Claim{BCM: bcm, Function: f, Purpose: purpose, Program: r.program, PID: r.pid}
+}
+
+// claim makes all of 'claims' or, if any of them conflict with another claim or
+// each other, none of them
+func (r *Registry) claim(claims ...Claim) error {
+	for _, c := range claims {
+		if err := checkFunction(c.BCM, c.Function); err != nil {
+			return err
+		}
+		if strings.ContainsAny(c.Purpose, "\t\n") {
+			return fmt.Errorf("invalid purpose %q, it can't contain tabs or newlines", c.Purpose)
+		}
+	}
+	return r.update(func(existing []Claim) ([]Claim, error) {
+		for i, c := range claims {
+			for _, other := range existing {
+				if err := c.conflict(other); err != nil {
+					return nil, err
+				}
+			}
+			for _, other := range claims[:i] {
+				if err := c.conflict(other); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, c := range claims {
+			existing = addClaim(existing, c)
+		}
+		return existing, nil
+	})
+}
+
+// addClaim adds 'c' to 'claims' unless it's already there
+func addClaim(claims []Claim, c Claim) []Claim {
+	for _, other := range claims {
+		if other == c {
+			return claims
+		}
+	}
+	return append(claims, c)
+}
+
+// Release releases the program's claims on pin 'bcm'
+func (r *Registry) Release(bcm int) error {
+	return r.release(func(c Claim) bool { return c.BCM == bcm })
+}
+
+// Claims returns the current claims, including other programs' if there's a
+// claims file, ordered by pin
+func (r *Registry) Claims() ([]Claim, error) {
+	var claims []Claim
+	err := r.update(func(existing []Claim) ([]Claim, error) {
+		claims = append(claims, existing...)
+		return existing, nil
+	})
+	sort.SliceStable(claims, func(i, j int) bool { return claims[i].BCM < claims[j].BCM })
+	return claims, err
+}
+
+// Close releases all of the program's claims
+func (r *Registry) Close() error {
+	return r.release(func(c Claim) bool { return true })
+}
+
+// release releases the program's claims that 'match' returns true for
+func (r *Registry) release(match func(c Claim) bool) error {
+	return r.update(func(existing []Claim) ([]Claim, error) {
+		kept := existing[:0]
+		for _, c := range existing {
+			if c.PID != r.pid || !match(c) {
+				kept = append(kept, c)
+			}
+		}
+		return kept, nil
+	})
+}
+
+// update replaces the claims with those returned by 'fn', which is passed the
+// current claims. Nothing changes if 'fn' returns an error.
+func (r *Registry) update(fn func(claims []Claim) ([]Claim, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path != "" {
+		warnings, err := updateClaimsFile(r.path, fn)
+		r.warnings = append(r.warnings, warnings...)
+		return err
+	}
+	claims, err := fn(append([]Claim(nil), r.claims...))
+	if err != nil {
+		return err
+	}
+	r.claims = claims
+	return nil
+}
+
+// readClaims reads a claims file, a line for each claim with its pin, function,
+// process ID, program, and purpose separated by tabs. Lines that aren't claims are
+// skipped, with a warning.
+func readClaims(rd io.Reader) (claims []Claim, warnings []string, err error) {
+	scanner := bufio.NewScanner(rd)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		c, err := parseClaim(line)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("claims file line %d skipped, %s", lineNum, err))
+			continue
+		}
+		claims = append(claims, c)
+	}
+	return claims, warnings, scanner.Err()
+}
+
+// parseClaim parses a line of a claims file
+func parseClaim(line string) (Claim, error) {
+	fields := strings.SplitN(line, "\t", 5)
+	if len(fields) != 5 {
+		return Claim{}, fmt.Errorf("expected 5 tab separated fields, got %q", line)
+	}
+	bcm, err := strconv.Atoi(fields[0])
+	if err != nil || checkPin(bcm) != nil {
+		return Claim{}, fmt.Errorf("invalid pin %q", fields[0])
+	}
+	f, ok := parseFunction(fields[1])
+	if !ok {
+		return Claim{}, fmt.Errorf("invalid function %q", fields[1])
+	}
+	pid, err := strconv.Atoi(fields[2])
+	if err != nil || pid <= 0 {
+		return Claim{}, fmt.Errorf("invalid process ID %q", fields[2])
+	}
+	return Claim{BCM: bcm, Function: f, PID: pid, Program: fields[3], Purpose: fields[4]}, nil
+}
+
+// writeClaims writes 'claims' in the format read by readClaims
+func writeClaims(w io.Writer, claims []Claim) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range claims {
+		fmt.Fprintf(bw, "%d\t%s\t%d\t%s\t%s\n", c.BCM, c.Function, c.PID, c.Program, c.Purpose)
+	}
+	return bw.Flush()
+}
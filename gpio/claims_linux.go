@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// updateClaimsFile replaces the claims in file 'path' with those returned by 'fn',
+// which is passed the current claims, holding a lock on the file so that other
+// programs' updates aren't lost. Claims made by processes that have exited, and
+// lines that aren't claims, are dropped. It returns warnings about the lines that
+// aren't claims.
+func updateClaimsFile(path string, fn func(claims []Claim) ([]Claim, error)) ([]string, error) {
+	f, err := openClaimsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// The lock is released when the file is closed
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, fmt.Errorf("unable to lock claims file %s, %w", path, err)
+	}
+
+	claims, warnings, err := readClaims(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, w := range warnings {
+		warnings[i] = path + ": " + w
+	}
+	live := claims[:0]
+	for _, c := range claims {
+		if running(c.PID) {
+			live = append(live, c)
+		}
+	}
+	if claims, err = fn(live); err != nil {
+		return warnings, err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return warnings, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return warnings, err
+	}
+	if err := writeClaims(f, claims); err != nil {
+		return warnings, err
+	}
+	return warnings, f.Close()
+}
+
+// openClaimsFile opens claims file 'path', creating it if it doesn't exist. It can
+// be written by anyone, so programs run with and without sudo can share it. A
+// symbolic link isn't followed, and anything but a regular file is rejected, so
+// the file can't be made to point at another file or a device.
+func openClaimsFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOFOLLOW, 0)
+	if os.IsNotExist(err) {
+		f, err = createClaimsFile(path)
+	}
+	if errors.Is(err, syscall.ELOOP) {
+		return nil, fmt.Errorf("claims file %s is a symbolic link, it must be a regular file", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("claims file %s isn't a regular file", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// createClaimsFile creates claims file 'path', it's opened if another program
+// created it first
+func createClaimsFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0666)
+	if os.IsExist(err) {
+		return os.OpenFile(path, os.O_RDWR|syscall.O_NOFOLLOW, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The permissions given when it was created were reduced by the umask
+	if err := f.Chmod(0666); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// running returns true if process 'pid' exists
+func running(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means it exists but belongs to someone else
+	return err == nil || err == syscall.EPERM
+}
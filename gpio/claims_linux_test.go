@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRegistryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpio-claims")
+	a, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0666 {
+		t.Errorf("got claims file %v, %v, want mode 0666 so it can be shared with and without sudo", info.Mode(), err)
+	}
+
+	// A second registry, as if it were another program, sees the first's claims
+	b, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ClaimSPI(0, "LED matrix"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Claim(SPI0CE0, FuncGPIO, "bar graph segment 10"); !errors.Is(err, ErrClaimed) {
+		t.Errorf("got %v, want ErrClaimed", err)
+	}
+	if err := b.ClaimSPI(1, "ADC"); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if claims, _ := b.Claims(); len(claims) != 8 {
+		t.Errorf("got claims %v, want the LED matrix's 4 and the ADC's 4", claims)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Claim(SPI0CE0, FuncGPIO, "bar graph segment 10"); err != nil {
+		t.Errorf("CE0 is still claimed after the registry that claimed it was closed, %s", err)
+	}
+}
+
+func TestRegistryFileCleanup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gpio-claims")
+	// Claims by a process that's exited, pid 0x7fffffff isn't used, and lines that
+	// aren't claims are dropped
+	contents := fmt.Sprintf("17\tGPIO\t%d\tledbargraph\tbar graph segment 1\n"+
+		"not a claim\n"+
+		"27\tGPIO\t%d\tledbargraph\tbar graph segment 3\n", os.Getpid(), 0x7fffffff)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	warnings := r.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "line 2") {
+		t.Errorf("got warnings %q, want one about line 2", warnings)
+	}
+	if len(r.Warnings()) != 0 {
+		t.Error("the warnings were returned twice")
+	}
+	claims, _ := r.Claims()
+	if len(claims) != 1 || claims[0].BCM != 17 {
+		t.Errorf("got claims %v, want only the claim on BCM 17", claims)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "not a claim") || strings.Contains(string(data), "segment 3") {
+		t.Errorf("the claims file still has the dropped lines:\n%s", data)
+	}
+}
+
+func TestRegistryFileNotRegular(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("keep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	dangling := filepath.Join(dir, "dangling")
+	if err := os.Symlink(filepath.Join(dir, "missing"), dangling); err != nil {
+		t.Fatal(err)
+	}
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{link, dangling, fifo, dir} {
+		if _, err := OpenRegistry(path); err == nil {
+			t.Errorf("%s was opened as a claims file", path)
+		}
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != "keep\n" {
+		t.Errorf("the symbolic link's target was changed to %q", data)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Error("the dangling symbolic link's target was created")
+	}
+}
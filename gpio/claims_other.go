@@ -0,0 +1,17 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package gpio
+
+import "errors"
+
+// updateClaimsFile needs file locks and process IDs, it's only available on Linux
+func updateClaimsFile(path string, fn func(claims []Claim) ([]Claim, error)) ([]string, error) {
+	return nil, errors.New("claims files are only available on Linux")
+}
@@ -0,0 +1,285 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	// claim is a claim to make, with ClaimSPI if 'spi' is set, ClaimI2C if 'i2c'
+	// is set, otherwise with Claim
+	type claim struct {
+		bcm     int
+		f       Function
+		purpose string
+		spi     *int // the chip select
+		i2c     bool
+	}
+	cs := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		claims  []claim
+		wantErr bool // the last claim fails, the others succeed
+		want    []int
+	}{
+		{
+			name:   "different pins",
+			claims: []claim{{bcm: 17, purpose: "LED"}, {bcm: 27, purpose: "button"}},
+			want:   []int{17, 27},
+		},
+		{
+			name:   "same claim twice",
+			claims: []claim{{bcm: 17, purpose: "LED"}, {bcm: 17, purpose: "LED"}},
+			want:   []int{17},
+		},
+		{
+			name:    "same pin, different purpose",
+			claims:  []claim{{bcm: 17, purpose: "LED"}, {bcm: 17, purpose: "button"}},
+			wantErr: true,
+			want:    []int{17},
+		},
+		{
+			name:    "same pin, different function",
+			claims:  []claim{{bcm: 18, purpose: "LED"}, {bcm: 18, f: FuncPWM, purpose: "LED"}},
+			wantErr: true,
+			want:    []int{18},
+		},
+		{
+			name:    "PWM channel 0, 12 and 18",
+			claims:  []claim{{bcm: 12, f: FuncPWM, purpose: "LED"}, {bcm: 18, f: FuncPWM, purpose: "servo"}},
+			wantErr: true,
+			want:    []int{12},
+		},
+		{
+			name:    "PWM channel 0, 18 and 12",
+			claims:  []claim{{bcm: 18, f: FuncPWM, purpose: "LED"}, {bcm: 12, f: FuncPWM, purpose: "servo"}},
+			wantErr: true,
+			want:    []int{18},
+		},
+		{
+			name:    "PWM channel 1, 13 and 19",
+			claims:  []claim{{bcm: 13, f: FuncPWM, purpose: "LED"}, {bcm: 19, f: FuncPWM, purpose: "servo"}},
+			wantErr: true,
+			want:    []int{13},
+		},
+		{
+			name:   "PWM channels 0 and 1",
+			claims: []claim{{bcm: 18, f: FuncPWM, purpose: "LED"}, {bcm: 19, f: FuncPWM, purpose: "servo"}},
+			want:   []int{18, 19},
+		},
+		{
+			name:   "PWM channel pin used for GPIO",
+			claims: []claim{{bcm: 13, f: FuncPWM, purpose: "LED"}, {bcm: 19, purpose: "74HC595 SRCLR"}},
+			want:   []int{13, 19},
+		},
+		{
+			name:    "not a PWM pin",
+			claims:  []claim{{bcm: 17, f: FuncPWM, purpose: "LED"}},
+			wantErr: true,
+		},
+		{
+			name:   "SPI devices on each chip select share the bus",
+			claims: []claim{{spi: cs(0), purpose: "LED matrix"}, {spi: cs(1), purpose: "ADC"}},
+			want:   []int{7, 8, 9, 9, 10, 10, 11, 11},
+		},
+		{
+			name:    "SPI devices on the same chip select",
+			claims:  []claim{{spi: cs(0), purpose: "LED matrix"}, {spi: cs(0), purpose: "ADC"}},
+			wantErr: true,
+			want:    []int{8, 9, 10, 11},
+		},
+		{
+			name:    "SPI chip select used for GPIO",
+			claims:  []claim{{bcm: 8, purpose: "bar graph segment 10"}, {spi: cs(0), purpose: "LED matrix"}},
+			wantErr: true,
+			want:    []int{8},
+		},
+		{
+			name:    "SPI clock used for GPIO",
+			claims:  []claim{{spi: cs(1), purpose: "ADC"}, {bcm: 11, purpose: "LED"}},
+			wantErr: true,
+			want:    []int{7, 9, 10, 11},
+		},
+		{
+			name:    "invalid chip select",
+			claims:  []claim{{spi: cs(2), purpose: "ADC"}},
+			wantErr: true,
+		},
+		{
+			name:   "I2C devices share the bus",
+			claims: []claim{{i2c: true, purpose: "display"}, {i2c: true, purpose: "sensor"}},
+			want:   []int{2, 2, 3, 3},
+		},
+		{
+			name:    "I2C pin used for GPIO",
+			claims:  []claim{{bcm: 3, purpose: "bar graph segment 9"}, {i2c: true, purpose: "sensor"}},
+			wantErr: true,
+			want:    []int{3},
+		},
+		{
+			name:    "not an I2C pin",
+			claims:  []claim{{bcm: 4, f: FuncI2C, purpose: "sensor"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pin",
+			claims:  []claim{{bcm: 28, purpose: "LED"}},
+			wantErr: true,
+		},
+		{
+			name:    "purpose with a tab",
+			claims:  []claim{{bcm: 17, purpose: "LED\tred"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := OpenRegistry("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, c := range tc.claims {
+				switch {
+				case c.spi != nil:
+					err = r.ClaimSPI(*c.spi, c.purpose)
+				case c.i2c:
+					err = r.ClaimI2C(c.purpose)
+				default:
+					err = r.Claim(c.bcm, c.f, c.purpose)
+				}
+				last := i == len(tc.claims)-1
+				if err != nil && (!last || !tc.wantErr) {
+					t.Fatalf("claim %d: unexpected error %s", i, err)
+				}
+				if err == nil && last && tc.wantErr {
+					t.Fatalf("claim %d: expected an error", i)
+				}
+			}
+
+			claims, err := r.Claims()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, c := range claims {
+				got = append(got, c.BCM)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got claims on pins %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegistryConflictError(t *testing.T) {
+	r, _ := OpenRegistry("")
+	if err := r.Claim(12, FuncPWM, "LED"); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Claim(18, FuncPWM, "servo")
+	if !errors.Is(err, ErrClaimed) {
+		t.Fatalf("got %v, want ErrClaimed", err)
+	}
+	// The error names the pin and what it's used for
+	for _, s := range []string{"BCM 18", "BCM 12", "PWM channel 0", "LED"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error %q doesn't mention %q", err, s)
+		}
+	}
+}
+
+func TestRegistryAtomicClaims(t *testing.T) {
+	r, _ := OpenRegistry("")
+	if err := r.Claim(7, FuncGPIO, "button"); err != nil {
+		t.Fatal(err)
+	}
+	// CE1 is in use so none of the SPI pins are claimed
+	if err := r.ClaimSPI(1, "ADC"); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("got %v, want ErrClaimed", err)
+	}
+	claims, _ := r.Claims()
+	if len(claims) != 1 || claims[0].BCM != 7 || claims[0].Purpose != "button" {
+		t.Fatalf("got claims %v after a failed claim, want only the button's", claims)
+	}
+	// The pins that were free still are
+	for _, bcm := range []int{SPI0SCLK, SPI0MOSI, SPI0MISO} {
+		if err := r.Claim(bcm, FuncGPIO, "LED"); err != nil {
+			t.Errorf("BCM %d: unexpected error %s", bcm, err)
+		}
+		r.Release(bcm)
+	}
+
+	// A claim made up of pins that conflict with each other fails too
+	if err := r.claim(r.newClaim(12, FuncPWM, "LED"), r.newClaim(18, FuncPWM, "LED")); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("got %v, want ErrClaimed", err)
+	}
+	if claims, _ := r.Claims(); len(claims) != 1 {
+		t.Fatalf("got claims %v after a failed claim, want only the button's", claims)
+	}
+}
+
+func TestRegistryRelease(t *testing.T) {
+	r, _ := OpenRegistry("")
+	r.ClaimSPI(0, "LED matrix")
+	r.Claim(17, FuncGPIO, "LED")
+
+	if err := r.Release(SPI0CE0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Claim(SPI0SCLK, FuncGPIO, "button"); err == nil {
+		t.Error("the SPI clock's claim was released with CE0")
+	}
+	if err := r.Claim(SPI0CE0, FuncGPIO, "button"); err != nil {
+		t.Errorf("CE0 is still claimed after it was released, %s", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if claims, _ := r.Claims(); len(claims) != 0 {
+		t.Errorf("got claims %v after Close", claims)
+	}
+}
+
+func TestReadClaims(t *testing.T) {
+	file := strings.Join([]string{
+		"8\tSPI\t100\tleddotmatrix\tMAX7219 LED matrix",
+		"",
+		"garbage",
+		"17\tGPIO\t100\tledbargraph",
+		"x\tGPIO\t100\tledbargraph\tbar graph segment 1",
+		"40\tGPIO\t100\tledbargraph\tbar graph segment 1",
+		"17\tPWM?\t100\tledbargraph\tbar graph segment 1",
+		"17\tGPIO\t0\tledbargraph\tbar graph segment 1",
+		"17\tGPIO\t-1\tledbargraph\tbar graph segment 1",
+		"17\tGPIO\t101\tledbargraph\tbar graph segment 1\twith a tab",
+	}, "\n")
+
+	claims, warnings, err := readClaims(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Claim{
+		{BCM: 8, Function: FuncSPI, PID: 100, Program: "leddotmatrix", Purpose: "MAX7219 LED matrix"},
+		{BCM: 17, Function: FuncGPIO, PID: 101, Program: "ledbargraph", Purpose: "bar graph segment 1\twith a tab"},
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("got claims %v, want %v", claims, want)
+	}
+	if len(warnings) != 7 {
+		t.Errorf("got %d warnings, want 7 for the lines that aren't claims:\n%s", len(warnings), strings.Join(warnings, "\n"))
+	}
+	if len(warnings) > 0 && !strings.Contains(warnings[0], "line 3") {
+		t.Errorf("warning %q doesn't give the line number, 3", warnings[0])
+	}
+}
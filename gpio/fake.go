@@ -0,0 +1,351 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Fake is a Board that doesn't need a Raspberry Pi. Pins keep their last mode and
+// level, and inputs are driven with SetInput.
+//
+// With Record it also records the calls made to its pins and SPI controller. Each
+// call is recorded as a string, e.g., '17 High', '18 DutyCycle 512/1024', or 'spi
+// Transmit 01 3c', so a program's output can be compared with what's expected.
+// Recording is off by default since a long running program would record calls
+// until it ran out of memory, and reads are only recorded with RecordReads since
+// programs that poll an input read it continuously.
+type Fake struct {
+	mu       sync.Mutex
+	pins     [HeaderPins]fakePin
+	clock    int
+	record   bool // calls are recorded
+	reads    bool // reads are recorded too
+	ops      []string
+	spiOn    bool
+	sent     []byte
+	response []byte
+}
+
+// fakePin is the state of one of a fake board's pins
+type fakePin struct {
+	used     bool
+	mode     Mode
+	level    State // the level written
+	input    State // the level read in INPUT mode, if driven
+	driven   bool
+	pull     Pull
+	writes   int
+	duty     uint32
+	cycle    uint32
+	balanced bool
+}
+
+// NewFake returns a fake board
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// Pin returns a pin that records its calls
+func (f *Fake) Pin(bcm int) (Pin, error) {
+	if err := checkPin(bcm); err != nil {
+		return nil, err
+	}
+	return fakeHandle{f, bcm}, nil
+}
+
+// PWMPin returns a PWM pin that records its calls
+func (f *Fake) PWMPin(bcm int) (PWMPin, error) {
+	if err := checkPWMPin(bcm); err != nil {
+		return nil, err
+	}
+	return fakeHandle{f, bcm}, nil
+}
+
+// SPI returns an SPI controller that records its calls
+func (f *Fake) SPI() (SPI, error) {
+	f.do(-1, "Begin", func() {
+		f.spiOn = true
+		for _, bcm := range spiPins {
+			f.pins[bcm].used, f.pins[bcm].mode = true, Alt0
+		}
+	})
+	return fakeSPI{f}, nil
+}
+
+// Close does nothing, the pins' states can still be examined
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Record turns recording the calls on or off, it returns 'f' so it can be used
+// with NewFake, e.g., 'NewFake().Record(true)'
+func (f *Fake) Record(on bool) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record = on
+	return f
+}
+
+// RecordReads turns recording reads on or off, they're only recorded while
+// recording is on
+func (f *Fake) RecordReads(on bool) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads = on
+	return f
+}
+
+// Ops returns the calls recorded so far
+func (f *Fake) Ops() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ops...)
+}
+
+// ClearOps discards the calls recorded so far
+func (f *Fake) ClearOps() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ops = nil
+}
+
+// Level returns the level last written to BCM pin 'bcm'
+func (f *Fake) Level(bcm int) State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pins[bcm].level
+}
+
+// ModeOf returns BCM pin 'bcm's mode
+func (f *Fake) ModeOf(bcm int) Mode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pins[bcm].mode
+}
+
+// Writes returns the number of times BCM pin 'bcm' has been written to
+func (f *Fake) Writes(bcm int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pins[bcm].writes
+}
+
+// Duty returns BCM pin 'bcm's duty cycle
+func (f *Fake) Duty(bcm int) (dutyLen, cycleLen uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pins[bcm].duty, f.pins[bcm].cycle
+}
+
+// SetInput sets the level read from BCM pin 'bcm' while it's in INPUT mode
+func (f *Fake) SetInput(bcm int, s State) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pins[bcm].input, f.pins[bcm].driven = s, true
+}
+
+// SPISent returns the bytes sent with SPI so far
+func (f *Fake) SPISent() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]byte(nil), f.sent...)
+}
+
+// SetSPIResponse sets the bytes received by Exchange, they're repeated as needed.
+// Zeros are received if there's no response.
+func (f *Fake) SetSPIResponse(data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.response = append([]byte(nil), data...)
+}
+
+// Report writes the state of the pins that have been used to 'w'
+func (f *Fake) Report(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for bcm, p := range f.pins {
+		if !p.used {
+			continue
+		}
+		switch p.mode {
+		case PWM:
+			fmt.Fprintf(w, "BCM %2d: PWM %d/%d, clock %dHz\n", bcm, p.duty, p.cycle, f.clock)
+		case Alt0:
+			fmt.Fprintf(w, "BCM %2d: SPI\n", bcm)
+		default:
+			fmt.Fprintf(w, "BCM %2d: %s %s, %d writes\n", bcm, p.mode, p.level, p.writes)
+		}
+	}
+	if f.spiOn || len(f.sent) > 0 {
+		fmt.Fprintf(w, "SPI: %d bytes sent\n", len(f.sent))
+	}
+}
+
+// do records call 'op' on BCM pin 'bcm', or the SPI controller if 'bcm' is -1,
+// if recording is on, and applies its effect with 'change'
+func (f *Fake) do(bcm int, op string, change func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if bcm < 0 {
+		if f.record {
+			f.ops = append(f.ops, "spi "+op)
+		}
+	} else {
+		f.pins[bcm].used = true
+		if f.record {
+			f.ops = append(f.ops, fmt.Sprintf("%d %s", bcm, op))
+		}
+	}
+	change()
+}
+
+// fakeHandle is a Fake's pin
+type fakeHandle struct {
+	f   *Fake
+	bcm int
+}
+
+func (h fakeHandle) pin() *fakePin {
+	return &h.f.pins[h.bcm]
+}
+
+func (h fakeHandle) BCM() int {
+	return h.bcm
+}
+
+func (h fakeHandle) Mode(m Mode) {
+	h.f.do(h.bcm, "Mode "+m.String(), func() { h.pin().mode = m })
+}
+
+func (h fakeHandle) Output() {
+	h.f.do(h.bcm, "Output", func() { h.pin().mode = Output })
+}
+
+func (h fakeHandle) Input() {
+	h.f.do(h.bcm, "Input", func() { h.pin().mode = Input })
+}
+
+func (h fakeHandle) High() {
+	h.f.do(h.bcm, "High", func() { h.write(High) })
+}
+
+func (h fakeHandle) Low() {
+	h.f.do(h.bcm, "Low", func() { h.write(Low) })
+}
+
+func (h fakeHandle) Write(s State) {
+	h.f.do(h.bcm, "Write "+s.String(), func() { h.write(s) })
+}
+
+func (h fakeHandle) write(s State) {
+	p := h.pin()
+	p.level = s
+	p.writes++
+}
+
+func (h fakeHandle) Read() State {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	p := h.pin()
+	p.used = true
+	var s State
+	switch {
+	case p.mode != Input:
+		s = p.level
+	case p.driven:
+		s = p.input
+	case p.pull == PullUp:
+		s = High
+	}
+	if h.f.record && h.f.reads {
+		h.f.ops = append(h.f.ops, fmt.Sprintf("%d Read %s", h.bcm, s))
+	}
+	return s
+}
+
+func (h fakeHandle) Pull(pull Pull) {
+	h.f.do(h.bcm, "Pull "+pull.String(), func() { h.pin().pull = pull })
+}
+
+func (h fakeHandle) Freq(hz int) {
+	h.f.do(h.bcm, fmt.Sprintf("Freq %d", hz), func() { h.f.clock = hz })
+}
+
+func (h fakeHandle) DutyCycle(dutyLen, cycleLen uint32) {
+	h.f.do(h.bcm, fmt.Sprintf("DutyCycle %d/%d", dutyLen, cycleLen), func() {
+		p := h.pin()
+		p.duty, p.cycle, p.balanced = dutyLen, cycleLen, false
+	})
+}
+
+func (h fakeHandle) DutyCycleWithPWMMode(dutyLen, cycleLen uint32, balanced bool) {
+	mode := "mark-space"
+	if balanced {
+		mode = "balanced"
+	}
+	h.f.do(h.bcm, fmt.Sprintf("DutyCycle %d/%d %s", dutyLen, cycleLen, mode), func() {
+		p := h.pin()
+		p.duty, p.cycle, p.balanced = dutyLen, cycleLen, balanced
+	})
+}
+
+// fakeSPI is a Fake's SPI controller
+type fakeSPI struct {
+	f *Fake
+}
+
+func (s fakeSPI) ChipSelect(cs int) {
+	s.f.do(-1, fmt.Sprintf("ChipSelect %d", cs), func() {})
+}
+
+func (s fakeSPI) Speed(hz int) {
+	s.f.do(-1, fmt.Sprintf("Speed %d", hz), func() {})
+}
+
+func (s fakeSPI) Transmit(data ...byte) {
+	s.f.do(-1, "Transmit "+hexBytes(data), func() {
+		s.f.sent = append(s.f.sent, data...)
+	})
+}
+
+func (s fakeSPI) Exchange(data []byte) {
+	sent := hexBytes(data)
+	s.f.do(-1, "Exchange "+sent, func() {
+		s.f.sent = append(s.f.sent, data...)
+		for i := range data {
+			data[i] = 0
+			if len(s.f.response) > 0 {
+				data[i] = s.f.response[i%len(s.f.response)]
+			}
+		}
+	})
+}
+
+func (s fakeSPI) Close() {
+	s.f.do(-1, "Close", func() {
+		s.f.spiOn = false
+		for _, bcm := range spiPins {
+			s.f.pins[bcm].mode = Input
+		}
+	})
+}
+
+// hexBytes formats 'data' as space separated hex bytes
+func hexBytes(data []byte) string {
+	var sb strings.Builder
+	for i, b := range data {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		fmt.Fprintf(&sb, "%02x", b)
+	}
+	return sb.String()
+}
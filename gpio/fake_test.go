@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFakeRecording(t *testing.T) {
+	tests := []struct {
+		name   string
+		record bool
+		reads  bool
+		want   []string
+	}{
+		{name: "off", want: nil},
+		{
+			name:   "calls",
+			record: true,
+			want:   []string{"17 Output", "17 High", "4 Input", "4 Pull pull-up", "spi Begin", "spi Transmit 01 3c"},
+		},
+		{
+			name:   "calls and reads",
+			record: true,
+			reads:  true,
+			want:   []string{"17 Output", "17 High", "17 Read HIGH", "4 Input", "4 Pull pull-up", "4 Read HIGH", "spi Begin", "spi Transmit 01 3c"},
+		},
+		{name: "reads without recording", reads: true, want: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFake().Record(tc.record).RecordReads(tc.reads)
+			out, _ := f.Pin(17)
+			out.Output()
+			out.High()
+			out.Read()
+			in, _ := f.Pin(4)
+			in.Input()
+			in.Pull(PullUp)
+			if s := in.Read(); s != High {
+				t.Errorf("pulled up input read %s", s)
+			}
+			spi, _ := f.SPI()
+			spi.Transmit(0x01, 0x3c)
+
+			if got := f.Ops(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got ops %q, want %q", got, tc.want)
+			}
+			// The pins' states are kept whether or not the calls are recorded
+			if f.ModeOf(17) != Output || f.Level(17) != High || f.Writes(17) != 1 {
+				t.Errorf("BCM 17 is %s %s with %d writes, want OUTPUT HIGH with 1 write", f.ModeOf(17), f.Level(17), f.Writes(17))
+			}
+
+			f.ClearOps()
+			if ops := f.Ops(); len(ops) != 0 {
+				t.Errorf("got ops %q after ClearOps", ops)
+			}
+		})
+	}
+}
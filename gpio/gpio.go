@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package gpio defines the pin, PWM, and SPI interfaces used by the demos, so they
+// can run with different backends:
+//
+//	rpio - the go-rpio library, the demos' original implementation
+//	cdev - the GPIO character device (see the gpiocdev package), no PWM or SPI
+//	fake - keeps the pins' states, and can record every call, for checking what a
+//	       program did without a Pi
+//	sim  - a simulated Raspberry Pi, including linked PWM channels and SPI devices,
+//	       shown by the gpiosim command if it's running
+//
+// Pins are identified by their BCM pin numbers and only the 40 pin header's pins,
+// BCM 0 thru 27, are available. A Registry catches programs, or drivers, that try
+// to use the same pins.
+package gpio
+
+import (
+	"fmt"
+	"io"
+)
+
+// State is a pin's level
+type State uint8
+
+// States
+const (
+	Low State = iota
+	High
+)
+
+func (s State) String() string {
+	if s == Low {
+		return "LOW"
+	}
+	return "HIGH"
+}
+
+// Mode is a pin's function
+type Mode uint8
+
+// Modes
+const (
+	Input Mode = iota
+	Output
+	PWM  // hardware PWM, only on PWM pins
+	Alt0 // alternate function 0, SPI0 for the SPI pins, set by Board.SPI
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Input:
+		return "INPUT"
+	case Output:
+		return "OUTPUT"
+	case PWM:
+		return "PWM"
+	case Alt0:
+		return "ALT0"
+	default:
+		return fmt.Sprintf("Mode(%d)", m)
+	}
+}
+
+// Pull is a pin's pull-up/down resistor setting
+type Pull uint8
+
+// Pulls
+const (
+	PullOff Pull = iota
+	PullDown
+	PullUp
+)
+
+func (p Pull) String() string {
+	switch p {
+	case PullDown:
+		return "pull-down"
+	case PullUp:
+		return "pull-up"
+	default:
+		return "no pull"
+	}
+}
+
+// HeaderPins is the number of GPIO pins on the 40 pin header, BCM 0 thru 27
+const HeaderPins = 28
+
+// Pin is a GPIO pin. Like go-rpio's its methods don't return errors, a backend
+// that can fail reports its first error when the board is closed.
+type Pin interface {
+	BCM() int // the pin's BCM number
+	Mode(m Mode)
+	Output() // same as Mode(Output)
+	Input()  // same as Mode(Input)
+	High()
+	Low()
+	Write(s State)
+	Read() State
+	Pull(p Pull)
+}
+
+// PWMPin is a pin that supports hardware PWM
+type PWMPin interface {
+	Pin
+	// Freq sets the PWM clock frequency, it's shared by all of the PWM pins
+	Freq(hz int)
+	// DutyCycle sets the pin HIGH for the first 'dutyLen' of every 'cycleLen'
+	// clock ticks (mark-space mode). The output frequency is the PWM clock
+	// frequency divided by 'cycleLen'.
+	DutyCycle(dutyLen, cycleLen uint32)
+	// DutyCycleWithPWMMode is DutyCycle with a choice of mark-space or balanced
+	// mode, in balanced mode the HIGH ticks are spread evenly over the cycle
+	DutyCycleWithPWMMode(dutyLen, cycleLen uint32, balanced bool)
+}
+
+// SPI is the SPI0 controller
+type SPI interface {
+	// ChipSelect selects the chip select line, 0 (CE0, BCM 8) or 1 (CE1, BCM 7),
+	// asserted while data is transmitted
+	ChipSelect(cs int)
+	// Speed sets the SPI clock frequency
+	Speed(hz int)
+	// Transmit sends 'data', ignoring the data received
+	Transmit(data ...byte)
+	// Exchange sends 'data', replacing it with the data received
+	Exchange(data []byte)
+	// Close returns the SPI pins to INPUT mode
+	Close()
+}
+
+// Board is a Raspberry Pi, real or otherwise
+type Board interface {
+	// Pin returns the pin with BCM number 'bcm'
+	Pin(bcm int) (Pin, error)
+	// PWMPin returns the pin with BCM number 'bcm', a hardware PWM pin
+	PWMPin(bcm int) (PWMPin, error)
+	// SPI enables SPI0, its pins are switched to SPI mode
+	SPI() (SPI, error)
+	// Close releases the board's resources
+	Close() error
+}
+
+// Backends are the backends accepted by Open
+var Backends = []string{"rpio", "cdev", "fake", "sim"}
+
+// Open opens a board using 'backend', one of Backends. 'chip' is the GPIO
+// character device used by the cdev backend, e.g., 'gpiochip0'.
+func Open(backend, chip string) (Board, error) {
+	switch backend {
+	case "rpio":
+		return OpenRPIO()
+	case "cdev":
+		return OpenCdev(chip)
+	case "fake":
+		return NewFake(), nil
+	case "sim":
+		s := NewSim()
+		// The board is shown by the gpiosim viewer if it's running, there's
+		// nothing to connect to otherwise
+		s.Connect(SimSocket())
+		return s, nil
+	default:
+		return nil, fmt.Errorf("invalid backend %q, must be one of %v", backend, Backends)
+	}
+}
+
+// Report writes the final state of a fake or simulated board's pins to 'w', it
+// does nothing for other boards.
+func Report(w io.Writer, b Board) {
+	if r, ok := b.(interface{ Report(w io.Writer) }); ok {
+		r.Report(w)
+	}
+}
+
+// pwmChannels maps the header's hardware PWM pins to their PWM channel. Pins on
+// the same channel are linked, they always have the same duty cycle.
+var pwmChannels = map[int]int{12: 0, 18: 0, 13: 1, 19: 1}
+
+// PWMChannel returns the PWM channel of BCM pin 'bcm', ok is false if it isn't
+// a hardware PWM pin
+func PWMChannel(bcm int) (channel int, ok bool) {
+	channel, ok = pwmChannels[bcm]
+	return channel, ok
+}
+
+// SPI0 pins
+const (
+	SPI0CE1  = 7
+	SPI0CE0  = 8
+	SPI0MISO = 9
+	SPI0MOSI = 10
+	SPI0SCLK = 11
+)
+
+// I2C1 pins
+const (
+	I2C1SDA = 2
+	I2C1SCL = 3
+)
+
+// spiPins are SPI0's pins
+var spiPins = []int{SPI0CE1, SPI0CE0, SPI0MISO, SPI0MOSI, SPI0SCLK}
+
+func checkPin(bcm int) error {
+	if bcm < 0 || bcm >= HeaderPins {
+		return fmt.Errorf("BCM pin %d isn't on the 40 pin header, must be 0 thru %d", bcm, HeaderPins-1)
+	}
+	return nil
+}
+
+func checkPWMPin(bcm int) error {
+	if err := checkPin(bcm); err != nil {
+		return err
+	}
+	if _, ok := PWMChannel(bcm); !ok {
+		return fmt.Errorf("BCM pin %d isn't a hardware PWM pin, they're 12, 13, 18, and 19", bcm)
+	}
+	return nil
+}
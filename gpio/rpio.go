@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+// rpioBoard is a Board implemented with the go-rpio library
+type rpioBoard struct{}
+
+// OpenRPIO opens the board using the go-rpio library, it needs access to
+// /dev/gpiomem, or /dev/mem and root for PWM and SPI.
+func OpenRPIO() (Board, error) {
+	if err := rpio.Open(); err != nil {
+		return nil, err
+	}
+	return rpioBoard{}, nil
+}
+
+func (rpioBoard) Pin(bcm int) (Pin, error) {
+	if err := checkPin(bcm); err != nil {
+		return nil, err
+	}
+	return rpioPin{rpio.Pin(bcm)}, nil
+}
+
+func (rpioBoard) PWMPin(bcm int) (PWMPin, error) {
+	if err := checkPWMPin(bcm); err != nil {
+		return nil, err
+	}
+	return rpioPin{rpio.Pin(bcm)}, nil
+}
+
+func (rpioBoard) SPI() (SPI, error) {
+	if err := rpio.SpiBegin(rpio.Spi0); err != nil {
+		return nil, err
+	}
+	return rpioSPI{}, nil
+}
+
+func (rpioBoard) Close() error {
+	return rpio.Close()
+}
+
+// rpioPin adapts rpio.Pin to PWMPin
+type rpioPin struct {
+	pin rpio.Pin
+}
+
+func (p rpioPin) BCM() int {
+	return int(p.pin)
+}
+
+func (p rpioPin) Mode(m Mode) {
+	switch m {
+	case Input:
+		p.pin.Mode(rpio.Input)
+	case Output:
+		p.pin.Mode(rpio.Output)
+	case PWM:
+		p.pin.Mode(rpio.Pwm)
+	case Alt0:
+		p.pin.Mode(rpio.Alt0)
+	}
+}
+
+func (p rpioPin) Output() {
+	p.pin.Output()
+}
+
+func (p rpioPin) Input() {
+	p.pin.Input()
+}
+
+func (p rpioPin) High() {
+	p.pin.High()
+}
+
+func (p rpioPin) Low() {
+	p.pin.Low()
+}
+
+func (p rpioPin) Write(s State) {
+	p.pin.Write(rpio.State(s))
+}
+
+func (p rpioPin) Read() State {
+	return State(p.pin.Read())
+}
+
+func (p rpioPin) Pull(pull Pull) {
+	switch pull {
+	case PullOff:
+		p.pin.PullOff()
+	case PullDown:
+		p.pin.PullDown()
+	case PullUp:
+		p.pin.PullUp()
+	}
+}
+
+func (p rpioPin) Freq(hz int) {
+	p.pin.Freq(hz)
+}
+
+func (p rpioPin) DutyCycle(dutyLen, cycleLen uint32) {
+	p.pin.DutyCycle(dutyLen, cycleLen)
+}
+
+func (p rpioPin) DutyCycleWithPWMMode(dutyLen, cycleLen uint32, balanced bool) {
+	rpio.SetDutyCycleWithPwmMode(p.pin, dutyLen, cycleLen, balanced)
+}
+
+// rpioSPI adapts go-rpio's SPI0 functions to SPI
+type rpioSPI struct{}
+
+func (rpioSPI) ChipSelect(cs int) {
+	rpio.SpiChipSelect(uint8(cs))
+}
+
+func (rpioSPI) Speed(hz int) {
+	rpio.SpiSpeed(hz)
+}
+
+func (rpioSPI) Transmit(data ...byte) {
+	rpio.SpiTransmit(data...)
+}
+
+func (rpioSPI) Exchange(data []byte) {
+	rpio.SpiExchange(data)
+}
+
+func (rpioSPI) Close() {
+	rpio.SpiEnd(rpio.Spi0)
+}
@@ -0,0 +1,429 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Sim is a Board that simulates a Raspberry Pi's GPIO, PWM, and SPI0 controllers.
+// Unlike Fake it behaves like the hardware: pins on the same PWM channel (12 and
+// 18, 13 and 19) share a duty cycle, all PWM pins share the PWM clock, inputs read
+// their pull resistor's level unless driven with SetInput, and bytes sent with SPI
+// are delivered to the SPIDevice attached to the selected chip select.
+type Sim struct {
+	mu       sync.Mutex
+	pins     [HeaderPins]simPin
+	clock    int
+	channels [2]simChannel
+	cs       int
+	speed    int
+	devices  [2]SPIDevice
+	notify   []chan<- struct{}
+	watchers []func(bcm int, level State)
+	ops      chan string   // the viewer connection's queue, see Connect
+	done     chan struct{} // closed when the viewer connection is finished
+}
+
+// simPin is the state of one of a simulated board's pins
+type simPin struct {
+	used     bool
+	mode     Mode
+	latch    State // the level written, driven in OUTPUT mode
+	pull     Pull
+	driven   bool  // true if driven externally by SetInput
+	external State // the externally driven level
+}
+
+// simChannel is a PWM channel's settings
+type simChannel struct {
+	duty     uint32
+	cycle    uint32
+	balanced bool
+}
+
+// SPIDevice is a device attached to a simulated board's SPI0 bus. Its methods are
+// called while the board is locked, they must not call the board's methods.
+type SPIDevice interface {
+	// Select is called when the device's chip select is asserted (LOW)
+	Select()
+	// Transfer is called for each byte sent while the device is selected, it
+	// returns the byte sent back
+	Transfer(b byte) byte
+	// Deselect is called when the device's chip select is released (HIGH)
+	Deselect()
+}
+
+// PinState is a simulated pin's state
+type PinState struct {
+	Used  bool // true if the program has used the pin
+	Mode  Mode
+	Pull  Pull
+	Level State   // a PWM pin is HIGH if its duty cycle isn't 0
+	Duty  float64 // the fraction of the time the pin is HIGH
+	Freq  float64 // a PWM pin's frequency in Hz
+}
+
+// NewSim returns a simulated board with all pins in INPUT mode
+func NewSim() *Sim {
+	return &Sim{}
+}
+
+// Pin returns a simulated pin
+func (s *Sim) Pin(bcm int) (Pin, error) {
+	if err := checkPin(bcm); err != nil {
+		return nil, err
+	}
+	return simHandle{s, bcm}, nil
+}
+
+// PWMPin returns a simulated PWM pin
+func (s *Sim) PWMPin(bcm int) (PWMPin, error) {
+	if err := checkPWMPin(bcm); err != nil {
+		return nil, err
+	}
+	return simHandle{s, bcm}, nil
+}
+
+// SPI switches the SPI0 pins to SPI mode and returns the simulated controller
+func (s *Sim) SPI() (SPI, error) {
+	s.change("spi Begin", func() {
+		for _, bcm := range spiPins {
+			s.pins[bcm].used = true
+			s.setMode(bcm, Alt0)
+		}
+	})
+	return simSPI{s}, nil
+}
+
+// Close disconnects the board from the gpiosim viewer, if it's connected. The
+// pins' states can still be examined.
+func (s *Sim) Close() error {
+	s.mu.Lock()
+	ops, done := s.ops, s.done
+	s.ops = nil
+	s.mu.Unlock()
+	if ops != nil {
+		close(ops)
+		<-done
+	}
+	return nil
+}
+
+// AttachSPI attaches 'dev' to chip select 'cs', 0 (CE0, BCM 8) or 1 (CE1, BCM 7).
+// The device is selected while data is transmitted to 'cs', or while the chip
+// select pin is LOW if the program drives it in OUTPUT mode.
+func (s *Sim) AttachSPI(cs int, dev SPIDevice) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices[cs&1] = dev
+}
+
+// SetInput drives BCM pin 'bcm' to 's', as an external device would
+func (s *Sim) SetInput(bcm int, st State) {
+	s.change("", func() {
+		s.pins[bcm].driven, s.pins[bcm].external = true, st
+	})
+}
+
+// ReleaseInput stops driving BCM pin 'bcm', its level is then set by its pull resistor
+func (s *Sim) ReleaseInput(bcm int) {
+	s.change("", func() {
+		s.pins[bcm].driven = false
+	})
+}
+
+// Notify sends to 'c' whenever the board's state changes. Sends don't block,
+// notifications are dropped if 'c' isn't ready, so 'c' should be buffered.
+func (s *Sim) Notify(c chan<- struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notify = append(s.notify, c)
+}
+
+// Watch calls 'fn' whenever a pin's level changes, e.g., to simulate a device
+// clocked by a pin. Like an SPIDevice's methods 'fn' is called while the board
+// is locked, it must not call the board's methods.
+func (s *Sim) Watch(fn func(bcm int, level State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers = append(s.watchers, fn)
+}
+
+// State returns BCM pin 'bcm's state
+func (s *Sim) State(bcm int) PinState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state(bcm)
+}
+
+func (s *Sim) state(bcm int) PinState {
+	p := s.pins[bcm]
+	ps := PinState{Used: p.used, Mode: p.mode, Pull: p.pull}
+	switch p.mode {
+	case Output:
+		ps.Level = p.latch
+	case PWM:
+		ch := s.channels[pwmChannels[bcm]]
+		if ch.cycle > 0 {
+			ps.Duty = float64(ch.duty) / float64(ch.cycle)
+			if ps.Duty > 1 {
+				ps.Duty = 1
+			}
+			ps.Freq = float64(s.clock) / float64(ch.cycle)
+		}
+		if ps.Duty > 0 {
+			ps.Level = High
+		}
+	case Alt0:
+		// The chip selects are HIGH when idle
+		if bcm == SPI0CE0 || bcm == SPI0CE1 {
+			ps.Level = High
+		}
+	default:
+		switch {
+		case p.driven:
+			ps.Level = p.external
+		case p.pull == PullUp:
+			ps.Level = High
+		}
+	}
+	if ps.Mode != PWM && ps.Level == High {
+		ps.Duty = 1
+	}
+	return ps
+}
+
+// Report writes the state of the pins that have been used to 'w'
+func (s *Sim) Report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for bcm := range s.pins {
+		ps := s.state(bcm)
+		if !ps.Used {
+			continue
+		}
+		if ps.Mode == PWM {
+			fmt.Fprintf(w, "BCM %2d: PWM %.1f%% at %.1fHz\n", bcm, ps.Duty*100, ps.Freq)
+			continue
+		}
+		fmt.Fprintf(w, "BCM %2d: %s %s\n", bcm, ps.Mode, ps.Level)
+	}
+}
+
+// change applies 'change' to the board, selects or deselects SPI devices and calls
+// the watchers for the pins whose level changed, sends 'op' to the viewer if it
+// isn't empty, and then sends notifications.
+func (s *Sim) change(op string, change func()) {
+	s.mu.Lock()
+	var before [HeaderPins]State
+	for bcm := range before {
+		before[bcm] = s.state(bcm).Level
+	}
+	change()
+	for bcm := range before {
+		after := s.state(bcm).Level
+		if after == before[bcm] {
+			continue
+		}
+		s.chipSelect(bcm, after)
+		for _, fn := range s.watchers {
+			fn(bcm, after)
+		}
+	}
+	if op != "" && s.ops != nil {
+		s.ops <- op
+	}
+	notify := s.notify
+	s.mu.Unlock()
+	for _, c := range notify {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// setMode sets BCM pin 'bcm's mode
+func (s *Sim) setMode(bcm int, m Mode) {
+	if m == PWM {
+		if _, ok := pwmChannels[bcm]; !ok {
+			// As on the Pi, only PWM pins can be put in PWM mode
+			return
+		}
+	}
+	s.pins[bcm].mode = m
+}
+
+// chipSelect selects or deselects the SPI device attached to chip select pin
+// 'bcm' if the program is driving the pin and its level has changed to 'level'
+func (s *Sim) chipSelect(bcm int, level State) {
+	dev := s.device(bcm)
+	if dev == nil || s.pins[bcm].mode != Output {
+		return
+	}
+	if level == Low {
+		dev.Select()
+	} else {
+		dev.Deselect()
+	}
+}
+
+// device returns the SPI device attached to chip select pin 'bcm', if any
+func (s *Sim) device(bcm int) SPIDevice {
+	switch bcm {
+	case SPI0CE0:
+		return s.devices[0]
+	case SPI0CE1:
+		return s.devices[1]
+	}
+	return nil
+}
+
+// transfer sends 'data' to the selected SPI device, replacing it with the bytes received
+func (s *Sim) transfer(data []byte) {
+	ce := SPI0CE0
+	if s.cs == 1 {
+		ce = SPI0CE1
+	}
+	dev := s.device(ce)
+	p := s.pins[ce]
+	// The controller drives the chip select only if the pin is in ALT0 mode
+	hardware := p.mode == Alt0
+	selected := hardware || p.mode == Output && p.latch == Low
+	if dev == nil || !selected {
+		for i := range data {
+			data[i] = 0
+		}
+		return
+	}
+	if hardware {
+		dev.Select()
+	}
+	for i, b := range data {
+		data[i] = dev.Transfer(b)
+	}
+	if hardware {
+		dev.Deselect()
+	}
+}
+
+// simHandle is a Sim's pin
+type simHandle struct {
+	s   *Sim
+	bcm int
+}
+
+func (h simHandle) BCM() int {
+	return h.bcm
+}
+
+func (h simHandle) Mode(m Mode) {
+	h.s.change(h.op("Mode "+m.String()), func() {
+		h.s.pins[h.bcm].used = true
+		h.s.setMode(h.bcm, m)
+	})
+}
+
+func (h simHandle) Output() {
+	h.Mode(Output)
+}
+
+func (h simHandle) Input() {
+	h.Mode(Input)
+}
+
+func (h simHandle) High() {
+	h.Write(High)
+}
+
+func (h simHandle) Low() {
+	h.Write(Low)
+}
+
+func (h simHandle) Write(st State) {
+	h.s.change(h.op("Write "+st.String()), func() {
+		h.s.pins[h.bcm].used = true
+		h.s.pins[h.bcm].latch = st
+	})
+}
+
+func (h simHandle) Read() State {
+	return h.s.State(h.bcm).Level
+}
+
+func (h simHandle) Pull(pull Pull) {
+	h.s.change(h.op("Pull "+pull.String()), func() {
+		h.s.pins[h.bcm].used = true
+		h.s.pins[h.bcm].pull = pull
+	})
+}
+
+func (h simHandle) Freq(hz int) {
+	h.s.change(h.op(fmt.Sprintf("Freq %d", hz)), func() {
+		h.s.clock = hz
+	})
+}
+
+func (h simHandle) DutyCycle(dutyLen, cycleLen uint32) {
+	h.DutyCycleWithPWMMode(dutyLen, cycleLen, false)
+}
+
+func (h simHandle) DutyCycleWithPWMMode(dutyLen, cycleLen uint32, balanced bool) {
+	mode := "mark-space"
+	if balanced {
+		mode = "balanced"
+	}
+	h.s.change(h.op(fmt.Sprintf("DutyCycle %d/%d %s", dutyLen, cycleLen, mode)), func() {
+		h.s.channels[pwmChannels[h.bcm]] = simChannel{duty: dutyLen, cycle: cycleLen, balanced: balanced}
+	})
+}
+
+// op formats call 'op' on the pin as Fake records it
+func (h simHandle) op(op string) string {
+	return fmt.Sprintf("%d %s", h.bcm, op)
+}
+
+// simSPI is a Sim's SPI controller
+type simSPI struct {
+	s *Sim
+}
+
+func (c simSPI) ChipSelect(cs int) {
+	c.s.change(fmt.Sprintf("spi ChipSelect %d", cs), func() {
+		c.s.cs = cs & 1
+	})
+}
+
+func (c simSPI) Speed(hz int) {
+	c.s.change(fmt.Sprintf("spi Speed %d", hz), func() {
+		c.s.speed = hz
+	})
+}
+
+func (c simSPI) Transmit(data ...byte) {
+	buf := append([]byte(nil), data...)
+	c.s.change("spi Transmit "+hexBytes(data), func() {
+		c.s.transfer(buf)
+	})
+}
+
+func (c simSPI) Exchange(data []byte) {
+	c.s.change("spi Exchange "+hexBytes(data), func() {
+		c.s.transfer(data)
+	})
+}
+
+func (c simSPI) Close() {
+	c.s.change("spi Close", func() {
+		for _, bcm := range spiPins {
+			c.s.setMode(bcm, Input)
+		}
+	})
+}
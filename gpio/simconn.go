@@ -0,0 +1,207 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SimSocket returns the Unix socket the gpiosim viewer listens on, $GPIOSIM_SOCKET
+// or gpiosim.sock in the temporary directory
+func SimSocket() string {
+	if path := os.Getenv("GPIOSIM_SOCKET"); path != "" {
+		return path
+	}
+	return filepath.Join(os.TempDir(), "gpiosim.sock")
+}
+
+// Connect connects the board to the gpiosim viewer listening on Unix socket 'path'.
+// A "# <program> (pid <pid>)" line introduces the program, then every call it
+// makes is sent to the viewer, one per line, as Fake records it. The viewer
+// replays them on its own Sim with virtual devices attached. The program is
+// slowed down, not the calls dropped, if the viewer falls behind.
+// Connect should be called before the board is used.
+func (s *Sim) Connect(path string) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	ops, done := make(chan string, 4096), make(chan struct{})
+	s.mu.Lock()
+	s.ops, s.done = ops, done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer conn.Close()
+		w := bufio.NewWriter(conn)
+		// Introduce the program to the viewer
+		_, err := fmt.Fprintf(w, "# %s (pid %d)\n", filepath.Base(os.Args[0]), os.Getpid())
+		for op := range ops {
+			if err != nil {
+				// The viewer has gone away, discard the rest
+				continue
+			}
+			if _, err = fmt.Fprintln(w, op); err == nil && len(ops) == 0 {
+				err = w.Flush()
+			}
+		}
+		if err == nil {
+			w.Flush()
+		}
+	}()
+	return nil
+}
+
+// Apply makes call 'op', as recorded by Fake, on the board
+func (s *Sim) Apply(op string) error {
+	fields := strings.Fields(op)
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid op %q", op)
+	}
+	if fields[0] == "spi" {
+		return s.applySPI(op, fields[1:])
+	}
+
+	bcm, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fmt.Errorf("invalid op %q, %s", op, err)
+	}
+	if err := checkPin(bcm); err != nil {
+		return err
+	}
+	h := simHandle{s, bcm}
+	args := fields[2:]
+	switch fields[1] {
+	case "Mode":
+		m, err := parseMode(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		h.Mode(m)
+	case "Output":
+		h.Output()
+	case "Input":
+		h.Input()
+	case "High":
+		h.High()
+	case "Low":
+		h.Low()
+	case "Write":
+		st, err := parseState(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		h.Write(st)
+	case "Read":
+		// Reading doesn't change anything
+	case "Pull":
+		p, err := parsePull(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		h.Pull(p)
+	case "Freq":
+		if err := checkPWMPin(bcm); err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("invalid op %q", op)
+		}
+		hz, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid op %q, %s", op, err)
+		}
+		h.Freq(hz)
+	case "DutyCycle":
+		if err := checkPWMPin(bcm); err != nil {
+			return err
+		}
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("invalid op %q", op)
+		}
+		var dutyLen, cycleLen uint32
+		if _, err := fmt.Sscanf(args[0], "%d/%d", &dutyLen, &cycleLen); err != nil {
+			return fmt.Errorf("invalid op %q, %s", op, err)
+		}
+		balanced := len(args) == 2 && args[1] == "balanced"
+		h.DutyCycleWithPWMMode(dutyLen, cycleLen, balanced)
+	default:
+		return fmt.Errorf("invalid op %q", op)
+	}
+	return nil
+}
+
+// applySPI makes SPI controller call 'op', split into 'fields', on the board
+func (s *Sim) applySPI(op string, fields []string) error {
+	c := simSPI{s}
+	switch fields[0] {
+	case "Begin":
+		s.SPI()
+	case "ChipSelect", "Speed":
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid op %q", op)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid op %q, %s", op, err)
+		}
+		if fields[0] == "ChipSelect" {
+			c.ChipSelect(n)
+		} else {
+			c.Speed(n)
+		}
+	case "Transmit", "Exchange":
+		data := make([]byte, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			b, err := strconv.ParseUint(f, 16, 8)
+			if err != nil {
+				return fmt.Errorf("invalid op %q, %s", op, err)
+			}
+			data = append(data, byte(b))
+		}
+		c.Transmit(data...)
+	case "Close":
+		c.Close()
+	default:
+		return fmt.Errorf("invalid op %q", op)
+	}
+	return nil
+}
+
+func parseMode(s string) (Mode, error) {
+	for _, m := range []Mode{Input, Output, PWM, Alt0} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid mode %q", s)
+}
+
+func parseState(s string) (State, error) {
+	for _, st := range []State{Low, High} {
+		if s == st.String() {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid level %q", s)
+}
+
+func parsePull(s string) (Pull, error) {
+	for _, p := range []Pull{PullOff, PullDown, PullUp} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid pull %q", s)
+}
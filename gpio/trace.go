@@ -0,0 +1,333 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youngkin/gpio/vcd"
+)
+
+// Trace is a Board that records every call made to another board's pins and SPI
+// controller, with the time it was made, so what a program did on the wires can
+// be examined. A trace can be saved as a Value Change Dump (VCD) file, for viewers
+// such as GTKWave or PulseView, or as a text log that can be compared with another
+// run's. The trace is kept in memory until it's saved.
+type Trace struct {
+	b     Board
+	start time.Time
+
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+// TraceEvent is a traced call
+type TraceEvent struct {
+	Time time.Duration // since the trace started
+	Pin  int           // BCM pin, -1 for the SPI controller
+	Op   string        // the call as Fake records it, without the pin, e.g., "Write HIGH"
+}
+
+// NewTrace returns a Board that traces the calls made to 'b'
+func NewTrace(b Board) *Trace {
+	return &Trace{b: b, start: time.Now()}
+}
+
+// Pin returns a traced pin
+func (t *Trace) Pin(bcm int) (Pin, error) {
+	p, err := t.b.Pin(bcm)
+	if err != nil {
+		return nil, err
+	}
+	return traceHandle{t: t, p: p}, nil
+}
+
+// PWMPin returns a traced PWM pin
+func (t *Trace) PWMPin(bcm int) (PWMPin, error) {
+	p, err := t.b.PWMPin(bcm)
+	if err != nil {
+		return nil, err
+	}
+	return traceHandle{t: t, p: p, pwm: p}, nil
+}
+
+// SPI returns a traced SPI controller
+func (t *Trace) SPI() (SPI, error) {
+	spi, err := t.b.SPI()
+	if err != nil {
+		return nil, err
+	}
+	t.record(-1, "Begin")
+	return traceSPI{t, spi}, nil
+}
+
+// Close closes the traced board, the trace can still be saved
+func (t *Trace) Close() error {
+	return t.b.Close()
+}
+
+// Report reports the traced board's pins if it's a fake or simulated board
+func (t *Trace) Report(w io.Writer) {
+	Report(w, t.b)
+}
+
+// Events returns the calls traced so far
+func (t *Trace) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+// record records call 'op' on BCM pin 'bcm', or the SPI controller if 'bcm' is -1.
+// Each call is given its own time, a nanosecond after the previous one if need be,
+// so that the calls' order is kept in a VCD file.
+func (t *Trace) record(bcm int, op string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Since(t.start)
+	if n := len(t.events); n > 0 && now <= t.events[n-1].Time {
+		now = t.events[n-1].Time + 1
+	}
+	t.events = append(t.events, TraceEvent{Time: now, Pin: bcm, Op: op})
+}
+
+// Save writes the trace to file 'path', as a VCD file if its extension is '.vcd'
+// and as a log otherwise
+func (t *Trace) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".vcd") {
+		err = t.WriteVCD(f)
+	} else {
+		err = t.WriteLog(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteLog writes the trace to 'w', a call per line preceded by its time in seconds,
+// e.g., '0.001234 17 Write HIGH'. Removing the times, e.g., with 'cut -d" " -f2-',
+// allows runs to be compared with diff.
+func (t *Trace) WriteLog(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, ev := range t.Events() {
+		pin := "spi"
+		if ev.Pin >= 0 {
+			pin = strconv.Itoa(ev.Pin)
+		}
+		fmt.Fprintf(bw, "%.6f %s %s\n", ev.Time.Seconds(), pin, ev.Op)
+	}
+	return bw.Flush()
+}
+
+// spiByteTime is the time taken to send a byte if the SPI clock speed isn't set
+const spiByteTime = 8 * time.Microsecond // 1MHz
+
+// WriteVCD writes the trace to 'w' as a Value Change Dump with a 1ns timescale.
+// Each pin used is a wire named for its BCM number, e.g., 'gpio17', that's 0 or 1
+// while it's an OUTPUT, 'z' while it's an INPUT, and 'x' while it's driven by the
+// PWM or SPI controller. A PWM pin's duty cycle, 0 thru 1, is a real variable, e.g.,
+// 'gpio18_duty', and the bytes sent with SPI are the 8 bit 'spi_mosi' variable. The
+// bytes of a transfer are spread out by the time taken to send them at the SPI
+// clock speed, or 1MHz if it isn't set.
+func (t *Trace) WriteVCD(w io.Writer) error {
+	events := t.Events()
+	vw := vcd.New()
+	type pinState struct {
+		mode  Mode
+		latch State
+		moded bool // true once the pin's mode is set
+	}
+	pins := map[int]*pinState{}
+	// wire returns a pin's value
+	wire := func(ps *pinState) byte {
+		switch {
+		case !ps.moded:
+			return 'x'
+		case ps.mode == Output:
+			return '0' + byte(ps.latch)
+		case ps.mode == Input:
+			return 'z'
+		default:
+			return 'x'
+		}
+	}
+	byteTime := spiByteTime
+
+	for _, ev := range events {
+		fields := strings.Fields(ev.Op)
+		if len(fields) == 0 {
+			continue
+		}
+		if ev.Pin < 0 {
+			switch fields[0] {
+			case "Speed":
+				if hz, err := strconv.Atoi(fields[1]); err == nil && hz > 0 {
+					byteTime = 8 * time.Second / time.Duration(hz)
+				}
+			case "Transmit", "Exchange":
+				for i, f := range fields[1:] {
+					b, err := strconv.ParseUint(f, 16, 8)
+					if err != nil {
+						continue
+					}
+					vw.Vector(ev.Time+time.Duration(i)*byteTime, "spi_mosi", 8, b)
+				}
+			}
+			continue
+		}
+
+		name := fmt.Sprintf("gpio%d", ev.Pin)
+		ps := pins[ev.Pin]
+		if ps == nil {
+			ps = &pinState{}
+			pins[ev.Pin] = ps
+		}
+		switch fields[0] {
+		case "Mode":
+			if m, err := parseMode(strings.Join(fields[1:], " ")); err == nil {
+				ps.mode, ps.moded = m, true
+			}
+		case "Output":
+			ps.mode, ps.moded = Output, true
+		case "Input":
+			ps.mode, ps.moded = Input, true
+		case "High":
+			ps.latch = High
+		case "Low":
+			ps.latch = Low
+		case "Write":
+			if st, err := parseState(strings.Join(fields[1:], " ")); err == nil {
+				ps.latch = st
+			}
+		case "DutyCycle":
+			var dutyLen, cycleLen uint32
+			if _, err := fmt.Sscanf(fields[1], "%d/%d", &dutyLen, &cycleLen); err == nil && cycleLen > 0 {
+				vw.Real(ev.Time, name+"_duty", float64(dutyLen)/float64(cycleLen))
+			}
+			continue
+		default:
+			// Pull and Freq don't change the pin's level
+			continue
+		}
+		vw.Wire(ev.Time, name, wire(ps))
+	}
+	return vw.Write(w, "gpio")
+}
+
+// traceHandle is a traced pin, 'pwm' is set if it's a PWM pin
+type traceHandle struct {
+	t   *Trace
+	p   Pin
+	pwm PWMPin
+}
+
+func (h traceHandle) BCM() int {
+	return h.p.BCM()
+}
+
+func (h traceHandle) Mode(m Mode) {
+	h.t.record(h.p.BCM(), "Mode "+m.String())
+	h.p.Mode(m)
+}
+
+func (h traceHandle) Output() {
+	h.t.record(h.p.BCM(), "Output")
+	h.p.Output()
+}
+
+func (h traceHandle) Input() {
+	h.t.record(h.p.BCM(), "Input")
+	h.p.Input()
+}
+
+func (h traceHandle) High() {
+	h.t.record(h.p.BCM(), "High")
+	h.p.High()
+}
+
+func (h traceHandle) Low() {
+	h.t.record(h.p.BCM(), "Low")
+	h.p.Low()
+}
+
+func (h traceHandle) Write(s State) {
+	h.t.record(h.p.BCM(), "Write "+s.String())
+	h.p.Write(s)
+}
+
+// Read isn't traced, it doesn't change anything
+func (h traceHandle) Read() State {
+	return h.p.Read()
+}
+
+func (h traceHandle) Pull(p Pull) {
+	h.t.record(h.p.BCM(), "Pull "+p.String())
+	h.p.Pull(p)
+}
+
+func (h traceHandle) Freq(hz int) {
+	h.t.record(h.p.BCM(), fmt.Sprintf("Freq %d", hz))
+	h.pwm.Freq(hz)
+}
+
+func (h traceHandle) DutyCycle(dutyLen, cycleLen uint32) {
+	h.t.record(h.p.BCM(), fmt.Sprintf("DutyCycle %d/%d", dutyLen, cycleLen))
+	h.pwm.DutyCycle(dutyLen, cycleLen)
+}
+
+func (h traceHandle) DutyCycleWithPWMMode(dutyLen, cycleLen uint32, balanced bool) {
+	mode := "mark-space"
+	if balanced {
+		mode = "balanced"
+	}
+	h.t.record(h.p.BCM(), fmt.Sprintf("DutyCycle %d/%d %s", dutyLen, cycleLen, mode))
+	h.pwm.DutyCycleWithPWMMode(dutyLen, cycleLen, balanced)
+}
+
+// traceSPI is a traced SPI controller
+type traceSPI struct {
+	t   *Trace
+	spi SPI
+}
+
+func (s traceSPI) ChipSelect(cs int) {
+	s.t.record(-1, fmt.Sprintf("ChipSelect %d", cs))
+	s.spi.ChipSelect(cs)
+}
+
+func (s traceSPI) Speed(hz int) {
+	s.t.record(-1, fmt.Sprintf("Speed %d", hz))
+	s.spi.Speed(hz)
+}
+
+func (s traceSPI) Transmit(data ...byte) {
+	s.t.record(-1, "Transmit "+hexBytes(data))
+	s.spi.Transmit(data...)
+}
+
+func (s traceSPI) Exchange(data []byte) {
+	s.t.record(-1, "Exchange "+hexBytes(data))
+	s.spi.Exchange(data)
+}
+
+func (s traceSPI) Close() {
+	s.t.record(-1, "Close")
+	s.spi.Close()
+}
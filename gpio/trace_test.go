@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceWriteVCD(t *testing.T) {
+	tr := NewTrace(NewFake())
+	p17, _ := tr.Pin(17)
+	p4, _ := tr.Pin(4)
+	p22, _ := tr.Pin(22)
+	p18, err := tr.PWMPin(18)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p17.Output()
+	p17.High()
+	p17.Write(Low)
+	p4.Input()
+	p4.Pull(PullUp)
+	p22.High() // its mode isn't known
+	p18.Mode(PWM)
+	p18.Freq(1000)
+	p18.DutyCycle(1, 4)
+	p18.DutyCycleWithPWMMode(3, 4, true)
+	spi, err := tr.SPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spi.Speed(2000000) // 4us a byte
+	spi.Transmit(0x01, 0x3c)
+	p22.Output()
+	p18.Mode(Output)
+
+	// Each call is a microsecond after the previous one
+	for i := range tr.events {
+		tr.events[i].Time = time.Duration(i+1) * time.Microsecond
+	}
+	var buf bytes.Buffer
+	if err := tr.WriteVCD(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "$date ") {
+		t.Fatalf("the file doesn't start with its date:\n%s", got)
+	}
+	got = got[strings.Index(got, "\n")+1:]
+
+	want := `$version github.com/youngkin/gpio $end
+$timescale 1ns $end
+$scope module gpio $end
+$var wire 1 ! gpio17 $end
+$var wire 1 $ gpio18 $end
+$var real 64 % gpio18_duty $end
+$var wire 1 # gpio22 $end
+$var wire 1 " gpio4 $end
+$var wire 8 & spi_mosi $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+x!
+x$
+r0 %
+x#
+x"
+bx &
+$end
+#1000
+0!
+#2000
+1!
+#3000
+0!
+#4000
+z"
+#6000
+x#
+#7000
+x$
+#9000
+r0.25 %
+#10000
+r0.75 %
+#13000
+b00000001 &
+#14000
+1#
+#15000
+0$
+#17000
+b00111100 &
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTraceWriteLog(t *testing.T) {
+	tr := NewTrace(NewFake())
+	p, _ := tr.Pin(17)
+	p.Output()
+	p.Write(High)
+	p.Read()
+	spi, _ := tr.SPI()
+	spi.Exchange([]byte{0xa5})
+	for i := range tr.events {
+		tr.events[i].Time = time.Duration(i+1) * time.Millisecond
+	}
+
+	var buf bytes.Buffer
+	if err := tr.WriteLog(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "0.001000 17 Output\n0.002000 17 Write HIGH\n0.003000 spi Begin\n0.004000 spi Exchange a5\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTraceTimes(t *testing.T) {
+	// Calls made at the same time are given different times, in order
+	tr := NewTrace(NewFake())
+	p, _ := tr.Pin(17)
+	for i := 0; i < 100; i++ {
+		p.High()
+	}
+	events := tr.Events()
+	for i := 1; i < len(events); i++ {
+		if events[i].Time <= events[i-1].Time {
+			t.Fatalf("call %d is at %s, not after call %d at %s", i, events[i].Time, i-1, events[i-1].Time)
+		}
+	}
+}
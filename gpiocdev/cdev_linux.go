@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// OpenChip opens a GPIO character device. 'name' is either a chip's name,
+// e.g., 'gpiochip0', or the path of its device.
+func OpenChip(name string) (*Chip, error) {
+	path := name
+	if !strings.Contains(name, "/") {
+		path = "/dev/" + name
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	var ci chipInfo
+	if err := ioctl(f.Fd(), ioctlChipInfo, unsafe.Pointer(&ci)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s isn't a GPIO character device: %w", path, err)
+	}
+	return newChip(&cdevChip{
+		f:     f,
+		name:  cString(ci.Name[:]),
+		label: cString(ci.Label[:]),
+		lines: int(ci.Lines),
+	}), nil
+}
+
+// cdevChip is a GPIO character device
+type cdevChip struct {
+	f     *os.File
+	name  string
+	label string
+	lines int
+}
+
+func (c *cdevChip) info() (string, string, int) {
+	return c.name, c.label, c.lines
+}
+
+// now returns CLOCK_MONOTONIC's time, the kernel's default event clock
+func (c *cdevChip) now() time.Duration {
+	var ts syscall.Timespec
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0)
+	return time.Duration(ts.Nano())
+}
+
+func (c *cdevChip) lineInfo(offset int) (LineInfo, error) {
+	li := lineInfo{Offset: uint32(offset)}
+	if err := ioctl(c.f.Fd(), ioctlLineInfo, unsafe.Pointer(&li)); err != nil {
+		return LineInfo{}, fmt.Errorf("unable to get line %d's info: %w", offset, err)
+	}
+	return fromLineInfo(&li), nil
+}
+
+func (c *cdevChip) requestLine(offset int, consumer string, cfg LineConfig) (lineDevice, error) {
+	var req lineRequest
+	req.Offsets[0] = uint32(offset)
+	req.NumLines = 1
+	copy(req.Consumer[:maxNameSize-1], consumer)
+	req.Config = toLineConfig(cfg)
+	if err := ioctl(c.f.Fd(), ioctlGetLine, unsafe.Pointer(&req)); err != nil {
+		return nil, err
+	}
+	// A non-blocking descriptor is handled by the runtime's poller, allowing
+	// readEvent to use read deadlines.
+	if err := syscall.SetNonblock(int(req.Fd), true); err != nil {
+		syscall.Close(int(req.Fd))
+		return nil, err
+	}
+	f := os.NewFile(uintptr(req.Fd), fmt.Sprintf("%s line %d", c.name, offset))
+	return &cdevLine{f: f, offset: offset}, nil
+}
+
+func (c *cdevChip) close() error {
+	return c.f.Close()
+}
+
+// cdevLine is a line requested from a GPIO character device
+type cdevLine struct {
+	f      *os.File
+	offset int
+}
+
+// ioctl calls ioctl on the line's descriptor without taking it out of non-blocking mode as f.Fd() would
+func (l *cdevLine) ioctl(req uintptr, arg unsafe.Pointer) error {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if cerr := rc.Control(func(fd uintptr) { err = ioctl(fd, req, arg) }); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func (l *cdevLine) value() (bool, error) {
+	lv := lineValues{Mask: 1}
+	if err := l.ioctl(ioctlGetValues, unsafe.Pointer(&lv)); err != nil {
+		return false, fmt.Errorf("unable to read line %d: %w", l.offset, err)
+	}
+	return lv.Bits&1 != 0, nil
+}
+
+func (l *cdevLine) setValue(v bool) error {
+	lv := lineValues{Mask: 1}
+	if v {
+		lv.Bits = 1
+	}
+	if err := l.ioctl(ioctlSetValues, unsafe.Pointer(&lv)); err != nil {
+		return fmt.Errorf("unable to write line %d: %w", l.offset, err)
+	}
+	return nil
+}
+
+func (l *cdevLine) setConfig(cfg LineConfig) error {
+	lc := toLineConfig(cfg)
+	if err := l.ioctl(ioctlSetConfig, unsafe.Pointer(&lc)); err != nil {
+		return fmt.Errorf("unable to reconfigure line %d: %w", l.offset, err)
+	}
+	return nil
+}
+
+func (l *cdevLine) readEvent(timeout time.Duration) (Event, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := l.f.SetReadDeadline(deadline); err != nil {
+		return Event{}, err
+	}
+	var le lineEvent
+	buf := (*[unsafe.Sizeof(lineEvent{})]byte)(unsafe.Pointer(&le))[:]
+	n, err := l.f.Read(buf)
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return Event{}, ErrTimeout
+	case err != nil:
+		return Event{}, fmt.Errorf("unable to read line %d's events: %w", l.offset, err)
+	case n != len(buf):
+		return Event{}, fmt.Errorf("short read of line %d's events, %d bytes", l.offset, n)
+	}
+	return Event{
+		Offset:    int(le.Offset),
+		Rising:    le.ID == eventRisingEdge,
+		Timestamp: time.Duration(le.Timestamp),
+		Seqno:     le.Seqno,
+	}, nil
+}
+
+func (l *cdevLine) close() error {
+	return l.f.Close()
+}
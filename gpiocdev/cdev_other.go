@@ -0,0 +1,17 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package gpiocdev
+
+import "errors"
+
+// OpenChip opens a GPIO character device, they're only available on Linux
+func OpenChip(name string) (*Chip, error) {
+	return nil, errors.New("GPIO character devices are only available on Linux")
+}
@@ -0,0 +1,317 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// eventBufferSize is the number of events queued per line, the kernel's default
+const eventBufferSize = 16
+
+// FakeChip is a Chip that simulates a GPIO controller, for use when there's no
+// hardware. Inputs are driven with SetInput and outputs are read with Level. Like
+// the kernel it rejects requests for lines that are in use, queues edge events, and
+// debounces inputs, a change is only seen once the line has been steady for the
+// debounce period.
+type FakeChip struct {
+	*Chip
+	dev *fakeChip
+}
+
+// NewFakeChip returns a fake chip named 'name' with 'lines' lines
+func NewFakeChip(name string, lines int) *FakeChip {
+	dev := &fakeChip{
+		name:  name,
+		start: time.Now(),
+		lines: make([]fakeLine, lines),
+	}
+	return &FakeChip{Chip: newChip(dev), dev: dev}
+}
+
+// SetInput drives line 'offset' HIGH if 'high' is true, LOW otherwise, as an
+// external device would. It generates an edge event if the line's requested as an
+// input with edge detection.
+func (fc *FakeChip) SetInput(offset int, high bool) error {
+	if err := fc.checkOffset(offset); err != nil {
+		return err
+	}
+	fc.dev.update(offset, func(l *fakeLine) {
+		l.driven, l.external = true, high
+	})
+	return nil
+}
+
+// ReleaseInput stops driving line 'offset', its level is then set by its bias
+func (fc *FakeChip) ReleaseInput(offset int) error {
+	if err := fc.checkOffset(offset); err != nil {
+		return err
+	}
+	fc.dev.update(offset, func(l *fakeLine) {
+		l.driven = false
+	})
+	return nil
+}
+
+// Level returns true if line 'offset' is physically HIGH
+func (fc *FakeChip) Level(offset int) bool {
+	if fc.checkOffset(offset) != nil {
+		return false
+	}
+	fc.dev.mu.Lock()
+	defer fc.dev.mu.Unlock()
+	return fc.dev.lines[offset].level()
+}
+
+// fakeChip is the chipDevice behind a FakeChip
+type fakeChip struct {
+	name  string
+	start time.Time
+
+	mu    sync.Mutex
+	lines []fakeLine
+}
+
+// fakeLine is the state of one of a fake chip's lines
+type fakeLine struct {
+	consumer string
+	cfg      LineConfig
+	req      *fakeRequest // nil if the line isn't requested
+	driven   bool         // true if driven externally by SetInput
+	external bool         // the externally driven level
+	// debouncing is true when 'stable' is the debounced value of an input, it's
+	// updated when 'settle' fires. 'settles' counts the changes so that a timer
+	// that fires after being replaced is ignored.
+	debouncing bool
+	stable     bool
+	settle     *time.Timer
+	settles    int
+}
+
+// level returns true if the line is physically HIGH
+func (l *fakeLine) level() bool {
+	switch {
+	case l.req != nil && l.cfg.Output:
+		return l.cfg.Value != l.cfg.ActiveLow
+	case l.driven:
+		return l.external
+	default:
+		return l.cfg.Bias == PullUp
+	}
+}
+
+// value returns the line's logical value
+func (l *fakeLine) value() bool {
+	return l.level() != l.cfg.ActiveLow
+}
+
+// reported returns the line's logical value as the program sees it, after debouncing
+func (l *fakeLine) reported() bool {
+	if l.debouncing {
+		return l.stable
+	}
+	return l.value()
+}
+
+// now returns the time since the chip was created, its events' timestamps are
+// relative to then
+func (c *fakeChip) now() time.Duration {
+	return time.Since(c.start)
+}
+
+func (c *fakeChip) info() (string, string, int) {
+	return c.name, "fake", len(c.lines)
+}
+
+func (c *fakeChip) lineInfo(offset int) (LineInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := &c.lines[offset]
+	cfg := l.cfg
+	cfg.Value = false
+	return LineInfo{
+		Offset:   offset,
+		Name:     fmt.Sprintf("GPIO%d", offset),
+		Consumer: l.consumer,
+		Used:     l.req != nil,
+		Config:   cfg,
+	}, nil
+}
+
+func (c *fakeChip) requestLine(offset int, consumer string, cfg LineConfig) (lineDevice, error) {
+	c.mu.Lock()
+	if c.lines[offset].req != nil {
+		c.mu.Unlock()
+		return nil, syscall.EBUSY
+	}
+	req := &fakeRequest{chip: c, offset: offset, events: make(chan Event, eventBufferSize)}
+	c.mu.Unlock()
+	c.update(offset, func(l *fakeLine) {
+		l.req, l.consumer, l.cfg = req, consumer, cfg
+	})
+	return req, nil
+}
+
+func (c *fakeChip) close() error {
+	return nil
+}
+
+// update changes line 'offset' with 'change', queuing an edge event if its value
+// changes because of how it's driven. Like the kernel, requesting or reconfiguring
+// a line doesn't generate events. A debounced input's change is only seen once it's
+// been steady for the debounce period.
+func (c *fakeChip) update(offset int, change func(l *fakeLine)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := &c.lines[offset]
+	before, req, cfg := l.reported(), l.req, l.cfg
+	change(l)
+	if l.settle != nil {
+		l.settle.Stop()
+		l.settle = nil
+	}
+	reconfigured := l.req != req || l.cfg != cfg
+	if l.req == nil || l.cfg.Output || l.cfg.Debounce == 0 {
+		l.debouncing = false
+		if !reconfigured {
+			c.changed(l, before)
+		}
+		return
+	}
+	if reconfigured || !l.debouncing {
+		// The debounced value starts out as the line's value
+		l.stable, l.debouncing = l.value(), true
+		return
+	}
+
+	l.settles++
+	req, settles := l.req, l.settles
+	l.settle = time.AfterFunc(l.cfg.Debounce, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		l := &c.lines[offset]
+		if l.req != req || l.settles != settles || !l.debouncing {
+			return
+		}
+		before := l.stable
+		l.stable, l.settle = l.value(), nil
+		c.changed(l, before)
+	})
+}
+
+// changed queues an edge event if the value 'l' reports has changed from 'before',
+// the chip's lock must be held
+func (c *fakeChip) changed(l *fakeLine, before bool) {
+	after := l.reported()
+	if l.req == nil || l.cfg.Output || before == after {
+		return
+	}
+	edge := l.cfg.Edge
+	if after && (edge == RisingEdge || edge == BothEdges) || !after && (edge == FallingEdge || edge == BothEdges) {
+		l.req.queue(after, c.now())
+	}
+}
+
+// fakeRequest is a line requested from a fake chip
+type fakeRequest struct {
+	chip   *fakeChip
+	offset int
+	seqno  uint32
+	events chan Event
+	closed bool
+}
+
+// queue queues an edge event, dropping it if the queue is full as the kernel does
+func (r *fakeRequest) queue(rising bool, ts time.Duration) {
+	r.seqno++
+	select {
+	case r.events <- Event{Offset: r.offset, Rising: rising, Timestamp: ts, Seqno: r.seqno}:
+	default:
+	}
+}
+
+var errClosed = errors.New("line has been released")
+
+// line returns the request's line, the chip's lock must be held
+func (r *fakeRequest) line() (*fakeLine, error) {
+	if r.closed {
+		return nil, errClosed
+	}
+	return &r.chip.lines[r.offset], nil
+}
+
+func (r *fakeRequest) value() (bool, error) {
+	r.chip.mu.Lock()
+	defer r.chip.mu.Unlock()
+	l, err := r.line()
+	if err != nil {
+		return false, err
+	}
+	return l.reported(), nil
+}
+
+func (r *fakeRequest) setValue(v bool) error {
+	return r.change(func(l *fakeLine) {
+		l.cfg.Value = v
+	})
+}
+
+func (r *fakeRequest) setConfig(cfg LineConfig) error {
+	return r.change(func(l *fakeLine) {
+		l.cfg = cfg
+	})
+}
+
+func (r *fakeRequest) change(change func(l *fakeLine)) error {
+	r.chip.mu.Lock()
+	_, err := r.line()
+	r.chip.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	r.chip.update(r.offset, change)
+	return nil
+}
+
+func (r *fakeRequest) readEvent(timeout time.Duration) (Event, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case e, ok := <-r.events:
+		if !ok {
+			return Event{}, errClosed
+		}
+		return e, nil
+	case <-expired:
+		return Event{}, ErrTimeout
+	}
+}
+
+func (r *fakeRequest) close() error {
+	r.chip.mu.Lock()
+	defer r.chip.mu.Unlock()
+	if r.closed {
+		return errClosed
+	}
+	r.closed = true
+	l := &r.chip.lines[r.offset]
+	l.req, l.consumer, l.debouncing = nil, "", false
+	if l.settle != nil {
+		l.settle.Stop()
+		l.settle = nil
+	}
+	close(r.events)
+	return nil
+}
@@ -0,0 +1,270 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package gpiocdev controls GPIO lines through the Linux GPIO character device,
+// /dev/gpiochipN, using version 2 of its ioctl interface (the uAPI libgpiod v2 is
+// built on, Linux 5.10 and later). Unlike /dev/gpiomem or sysfs it works with any
+// GPIO controller, doesn't need root, and the kernel arbitrates between programs, a
+// line can only be requested by one program at a time.
+//
+// On a Raspberry Pi the 40 pin header's BCM pins are the lines of the same number on
+// gpiochip0 (gpiochip4 on a Pi 5).
+//
+// NewFakeChip returns a chip that doesn't need a GPIO controller for testing. The
+// kernel's gpio-sim module (Linux 5.17 and later) can also be used, its chips are
+// ordinary GPIO character devices.
+package gpiocdev
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bias is a line's pull-up/down resistor setting
+type Bias int
+
+// Biases
+const (
+	BiasAsIs Bias = iota // leave the bias as it is
+	BiasDisabled
+	PullUp
+	PullDown
+)
+
+// Drive is how an output line is driven
+type Drive int
+
+// Drives
+const (
+	PushPull   Drive = iota // driven HIGH and LOW
+	OpenDrain               // driven LOW, floats when HIGH
+	OpenSource              // driven HIGH, floats when LOW
+)
+
+// Edge selects the edges of an input line that generate events
+type Edge int
+
+// Edges
+const (
+	NoEdge Edge = iota
+	RisingEdge
+	FallingEdge
+	BothEdges
+)
+
+// LineConfig is the configuration of a line
+type LineConfig struct {
+	Output    bool          // output if true, otherwise input
+	Value     bool          // an output's initial value
+	ActiveLow bool          // values are inverted, true is LOW
+	Bias      Bias          // pull-up/down resistor
+	Drive     Drive         // output drive, only for outputs
+	Edge      Edge          // edges that generate events, only for inputs
+	Debounce  time.Duration // debounce period, only for inputs, rounded to microseconds
+}
+
+// validate checks for settings the kernel would reject
+func (cfg LineConfig) validate() error {
+	if cfg.Output && (cfg.Edge != NoEdge || cfg.Debounce != 0) {
+		return errors.New("edge detection and debounce are only for inputs")
+	}
+	if !cfg.Output && cfg.Drive != PushPull {
+		return errors.New("open drain and open source are only for outputs")
+	}
+	if cfg.Debounce < 0 {
+		return errors.New("debounce period must not be negative")
+	}
+	return nil
+}
+
+// LineInfo describes a line
+type LineInfo struct {
+	Offset   int
+	Name     string
+	Consumer string // the program using the line, if it's used
+	Used     bool
+	Config   LineConfig // the current configuration, Value isn't reported
+}
+
+// Event is an edge detected on an input line
+type Event struct {
+	Offset    int
+	Rising    bool          // true for a rising edge, false for a falling edge
+	Timestamp time.Duration // from CLOCK_MONOTONIC, i.e., time since boot
+	Seqno     uint32        // the event's sequence number for the request
+}
+
+// ErrTimeout is returned by ReadEvent if no event arrives in time
+var ErrTimeout = errors.New("timed out waiting for an edge event")
+
+// chipDevice is a GPIO controller, the character device or a fake
+type chipDevice interface {
+	info() (name, label string, lines int)
+	lineInfo(offset int) (LineInfo, error)
+	requestLine(offset int, consumer string, cfg LineConfig) (lineDevice, error)
+	now() time.Duration
+	close() error
+}
+
+// lineDevice is a requested line
+type lineDevice interface {
+	value() (bool, error)
+	setValue(v bool) error
+	setConfig(cfg LineConfig) error
+	readEvent(timeout time.Duration) (Event, error)
+	close() error
+}
+
+// Chip is a GPIO controller
+type Chip struct {
+	dev chipDevice
+
+	mu    sync.Mutex
+	lines map[*Line]bool
+}
+
+func newChip(dev chipDevice) *Chip {
+	return &Chip{dev: dev, lines: map[*Line]bool{}}
+}
+
+// Now returns the current time on the clock used for events' timestamps, so that
+// an event's time can be related to the present
+func (c *Chip) Now() time.Duration {
+	return c.dev.now()
+}
+
+// Name returns the chip's name, e.g., 'gpiochip0'
+func (c *Chip) Name() string {
+	name, _, _ := c.dev.info()
+	return name
+}
+
+// Label returns the chip's label, e.g., 'pinctrl-bcm2711'
+func (c *Chip) Label() string {
+	_, label, _ := c.dev.info()
+	return label
+}
+
+// Lines returns the number of lines the chip has
+func (c *Chip) Lines() int {
+	_, _, lines := c.dev.info()
+	return lines
+}
+
+// LineInfo returns information about line 'offset'
+func (c *Chip) LineInfo(offset int) (LineInfo, error) {
+	if err := c.checkOffset(offset); err != nil {
+		return LineInfo{}, err
+	}
+	return c.dev.lineInfo(offset)
+}
+
+// RequestLine requests line 'offset' for the caller's exclusive use. 'consumer'
+// identifies the program using the line.
+func (c *Chip) RequestLine(offset int, consumer string, cfg LineConfig) (*Line, error) {
+	if err := c.checkOffset(offset); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	dev, err := c.dev.requestLine(offset, consumer, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request line %d of %s: %w", offset, c.Name(), err)
+	}
+	l := &Line{chip: c, dev: dev, offset: offset, cfg: cfg}
+	c.mu.Lock()
+	c.lines[l] = true
+	c.mu.Unlock()
+	return l, nil
+}
+
+// Close releases all of the lines requested from the chip and closes it
+func (c *Chip) Close() error {
+	c.mu.Lock()
+	lines := c.lines
+	c.lines = map[*Line]bool{}
+	c.mu.Unlock()
+	for l := range lines {
+		l.dev.close()
+	}
+	return c.dev.close()
+}
+
+func (c *Chip) checkOffset(offset int) error {
+	if offset < 0 || offset >= c.Lines() {
+		return fmt.Errorf("%s has no line %d, it has lines 0 thru %d", c.Name(), offset, c.Lines()-1)
+	}
+	return nil
+}
+
+// Line is a requested line
+type Line struct {
+	chip   *Chip
+	dev    lineDevice
+	offset int
+	cfg    LineConfig
+}
+
+// Offset returns the line's offset on its chip
+func (l *Line) Offset() int {
+	return l.offset
+}
+
+// Config returns the line's configuration
+func (l *Line) Config() LineConfig {
+	return l.cfg
+}
+
+// Value returns the line's value, true is HIGH unless the line is active low
+func (l *Line) Value() (bool, error) {
+	return l.dev.value()
+}
+
+// SetValue sets an output line's value
+func (l *Line) SetValue(v bool) error {
+	if !l.cfg.Output {
+		return fmt.Errorf("line %d is an input", l.offset)
+	}
+	if err := l.dev.setValue(v); err != nil {
+		return err
+	}
+	l.cfg.Value = v
+	return nil
+}
+
+// Reconfigure changes the line's configuration without releasing it
+func (l *Line) Reconfigure(cfg LineConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if err := l.dev.setConfig(cfg); err != nil {
+		return err
+	}
+	l.cfg = cfg
+	return nil
+}
+
+// ReadEvent waits for an edge event on an input line configured with an Edge.
+// Events are queued by the kernel so none are missed between calls, unless the
+// queue overflows. It returns ErrTimeout if there's no event within 'timeout', 0
+// waits forever.
+func (l *Line) ReadEvent(timeout time.Duration) (Event, error) {
+	if l.cfg.Edge == NoEdge {
+		return Event{}, fmt.Errorf("line %d isn't configured for edge events", l.offset)
+	}
+	return l.dev.readEvent(timeout)
+}
+
+// Close releases the line
+func (l *Line) Close() error {
+	l.chip.mu.Lock()
+	delete(l.chip.lines, l)
+	l.chip.mu.Unlock()
+	return l.dev.close()
+}
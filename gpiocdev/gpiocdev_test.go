@@ -0,0 +1,394 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testChip is a chip whose lines a test can drive and read the way an external
+// device would
+type testChip interface {
+	chip() *Chip
+	// drive drives line 'offset' HIGH if 'high' is true, otherwise LOW
+	drive(t *testing.T, offset int, high bool)
+	// level returns true if line 'offset' is physically HIGH
+	level(t *testing.T, offset int) bool
+}
+
+// fakeTestChip is a FakeChip as a testChip
+type fakeTestChip struct {
+	*FakeChip
+}
+
+func newFakeTestChip(t *testing.T, lines int) testChip {
+	return fakeTestChip{NewFakeChip("gpiochip0", lines)}
+}
+
+func (fc fakeTestChip) chip() *Chip {
+	return fc.Chip
+}
+
+func (fc fakeTestChip) drive(t *testing.T, offset int, high bool) {
+	if err := fc.SetInput(offset, high); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (fc fakeTestChip) level(t *testing.T, offset int) bool {
+	return fc.Level(offset)
+}
+
+func TestFakeChip(t *testing.T) {
+	testChips(t, newFakeTestChip)
+}
+
+// testChips runs the tests that apply to any chip, 'newChip' returns a new chip
+// with 'lines' lines for each test
+func testChips(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	t.Run("RequestLine", func(t *testing.T) { testRequestLine(t, newChip) })
+	t.Run("InvalidRequests", func(t *testing.T) { testInvalidRequests(t, newChip) })
+	t.Run("Reconfigure", func(t *testing.T) { testReconfigure(t, newChip) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, newChip) })
+	t.Run("Debounce", func(t *testing.T) { testDebounce(t, newChip) })
+}
+
+func testRequestLine(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	high, low := true, false
+	tests := []struct {
+		name      string
+		cfg       LineConfig
+		drive     *bool // how an input is driven, nil if it isn't
+		wantValue bool
+		wantLevel bool // for outputs, the physical level
+	}{
+		{name: "output high", cfg: LineConfig{Output: true, Value: true}, wantValue: true, wantLevel: true},
+		{name: "output low", cfg: LineConfig{Output: true}, wantValue: false, wantLevel: false},
+		{name: "active low output high", cfg: LineConfig{Output: true, Value: true, ActiveLow: true}, wantValue: true, wantLevel: false},
+		{name: "active low output low", cfg: LineConfig{Output: true, ActiveLow: true}, wantValue: false, wantLevel: true},
+		{name: "input driven high", cfg: LineConfig{}, drive: &high, wantValue: true},
+		{name: "input driven low", cfg: LineConfig{}, drive: &low, wantValue: false},
+		{name: "active low input driven high", cfg: LineConfig{ActiveLow: true}, drive: &high, wantValue: false},
+		{name: "active low input driven low", cfg: LineConfig{ActiveLow: true}, drive: &low, wantValue: true},
+		{name: "pull-up", cfg: LineConfig{Bias: PullUp}, wantValue: true},
+		{name: "pull-down", cfg: LineConfig{Bias: PullDown}, wantValue: false},
+		{name: "active low pull-up", cfg: LineConfig{Bias: PullUp, ActiveLow: true}, wantValue: false},
+		{name: "active low pull-down", cfg: LineConfig{Bias: PullDown, ActiveLow: true}, wantValue: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tchip := newChip(t, 8)
+			c := tchip.chip()
+			if tc.drive != nil {
+				tchip.drive(t, 3, *tc.drive)
+			}
+			l, err := c.RequestLine(3, "gpiocdev-test", tc.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			defer l.Close()
+
+			if v, err := l.Value(); err != nil || v != tc.wantValue {
+				t.Errorf("got value %t, %v, want %t", v, err, tc.wantValue)
+			}
+			if tc.cfg.Output && tchip.level(t, 3) != tc.wantLevel {
+				t.Errorf("got level %t, want %t", tchip.level(t, 3), tc.wantLevel)
+			}
+
+			info, err := c.LineInfo(3)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if !info.Used || info.Consumer != "gpiocdev-test" {
+				t.Errorf("line info shows used %t by %q, want used by %q", info.Used, info.Consumer, "gpiocdev-test")
+			}
+			if info.Config.Output != tc.cfg.Output || info.Config.ActiveLow != tc.cfg.ActiveLow || info.Config.Bias != tc.cfg.Bias {
+				t.Errorf("line info shows config %+v, want %+v", info.Config, tc.cfg)
+			}
+
+			// A line can only be requested once
+			if l2, err := c.RequestLine(3, "gpiocdev-test", tc.cfg); err == nil {
+				l2.Close()
+				t.Error("a line that's in use was requested again")
+			}
+
+			if err := l.Close(); err != nil {
+				t.Errorf("unexpected error closing the line, %s", err)
+			}
+			if info, err := c.LineInfo(3); err != nil || info.Used {
+				t.Errorf("line info shows used %t, %v, after the line was closed", info.Used, err)
+			}
+		})
+	}
+}
+
+func testInvalidRequests(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	tests := []struct {
+		name   string
+		offset int
+		cfg    LineConfig
+	}{
+		{name: "negative offset", offset: -1},
+		{name: "offset past the last line", offset: 8},
+		{name: "output with edge detection", cfg: LineConfig{Output: true, Edge: BothEdges}},
+		{name: "output with debounce", cfg: LineConfig{Output: true, Debounce: time.Millisecond}},
+		{name: "open drain input", cfg: LineConfig{Drive: OpenDrain}},
+		{name: "negative debounce", cfg: LineConfig{Debounce: -time.Millisecond}},
+	}
+
+	c := newChip(t, 8).chip()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if l, err := c.RequestLine(tc.offset, "gpiocdev-test", tc.cfg); err == nil {
+				l.Close()
+				t.Errorf("line %d was requested with %+v", tc.offset, tc.cfg)
+			}
+		})
+	}
+}
+
+func testReconfigure(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	tests := []struct {
+		name      string
+		cfg       LineConfig
+		wantValue bool
+		wantLevel *bool // the physical level if it's known
+	}{
+		{name: "output high", cfg: LineConfig{Output: true, Value: true}, wantValue: true, wantLevel: boolPtr(true)},
+		{name: "active low output high", cfg: LineConfig{Output: true, Value: true, ActiveLow: true}, wantValue: true, wantLevel: boolPtr(false)},
+		{name: "input pull-up", cfg: LineConfig{Bias: PullUp}, wantValue: true, wantLevel: boolPtr(true)},
+		{name: "active low input pull-up", cfg: LineConfig{Bias: PullUp, ActiveLow: true}, wantValue: false, wantLevel: boolPtr(true)},
+		{name: "input pull-down", cfg: LineConfig{Bias: PullDown}, wantValue: false, wantLevel: boolPtr(false)},
+		{name: "output low", cfg: LineConfig{Output: true}, wantValue: false, wantLevel: boolPtr(false)},
+	}
+
+	tchip := newChip(t, 8)
+	l, err := tchip.chip().RequestLine(5, "gpiocdev-test", LineConfig{Output: true, Value: true})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer l.Close()
+
+	// Each configuration follows the one before it, on the same line
+	for _, tc := range tests {
+		if err := l.Reconfigure(tc.cfg); err != nil {
+			t.Fatalf("%s: unexpected error %s", tc.name, err)
+		}
+		if l.Config() != tc.cfg {
+			t.Errorf("%s: Config returned %+v, want %+v", tc.name, l.Config(), tc.cfg)
+		}
+		if v, err := l.Value(); err != nil || v != tc.wantValue {
+			t.Errorf("%s: got value %t, %v, want %t", tc.name, v, err, tc.wantValue)
+		}
+		if tc.wantLevel != nil && tchip.level(t, 5) != *tc.wantLevel {
+			t.Errorf("%s: got level %t, want %t", tc.name, tchip.level(t, 5), *tc.wantLevel)
+		}
+		err := l.SetValue(true)
+		if tc.cfg.Output && err != nil {
+			t.Errorf("%s: unexpected error setting the value, %s", tc.name, err)
+		}
+		if !tc.cfg.Output && err == nil {
+			t.Errorf("%s: an input's value was set", tc.name)
+		}
+		if tc.cfg.Output {
+			if v, _ := l.Value(); !v {
+				t.Errorf("%s: value is false after SetValue(true)", tc.name)
+			}
+		}
+	}
+
+	if err := l.Reconfigure(LineConfig{Output: true, Edge: RisingEdge}); err == nil {
+		t.Error("an output was reconfigured with edge detection")
+	}
+}
+
+func testEvents(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	tests := []struct {
+		name      string
+		cfg       LineConfig
+		drives    []bool // the levels the line is driven to, it starts LOW
+		want      []bool // the events, true for a rising edge
+		wantValue bool
+	}{
+		{
+			name:   "both edges",
+			cfg:    LineConfig{Edge: BothEdges},
+			drives: []bool{true, false, true},
+			want:   []bool{true, false, true},
+		},
+		{
+			name:   "rising edges",
+			cfg:    LineConfig{Edge: RisingEdge},
+			drives: []bool{true, false, true, false},
+			want:   []bool{true, true},
+		},
+		{
+			name:   "falling edges",
+			cfg:    LineConfig{Edge: FallingEdge},
+			drives: []bool{true, false, true, false},
+			want:   []bool{false, false},
+		},
+		{
+			// The edges are of the logical value
+			name:      "active low rising edges",
+			cfg:       LineConfig{Edge: RisingEdge, ActiveLow: true},
+			drives:    []bool{true, false, true},
+			want:      []bool{true},
+			wantValue: false,
+		},
+		{
+			name:   "no change",
+			cfg:    LineConfig{Edge: BothEdges},
+			drives: []bool{false, false},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tchip := newChip(t, 8)
+			c := tchip.chip()
+			tchip.drive(t, 2, false)
+			l, err := c.RequestLine(2, "gpiocdev-test", tc.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			defer l.Close()
+
+			start := c.Now()
+			for _, high := range tc.drives {
+				tchip.drive(t, 2, high)
+				time.Sleep(time.Millisecond)
+			}
+			end := c.Now()
+
+			last := start
+			for i, rising := range tc.want {
+				ev, err := l.ReadEvent(time.Second)
+				if err != nil {
+					t.Fatalf("event %d: unexpected error %s", i, err)
+				}
+				if ev.Offset != 2 || ev.Rising != rising || ev.Seqno != uint32(i+1) {
+					t.Errorf("event %d: got %+v, want offset 2, rising %t, seqno %d", i, ev, rising, i+1)
+				}
+				if ev.Timestamp < last || ev.Timestamp > end {
+					t.Errorf("event %d: timestamp %s isn't between %s and %s", i, ev.Timestamp, last, end)
+				}
+				last = ev.Timestamp
+			}
+			if ev, err := l.ReadEvent(20 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+				t.Errorf("got event %+v, %v, want ErrTimeout", ev, err)
+			}
+			if len(tc.drives) > 0 && tc.cfg.ActiveLow {
+				if v, _ := l.Value(); v != tc.wantValue {
+					t.Errorf("got value %t, want %t", v, tc.wantValue)
+				}
+			}
+		})
+	}
+
+	t.Run("no edge detection", func(t *testing.T) {
+		l, err := newChip(t, 8).chip().RequestLine(2, "gpiocdev-test", LineConfig{})
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		defer l.Close()
+		if _, err := l.ReadEvent(time.Millisecond); err == nil || errors.Is(err, ErrTimeout) {
+			t.Errorf("got %v reading an event from a line without edge detection", err)
+		}
+	})
+}
+
+func testDebounce(t *testing.T, newChip func(t *testing.T, lines int) testChip) {
+	const debounce = 20 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		drives []bool // the levels the line bounces between, it starts LOW
+		want   []bool // the events, true for a rising edge
+	}{
+		{name: "bounces high", drives: []bool{true, false, true, false, true}, want: []bool{true}},
+		{name: "bounces back low", drives: []bool{true, false, true, false}},
+		{name: "clean edge", drives: []bool{true}, want: []bool{true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tchip := newChip(t, 8)
+			c := tchip.chip()
+			tchip.drive(t, 6, false)
+			l, err := c.RequestLine(6, "gpiocdev-test", LineConfig{Edge: BothEdges, Debounce: debounce})
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			defer l.Close()
+
+			// The bounces are much shorter than the debounce period
+			for _, high := range tc.drives {
+				tchip.drive(t, 6, high)
+				time.Sleep(time.Millisecond)
+			}
+			settled := c.Now()
+			if v, _ := l.Value(); v {
+				t.Error("the value changed before the debounce period ended")
+			}
+
+			for i, rising := range tc.want {
+				ev, err := l.ReadEvent(time.Second)
+				if err != nil {
+					t.Fatalf("event %d: unexpected error %s", i, err)
+				}
+				if ev.Rising != rising || ev.Seqno != uint32(i+1) {
+					t.Errorf("event %d: got %+v, want rising %t, seqno %d", i, ev, rising, i+1)
+				}
+				// The event is when the line has been steady for the debounce period
+				if ev.Timestamp < settled+debounce-2*time.Millisecond {
+					t.Errorf("event %d: timestamp %s is less than %s after the last bounce at %s", i, ev.Timestamp, debounce, settled)
+				}
+			}
+			if ev, err := l.ReadEvent(2 * debounce); !errors.Is(err, ErrTimeout) {
+				t.Errorf("got event %+v, %v, want ErrTimeout", ev, err)
+			}
+			want := tc.drives[len(tc.drives)-1]
+			if v, _ := l.Value(); v != want {
+				t.Errorf("got value %t after the debounce period, want %t", v, want)
+			}
+		})
+	}
+}
+
+func TestFakeChipEventOverflow(t *testing.T) {
+	fc := NewFakeChip("gpiochip0", 4)
+	l, err := fc.RequestLine(1, "gpiocdev-test", LineConfig{Edge: BothEdges})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	defer l.Close()
+
+	// Events past the queue's size are dropped, but they're still counted
+	for i := 0; i < eventBufferSize+4; i++ {
+		fc.SetInput(1, i%2 == 0)
+	}
+	for i := 1; i <= eventBufferSize; i++ {
+		if ev, err := l.ReadEvent(time.Second); err != nil || ev.Seqno != uint32(i) {
+			t.Fatalf("got event %+v, %v, want seqno %d", ev, err, i)
+		}
+	}
+	if ev, err := l.ReadEvent(time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got event %+v, %v, want ErrTimeout", ev, err)
+	}
+	fc.SetInput(1, true)
+	if ev, err := l.ReadEvent(time.Second); err != nil || ev.Seqno != eventBufferSize+5 {
+		t.Errorf("got event %+v, %v, want seqno %d, the sequence numbers show the lost events", ev, err, eventBufferSize+5)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+// Pin drives a line with the same methods as a go-rpio Pin, so the demos can use
+// either. The line is requested the first time the pin is used and reconfigured
+// as its mode and pull change. go-rpio's methods don't return errors so Pin's don't
+// either, the first error is kept and returned by Err.
+type Pin struct {
+	chip     *Chip
+	offset   int
+	consumer string
+	cfg      LineConfig
+	line     *Line
+	err      error
+}
+
+// Pin returns line 'offset' as a Pin, 'consumer' identifies the program using it
+func (c *Chip) Pin(offset int, consumer string) *Pin {
+	return &Pin{chip: c, offset: offset, consumer: consumer}
+}
+
+// Output sets the pin to output mode
+func (p *Pin) Output() {
+	cfg := p.cfg
+	cfg.Output, cfg.Edge, cfg.Debounce = true, NoEdge, 0
+	p.configure(cfg)
+}
+
+// Input sets the pin to input mode
+func (p *Pin) Input() {
+	cfg := p.cfg
+	cfg.Output, cfg.Drive = false, PushPull
+	p.configure(cfg)
+}
+
+// High sets the pin HIGH, it's set to output mode if need be
+func (p *Pin) High() {
+	p.write(true)
+}
+
+// Low sets the pin LOW, it's set to output mode if need be
+func (p *Pin) Low() {
+	p.write(false)
+}
+
+// Read returns the pin's level, 1 for HIGH and 0 for LOW. An unused pin is
+// requested as an input.
+func (p *Pin) Read() uint8 {
+	if p.line == nil {
+		p.configure(p.cfg)
+	}
+	if p.line == nil {
+		return 0
+	}
+	v, err := p.line.Value()
+	p.setErr(err)
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// PullUp enables the pin's pull-up resistor
+func (p *Pin) PullUp() {
+	p.pull(PullUp)
+}
+
+// PullDown enables the pin's pull-down resistor
+func (p *Pin) PullDown() {
+	p.pull(PullDown)
+}
+
+// PullOff disables the pin's pull-up/down resistor
+func (p *Pin) PullOff() {
+	p.pull(BiasDisabled)
+}
+
+// Err returns the first error the pin encountered, if any
+func (p *Pin) Err() error {
+	return p.err
+}
+
+// Close releases the pin's line
+func (p *Pin) Close() error {
+	if p.line == nil {
+		return nil
+	}
+	err := p.line.Close()
+	p.line = nil
+	return err
+}
+
+func (p *Pin) pull(b Bias) {
+	cfg := p.cfg
+	cfg.Bias = b
+	p.configure(cfg)
+}
+
+func (p *Pin) write(v bool) {
+	if !p.cfg.Output || p.line == nil {
+		cfg := p.cfg
+		cfg.Output, cfg.Value, cfg.Edge, cfg.Debounce = true, v, NoEdge, 0
+		p.configure(cfg)
+		return
+	}
+	p.setErr(p.line.SetValue(v))
+	p.cfg.Value = v
+}
+
+// configure requests the line with 'cfg', or reconfigures it if it's already been requested
+func (p *Pin) configure(cfg LineConfig) {
+	var err error
+	if p.line == nil {
+		p.line, err = p.chip.RequestLine(p.offset, p.consumer, cfg)
+	} else {
+		err = p.line.Reconfigure(cfg)
+	}
+	if err != nil {
+		p.setErr(err)
+		return
+	}
+	p.cfg = cfg
+}
+
+func (p *Pin) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// simConfig is where gpio-sim chips are created, with configfs
+const simConfig = "/sys/kernel/config/gpio-sim"
+
+// simChips counts the gpio-sim chips created, to give each a unique name
+var simChips int32
+
+// simTestChip is a chip created with the kernel's gpio-sim module. Its lines are
+// driven, as if by a pull-up or pull-down resistor, and read through sysfs.
+type simTestChip struct {
+	c     *Chip
+	sysfs string // the chip's sysfs directory
+}
+
+// newSimTestChip creates a gpio-sim chip with 'lines' lines, which is removed at the
+// end of the test. The test is skipped if the chip can't be created, e.g., because
+// the test isn't run as root.
+func newSimTestChip(t *testing.T, lines int) testChip {
+	dir := filepath.Join(simConfig, fmt.Sprintf("gpiocdev-test-%d-%d", os.Getpid(), atomic.AddInt32(&simChips, 1)))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Skipf("unable to create a gpio-sim chip, %s", err)
+	}
+	bank := filepath.Join(dir, "gpio-bank0")
+	t.Cleanup(func() {
+		ioutil.WriteFile(filepath.Join(dir, "live"), []byte("0"), 0644)
+		os.Remove(bank)
+		os.Remove(dir)
+	})
+	if err := os.Mkdir(bank, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeAttr(t, filepath.Join(bank, "num_lines"), strconv.Itoa(lines))
+	writeAttr(t, filepath.Join(dir, "live"), "1")
+
+	chipName := readAttr(t, filepath.Join(bank, "chip_name"))
+	devName := readAttr(t, filepath.Join(dir, "dev_name"))
+	c, err := OpenChip(chipName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The chip is closed before it's removed
+	t.Cleanup(func() { c.Close() })
+	return simTestChip{c: c, sysfs: filepath.Join("/sys/devices/platform", devName, chipName)}
+}
+
+func (sc simTestChip) chip() *Chip {
+	return sc.c
+}
+
+func (sc simTestChip) drive(t *testing.T, offset int, high bool) {
+	pull := "pull-down"
+	if high {
+		pull = "pull-up"
+	}
+	writeAttr(t, filepath.Join(sc.sysfs, fmt.Sprintf("sim_gpio%d", offset), "pull"), pull)
+}
+
+func (sc simTestChip) level(t *testing.T, offset int) bool {
+	return readAttr(t, filepath.Join(sc.sysfs, fmt.Sprintf("sim_gpio%d", offset), "value")) == "1"
+}
+
+func writeAttr(t *testing.T, path, value string) {
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readAttr(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestSimChip(t *testing.T) {
+	if _, err := os.Stat("/sys/module/gpio_sim"); err != nil {
+		t.Skip("the gpio-sim module isn't loaded, 'sudo modprobe gpio-sim' loads it")
+	}
+	if _, err := os.Stat(simConfig); err != nil {
+		t.Skipf("%s doesn't exist, is configfs mounted?", simConfig)
+	}
+	testChips(t, newSimTestChip)
+}
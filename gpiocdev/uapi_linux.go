@@ -0,0 +1,271 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package gpiocdev
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The structures and ioctls below mirror version 2 of the GPIO character device
+// uAPI, see include/uapi/linux/gpio.h in the kernel source.
+
+const (
+	maxNameSize = 32 // GPIO_MAX_NAME_SIZE
+	maxLines    = 64 // GPIO_V2_LINES_MAX
+	maxAttrs    = 10 // GPIO_V2_LINE_NUM_ATTRS_MAX
+)
+
+// Line flags, enum gpio_v2_line_flag
+const (
+	flagUsed               = 1 << 0
+	flagActiveLow          = 1 << 1
+	flagInput              = 1 << 2
+	flagOutput             = 1 << 3
+	flagEdgeRising         = 1 << 4
+	flagEdgeFalling        = 1 << 5
+	flagOpenDrain          = 1 << 6
+	flagOpenSource         = 1 << 7
+	flagBiasPullUp         = 1 << 8
+	flagBiasPullDown       = 1 << 9
+	flagBiasDisabled       = 1 << 10
+	flagEventClockRealtime = 1 << 11
+)
+
+// Line attribute ids, enum gpio_v2_line_attr_id
+const (
+	attrFlags        = 1
+	attrOutputValues = 2
+	attrDebounce     = 3
+)
+
+// clockMonotonic is CLOCK_MONOTONIC's id, the clock events are timestamped with
+// unless flagEventClockRealtime is set
+const clockMonotonic = 1
+
+// Event ids, enum gpio_v2_line_event_id
+const (
+	eventRisingEdge  = 1
+	eventFallingEdge = 2
+)
+
+// struct gpiochip_info
+type chipInfo struct {
+	Name  [maxNameSize]byte
+	Label [maxNameSize]byte
+	Lines uint32
+}
+
+// struct gpio_v2_line_values
+type lineValues struct {
+	Bits uint64
+	Mask uint64
+}
+
+// struct gpio_v2_line_attribute, Value is a union of the flags, the output values
+// and the debounce period.
+type lineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   uint64
+}
+
+// debounce returns the debounce period in microseconds, the union's first 32 bits
+func (a *lineAttribute) debounce() uint32 {
+	return *(*uint32)(unsafe.Pointer(&a.Value))
+}
+
+func (a *lineAttribute) setDebounce(us uint32) {
+	a.Value = 0
+	*(*uint32)(unsafe.Pointer(&a.Value)) = us
+}
+
+// struct gpio_v2_line_config_attribute
+type lineConfigAttribute struct {
+	Attr lineAttribute
+	Mask uint64
+}
+
+// struct gpio_v2_line_config
+type lineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [maxAttrs]lineConfigAttribute
+}
+
+// struct gpio_v2_line_request
+type lineRequest struct {
+	Offsets         [maxLines]uint32
+	Consumer        [maxNameSize]byte
+	Config          lineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+// struct gpio_v2_line_info
+type lineInfo struct {
+	Name     [maxNameSize]byte
+	Consumer [maxNameSize]byte
+	Offset   uint32
+	NumAttrs uint32
+	Flags    uint64
+	Attrs    [maxAttrs]lineAttribute
+	Padding  [4]uint32
+}
+
+// struct gpio_v2_line_event
+type lineEvent struct {
+	Timestamp uint64
+	ID        uint32
+	Offset    uint32
+	Seqno     uint32
+	LineSeqno uint32
+	Padding   [6]uint32
+}
+
+// The compiler rejects these if a structure's size doesn't match the kernel's
+var (
+	_ = [1]struct{}{}[unsafe.Sizeof(chipInfo{})-68]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineValues{})-16]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineAttribute{})-16]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineConfigAttribute{})-24]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineConfig{})-272]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineRequest{})-592]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineInfo{})-256]
+	_ = [1]struct{}{}[unsafe.Sizeof(lineEvent{})-48]
+)
+
+// ioctl request numbers, _IOR(0xB4, nr, size) and _IOWR(0xB4, nr, size)
+func ior(nr, size uintptr) uintptr  { return 2<<30 | size<<16 | 0xB4<<8 | nr }
+func iowr(nr, size uintptr) uintptr { return 3<<30 | size<<16 | 0xB4<<8 | nr }
+
+var (
+	ioctlChipInfo  = ior(0x01, unsafe.Sizeof(chipInfo{}))
+	ioctlLineInfo  = iowr(0x05, unsafe.Sizeof(lineInfo{}))
+	ioctlGetLine   = iowr(0x07, unsafe.Sizeof(lineRequest{}))
+	ioctlSetConfig = iowr(0x0D, unsafe.Sizeof(lineConfig{}))
+	ioctlGetValues = iowr(0x0E, unsafe.Sizeof(lineValues{}))
+	ioctlSetValues = iowr(0x0F, unsafe.Sizeof(lineValues{}))
+)
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+		switch errno {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		default:
+			return errno
+		}
+	}
+}
+
+// toLineConfig converts 'cfg' to the kernel's line configuration
+func toLineConfig(cfg LineConfig) lineConfig {
+	var lc lineConfig
+	if cfg.Output {
+		lc.Flags |= flagOutput
+		a := &lc.Attrs[lc.NumAttrs]
+		a.Attr.ID = attrOutputValues
+		if cfg.Value {
+			a.Attr.Value = 1
+		}
+		a.Mask = 1
+		lc.NumAttrs++
+	} else {
+		lc.Flags |= flagInput
+	}
+	if cfg.ActiveLow {
+		lc.Flags |= flagActiveLow
+	}
+	switch cfg.Bias {
+	case BiasDisabled:
+		lc.Flags |= flagBiasDisabled
+	case PullUp:
+		lc.Flags |= flagBiasPullUp
+	case PullDown:
+		lc.Flags |= flagBiasPullDown
+	}
+	switch cfg.Drive {
+	case OpenDrain:
+		lc.Flags |= flagOpenDrain
+	case OpenSource:
+		lc.Flags |= flagOpenSource
+	}
+	if cfg.Edge == RisingEdge || cfg.Edge == BothEdges {
+		lc.Flags |= flagEdgeRising
+	}
+	if cfg.Edge == FallingEdge || cfg.Edge == BothEdges {
+		lc.Flags |= flagEdgeFalling
+	}
+	if cfg.Debounce > 0 {
+		a := &lc.Attrs[lc.NumAttrs]
+		a.Attr.ID = attrDebounce
+		a.Attr.setDebounce(uint32(cfg.Debounce.Microseconds()))
+		a.Mask = 1
+		lc.NumAttrs++
+	}
+	return lc
+}
+
+// fromLineInfo converts the kernel's line information
+func fromLineInfo(li *lineInfo) LineInfo {
+	info := LineInfo{
+		Offset:   int(li.Offset),
+		Name:     cString(li.Name[:]),
+		Consumer: cString(li.Consumer[:]),
+		Used:     li.Flags&flagUsed != 0,
+	}
+	cfg := &info.Config
+	cfg.Output = li.Flags&flagOutput != 0
+	cfg.ActiveLow = li.Flags&flagActiveLow != 0
+	switch {
+	case li.Flags&flagBiasDisabled != 0:
+		cfg.Bias = BiasDisabled
+	case li.Flags&flagBiasPullUp != 0:
+		cfg.Bias = PullUp
+	case li.Flags&flagBiasPullDown != 0:
+		cfg.Bias = PullDown
+	}
+	switch {
+	case li.Flags&flagOpenDrain != 0:
+		cfg.Drive = OpenDrain
+	case li.Flags&flagOpenSource != 0:
+		cfg.Drive = OpenSource
+	}
+	rising, falling := li.Flags&flagEdgeRising != 0, li.Flags&flagEdgeFalling != 0
+	switch {
+	case rising && falling:
+		cfg.Edge = BothEdges
+	case rising:
+		cfg.Edge = RisingEdge
+	case falling:
+		cfg.Edge = FallingEdge
+	}
+	for i := 0; i < int(li.NumAttrs) && i < maxAttrs; i++ {
+		if li.Attrs[i].ID == attrDebounce {
+			cfg.Debounce = time.Duration(li.Attrs[i].debounce()) * time.Microsecond
+		}
+	}
+	return info
+}
+
+// cString returns the NUL terminated string in 'b'
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
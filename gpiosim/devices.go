@@ -0,0 +1,289 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// device is a virtual device wired to the simulated board
+type device interface {
+	// title is the device's name, shown in its box's border
+	title() string
+	// height is the number of lines needed to draw the device
+	height() int
+	// attach wires the device to 's', before the program's calls are replayed
+	attach(s *gpio.Sim)
+	// draw returns the device's current appearance, including color tags
+	draw(s *gpio.Sim) string
+}
+
+// brightness returns how bright an LED attached to BCM pin 'bcm' is, 0 thru 1.
+// An LED is only lit by a pin that's driven, OUTPUT or PWM. If 'activeLow' is true
+// the LED is lit when the pin is LOW, it's wired between the pin and 3.3V.
+func brightness(s *gpio.Sim, bcm int, activeLow bool) float64 {
+	ps := s.State(bcm)
+	if ps.Mode != gpio.Output && ps.Mode != gpio.PWM {
+		return 0
+	}
+	if activeLow {
+		return 1 - ps.Duty
+	}
+	return ps.Duty
+}
+
+// shade returns a color tag for 'color', [r, g, b] 0 thru 255, dimmed to 'b'. An unlit
+// LED is drawn dark rather than black so it can still be seen.
+func shade(color [3]float64, b float64) string {
+	const unlit = 0.2
+	b = unlit + (1-unlit)*b
+	return fmt.Sprintf("[#%02x%02x%02x]", int(color[0]*b), int(color[1]*b), int(color[2]*b))
+}
+
+var red = [3]float64{255, 0, 0}
+
+// led is a single LED, e.g., ledblink's LED on BCM 17
+type led struct {
+	bcm       int
+	activeLow bool
+}
+
+func (l led) title() string {
+	return fmt.Sprintf("LED (BCM %d)", l.bcm)
+}
+
+func (l led) height() int {
+	return 1
+}
+
+func (l led) attach(s *gpio.Sim) {}
+
+func (l led) draw(s *gpio.Sim) string {
+	b := brightness(s, l.bcm, l.activeLow)
+	return fmt.Sprintf(" %s●●●[-] %3.0f%%", shade(red, b), b*100)
+}
+
+// barGraph is a 10 segment LED bar graph, e.g., ledbargraph's
+type barGraph struct {
+	pins      []int // bottom segment first
+	activeLow bool
+}
+
+func (g barGraph) title() string {
+	return "LED bar graph"
+}
+
+func (g barGraph) height() int {
+	return 2
+}
+
+func (g barGraph) attach(s *gpio.Sim) {}
+
+func (g barGraph) draw(s *gpio.Sim) string {
+	var bar, labels strings.Builder
+	for _, bcm := range g.pins {
+		fmt.Fprintf(&bar, " %s██[-]", shade(red, brightness(s, bcm, g.activeLow)))
+		fmt.Fprintf(&labels, " %2d", bcm)
+	}
+	return bar.String() + "\n[gray]" + labels.String() + "[-]"
+}
+
+// rgbLED is an RGB LED driven by PWM, e.g., rgbled's
+type rgbLED struct {
+	pins  [3]int // red, green, and blue
+	anode bool   // true for a common anode LED, lit when its pins are LOW
+}
+
+func (l rgbLED) title() string {
+	return fmt.Sprintf("RGB LED (%d,%d,%d)", l.pins[0], l.pins[1], l.pins[2])
+}
+
+func (l rgbLED) height() int {
+	return 2
+}
+
+func (l rgbLED) attach(s *gpio.Sim) {}
+
+func (l rgbLED) draw(s *gpio.Sim) string {
+	var c [3]float64
+	for i, bcm := range l.pins {
+		c[i] = brightness(s, bcm, l.anode)
+	}
+	color := fmt.Sprintf("[#%02x%02x%02x]", int(c[0]*255), int(c[1]*255), int(c[2]*255))
+	return fmt.Sprintf(" %s██████[-] R %3.0f%%\n %s██████[-] G %3.0f%%  B %3.0f%%",
+		color, c[0]*100, color, c[1]*100, c[2]*100)
+}
+
+// hc595 is a 74HC595 shift register driving a common cathode seven segment
+// display, e.g., sevensegdisplay's. Output Q0 drives segment a, thru Q6 driving
+// segment g, and Q7 drives the decimal point.
+type hc595 struct {
+	ser, srclk, rclk, srclr, oe int
+
+	mu      sync.Mutex
+	levels  map[int]gpio.State // the levels of the pins above
+	shift   byte               // the shift register
+	storage byte               // the storage (output) register
+}
+
+func newHC595(ser, srclk, rclk, srclr, oe int) *hc595 {
+	return &hc595{ser: ser, srclk: srclk, rclk: rclk, srclr: srclr, oe: oe, levels: map[int]gpio.State{}}
+}
+
+func (r *hc595) title() string {
+	return fmt.Sprintf("74HC595 (SER %d)", r.ser)
+}
+
+func (r *hc595) height() int {
+	return 6
+}
+
+func (r *hc595) attach(s *gpio.Sim) {
+	for _, bcm := range []int{r.ser, r.srclk, r.rclk, r.srclr, r.oe} {
+		r.levels[bcm] = s.State(bcm).Level
+	}
+	s.Watch(r.pinChanged)
+}
+
+// pinChanged clocks the shift register. Data is shifted in on SRCLK's rising edge
+// and copied to the storage register on RCLK's. SRCLR clears the shift register
+// while it's LOW.
+func (r *hc595) pinChanged(bcm int, level gpio.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.levels[bcm]; !ok {
+		return
+	}
+	r.levels[bcm] = level
+	switch {
+	case bcm == r.srclr && level == gpio.Low:
+		r.shift = 0
+	case bcm == r.srclk && level == gpio.High && r.levels[r.srclr] == gpio.High:
+		r.shift = r.shift<<1 | byte(r.levels[r.ser])
+	case bcm == r.rclk && level == gpio.High:
+		r.storage = r.shift
+	}
+}
+
+func (r *hc595) draw(s *gpio.Sim) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out byte
+	// The outputs are enabled while OE is LOW
+	if r.levels[r.oe] == gpio.Low {
+		out = r.storage
+	}
+	seg := func(bit uint, on string) string {
+		if out&(1<<bit) == 0 {
+			return "[#333333]" + on + "[-]"
+		}
+		return "[red]" + on + "[-]"
+	}
+	// Segments a thru g and the decimal point are bits 0 thru 7
+	return fmt.Sprintf("  %s\n %s     %s\n  %s\n %s     %s\n  %s %s\n[gray] shift %08b  storage %08b[-]",
+		seg(0, "━━━━━"),
+		seg(5, "┃"), seg(1, "┃"),
+		seg(6, "━━━━━"),
+		seg(4, "┃"), seg(2, "┃"),
+		seg(3, "━━━━━"), seg(7, "●"),
+		r.shift, r.storage)
+}
+
+// max7219 is a MAX7219 driving an 8x8 LED matrix, e.g., ledmatrixspi's. It's
+// attached to the simulated board's SPI0 bus.
+type max7219 struct {
+	cs int // the chip select, 0 or 1
+
+	mu        sync.Mutex
+	in        []byte // the bytes received since the chip was selected
+	rows      [8]byte
+	intensity byte
+	scanLimit byte
+	normal    bool // false while in shutdown mode, as at power on
+	test      bool // display test mode lights every LED
+}
+
+func (m *max7219) title() string {
+	return fmt.Sprintf("MAX7219 (CE%d)", m.cs)
+}
+
+func (m *max7219) height() int {
+	return 9
+}
+
+func (m *max7219) attach(s *gpio.Sim) {
+	s.AttachSPI(m.cs, m)
+}
+
+func (m *max7219) Select() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.in = m.in[:0]
+}
+
+func (m *max7219) Transfer(b byte) byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.in = append(m.in, b)
+	return 0
+}
+
+// Deselect latches the last 16 bits received, a register address and its data
+func (m *max7219) Deselect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.in) < 2 {
+		return
+	}
+	addr, data := m.in[len(m.in)-2]&0x0f, m.in[len(m.in)-1]
+	switch {
+	case addr >= 0x01 && addr <= 0x08:
+		m.rows[addr-1] = data
+	case addr == 0x0a:
+		m.intensity = data & 0x0f
+	case addr == 0x0b:
+		m.scanLimit = data & 0x07
+	case addr == 0x0c:
+		m.normal = data&0x01 != 0
+	case addr == 0x0f:
+		m.test = data&0x01 != 0
+	}
+	// The decode mode register (0x09) only affects 7 segment displays
+}
+
+func (m *max7219) draw(s *gpio.Sim) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Even the lowest intensity is clearly lit
+	lit := shade(red, 0.4+0.6*float64(m.intensity)/15)
+	var sb strings.Builder
+	for r, row := range m.rows {
+		sb.WriteString(" ")
+		for c := 0; c < 8; c++ {
+			on := m.test || m.normal && r <= int(m.scanLimit) && row&(0x80>>c) != 0
+			if on {
+				sb.WriteString(lit + "● [-]")
+			} else {
+				sb.WriteString("[#333333]● [-]")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	mode := "normal"
+	switch {
+	case m.test:
+		mode = "display test"
+	case !m.normal:
+		mode = "shutdown"
+	}
+	fmt.Fprintf(&sb, "[gray] %s, intensity %d/15[-]", mode, m.intensity)
+	return sb.String()
+}
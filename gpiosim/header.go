@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// Power and ground header pins, GPIO pins are their BCM number
+const (
+	power3V3 = -iota - 1
+	power5V
+	ground
+)
+
+// header maps the 40 pin header's physical pins, 1 thru 40, to BCM pin numbers
+var header = [40]int{
+	power3V3, power5V,
+	2, power5V,
+	3, ground,
+	4, 14,
+	ground, 15,
+	17, 18,
+	27, ground,
+	22, 23,
+	power3V3, 24,
+	10, ground,
+	9, 25,
+	11, 8,
+	ground, 7,
+	0, 1,
+	5, ground,
+	6, 12,
+	13, ground,
+	19, 16,
+	26, 20,
+	ground, 21,
+}
+
+// drawHeader returns the header's pins in two columns, odd pins on the left and
+// even pins on the right as on the board, with the GPIO pins' modes and levels
+func drawHeader(s *gpio.Sim) string {
+	var sb strings.Builder
+	for phys := 1; phys < len(header); phys += 2 {
+		left, right := pinColumns(s, header[phys-1]), pinColumns(s, header[phys])
+		fmt.Fprintf(&sb, "%s %s %s [white]%2d[-] %s %s [white]%-2d[-] %s %s %s\n",
+			left.mode, left.level, left.name, phys, left.dot,
+			right.dot, phys+1, right.name, right.level, right.mode)
+	}
+	return sb.String()
+}
+
+// columns are a header pin's columns, padded and colored
+type columns struct {
+	mode, level, name, dot string
+}
+
+// pinColumns returns the columns for header pin 'bcm', a BCM number or a power or
+// ground pin
+func pinColumns(s *gpio.Sim, bcm int) columns {
+	switch bcm {
+	case power3V3:
+		return columns{blank(8), blank(4), color("orange", "%-6s", "3V3"), "[orange]■[-]"}
+	case power5V:
+		return columns{blank(8), blank(4), color("red", "%-6s", "5V"), "[red]■[-]"}
+	case ground:
+		return columns{blank(8), blank(4), color("gray", "%-6s", "GND"), "[gray]■[-]"}
+	}
+
+	ps := s.State(bcm)
+	name := fmt.Sprintf("GPIO%d", bcm)
+	if !ps.Used {
+		return columns{blank(8), blank(4), color("gray", "%-6s", name), "[gray]○[-]"}
+	}
+
+	mode := ps.Mode.String()
+	if ps.Mode == gpio.PWM {
+		mode = fmt.Sprintf("PWM %.0f%%", ps.Duty*100)
+	}
+	c := columns{
+		mode: color("teal", "%-8s", mode),
+		name: color("white", "%-6s", name),
+	}
+	if ps.Level == gpio.High {
+		c.level, c.dot = color("red", "%-4s", "HIGH"), "[red]●[-]"
+	} else {
+		c.level, c.dot = color("blue", "%-4s", "LOW"), "[blue]●[-]"
+	}
+	return c
+}
+
+// color formats 'a' with 'format' in color 'c'. The text is padded before the color
+// tags are added so that the tags don't count towards its width.
+func color(c, format string, a ...interface{}) string {
+	return "[" + c + "]" + fmt.Sprintf(format, a...) + "[-]"
+}
+
+func blank(width int) string {
+	return strings.Repeat(" ", width)
+}
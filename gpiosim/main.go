@@ -0,0 +1,327 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// gpiosim shows a simulated Raspberry Pi, so the demos can be run on a laptop. Start
+// it in one terminal and run a demo with '-backend=sim' in another, e.g.,
+//
+//	go run ./gpiosim
+//	cd sevensegdisplay && go run sevensegdisplay.go -backend=sim
+//
+// The demo sends every call it makes to gpiosim, which replays them on its own
+// simulated board. The 40 pin header is shown with each pin's mode and level, along
+// with virtual devices wired as the demos expect: an LED, the LED bar graph, an RGB
+// LED, a 74HC595 shift register driving a seven segment display, and a MAX7219 LED
+// matrix. The devices share pins, as they would if they were all wired to one Pi, and
+// they can be rewired or removed with flags, e.g., '-rgb=""' removes the RGB LED.
+//
+// gpiosim listens on $GPIOSIM_SOCKET, or gpiosim.sock in the temporary directory.
+// The most recently started demo is shown, its final state remains on the screen
+// after it exits. Press 'q' to quit.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/youngkin/gpio/gpio"
+)
+
+// wiring is how the virtual devices are wired to the board, a device is left
+// out if its pins are ""
+type wiring struct {
+	led       string // BCM pin
+	barGraph  string // comma separated BCM pins, bottom segment first
+	activeLow bool   // the LED and bar graph are lit when their pins are LOW
+	rgb       string // comma separated red, green, and blue BCM pins
+	anode     bool   // the RGB LED is common anode, lit when its pins are LOW
+	hc595     string // comma separated SER, SRCLK, RCLK, SRCLR, and OE BCM pins
+	max7219   string // the MAX7219's chip select, 0 or 1
+}
+
+// devices returns new devices wired as described by 'w'
+func (w wiring) devices() ([]device, error) {
+	var devs []device
+	if w.led != "" {
+		pins, err := parsePins(w.led, 1)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -led, %s", err)
+		}
+		devs = append(devs, led{bcm: pins[0], activeLow: w.activeLow})
+	}
+	if w.barGraph != "" {
+		pins, err := parsePins(w.barGraph, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -bargraph, %s", err)
+		}
+		devs = append(devs, barGraph{pins: pins, activeLow: w.activeLow})
+	}
+	if w.rgb != "" {
+		pins, err := parsePins(w.rgb, 3)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -rgb, %s", err)
+		}
+		devs = append(devs, rgbLED{pins: [3]int{pins[0], pins[1], pins[2]}, anode: w.anode})
+	}
+	if w.hc595 != "" {
+		pins, err := parsePins(w.hc595, 5)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -hc595, %s", err)
+		}
+		devs = append(devs, newHC595(pins[0], pins[1], pins[2], pins[3], pins[4]))
+	}
+	if w.max7219 != "" {
+		cs, err := strconv.Atoi(w.max7219)
+		if err != nil || cs < 0 || cs > 1 {
+			return nil, fmt.Errorf("invalid -max7219 %q, must be 0 or 1", w.max7219)
+		}
+		devs = append(devs, &max7219{cs: cs})
+	}
+	return devs, nil
+}
+
+// parsePins parses a comma separated list of BCM pins, there must be 'n' of them
+// unless 'n' is 0
+func parsePins(list string, n int) ([]int, error) {
+	var pins []int
+	for _, f := range strings.Split(list, ",") {
+		bcm, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin %q", f)
+		}
+		if bcm < 0 || bcm >= gpio.HeaderPins {
+			return nil, fmt.Errorf("BCM pin %d isn't on the 40 pin header, must be 0 thru %d", bcm, gpio.HeaderPins-1)
+		}
+		pins = append(pins, bcm)
+	}
+	if n > 0 && len(pins) != n {
+		return nil, fmt.Errorf("%q must be %d comma separated pins", list, n)
+	}
+	return pins, nil
+}
+
+// session is a demo's connection, replayed on its own simulated board
+type session struct {
+	sim     *gpio.Sim
+	devices []device
+
+	mu        sync.Mutex
+	program   string // the demo's name and process id
+	calls     int
+	lastErr   error
+	connected bool
+}
+
+// viewer shows the current session
+type viewer struct {
+	app     *tview.Application
+	header  *tview.TextView
+	views   []*tview.TextView // one per device
+	status  *tview.TextView
+	wiring  wiring
+	changed chan struct{}
+
+	mu      sync.Mutex
+	current *session
+}
+
+func main() {
+	var w wiring
+	socket := flag.String("socket", gpio.SimSocket(), "Unix socket the demos connect to")
+	flag.StringVar(&w.led, "led", "17", "BCM pin of the LED")
+	flag.StringVar(&w.barGraph, "bargraph", "17,18,27,22,23,24,25,2,3,8", "comma separated BCM pins of the LED bar graph, bottom segment first")
+	active := flag.String("active", "low", "level that lights the LED and the bar graph's segments, 'low' or 'high'")
+	flag.StringVar(&w.rgb, "rgb", "19,18,13", "comma separated BCM pins of the RGB LED's red, green, and blue")
+	polarity := flag.String("polarity", "cathode", "RGB LED type, common 'cathode' or common 'anode'")
+	flag.StringVar(&w.hc595, "hc595", "17,27,18,19,21", "comma separated BCM pins of the 74HC595's SER, SRCLK, RCLK, SRCLR, and OE")
+	flag.StringVar(&w.max7219, "max7219", "0", "SPI0 chip select of the MAX7219, 0 or 1")
+	flag.Parse()
+
+	switch *active {
+	case "low", "high":
+		w.activeLow = *active == "low"
+	default:
+		fmt.Printf("invalid -active %q, must be 'low' or 'high'\n", *active)
+		os.Exit(1)
+	}
+	switch *polarity {
+	case "cathode", "anode":
+		w.anode = *polarity == "anode"
+	default:
+		fmt.Printf("invalid -polarity %q, must be 'cathode' or 'anode'\n", *polarity)
+		os.Exit(1)
+	}
+	// Check the wiring before taking over the terminal
+	devs, err := w.devices()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// A socket left behind by a gpiosim that crashed would stop us listening
+	if fi, err := os.Stat(*socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(*socket)
+	}
+	ln, err := net.Listen("unix", *socket)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Closing the listener removes the socket
+	defer ln.Close()
+
+	v := newViewer(w, devs)
+	go v.accept(ln)
+	go v.redraw()
+	if err := v.app.Run(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func newViewer(w wiring, devs []device) *viewer {
+	v := &viewer{
+		app:     tview.NewApplication(),
+		header:  tview.NewTextView().SetDynamicColors(true),
+		status:  tview.NewTextView().SetDynamicColors(true).SetTextColor(tcell.ColorGreen),
+		wiring:  w,
+		changed: make(chan struct{}, 1),
+	}
+	v.header.SetTitle("40 pin header").SetBorder(true).SetTitleColor(tcell.ColorYellow)
+
+	devices := tview.NewFlex().SetDirection(tview.FlexRow)
+	for _, d := range devs {
+		view := tview.NewTextView().SetDynamicColors(true)
+		view.SetTitle(d.title()).SetBorder(true).SetTitleColor(tcell.ColorYellow)
+		devices.AddItem(view, d.height()+2, 0, false)
+		v.views = append(v.views, view)
+	}
+	// Take up any space left over
+	devices.AddItem(tview.NewBox(), 0, 1, false)
+
+	grid := tview.NewGrid().
+		SetRows(0, 1).
+		SetColumns(57, 0).
+		AddItem(v.header, 0, 0, 1, 1, 0, 0, false).
+		AddItem(devices, 0, 1, 1, 1, 0, 0, false).
+		AddItem(v.status, 1, 0, 1, 2, 0, 0, false)
+
+	// The board is drawn before any demo connects
+	v.current = v.newSession(devs)
+	v.current.program = "waiting for a demo started with '-backend=sim'"
+	v.draw()
+
+	v.app.SetRoot(grid, true).SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'q' {
+			v.app.Stop()
+			return nil
+		}
+		return event
+	})
+	return v
+}
+
+// newSession returns a session with 'devs' attached to a new simulated board
+func (v *viewer) newSession(devs []device) *session {
+	s := &session{sim: gpio.NewSim(), devices: devs}
+	for _, d := range devs {
+		d.attach(s.sim)
+	}
+	s.sim.Notify(v.changed)
+	return s
+}
+
+// accept shows each demo that connects to 'ln', the most recent one is shown
+func (v *viewer) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		// The wiring was checked in main
+		devs, _ := v.wiring.devices()
+		s := v.newSession(devs)
+		s.connected = true
+		v.mu.Lock()
+		v.current = s
+		v.mu.Unlock()
+		go v.replay(s, conn)
+	}
+}
+
+// replay replays the calls read from 'conn' on the session's board
+func (v *viewer) replay(s *session, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# ") {
+			// The demo introduces itself with its name and process id
+			s.mu.Lock()
+			s.program = strings.TrimPrefix(line, "# ")
+			s.mu.Unlock()
+			continue
+		}
+		err := s.sim.Apply(line)
+		s.mu.Lock()
+		s.calls++
+		if err != nil {
+			s.lastErr = err
+		}
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.connected = false
+	s.mu.Unlock()
+	v.notify()
+}
+
+// notify asks for the screen to be redrawn
+func (v *viewer) notify() {
+	select {
+	case v.changed <- struct{}{}:
+	default:
+	}
+}
+
+// redraw redraws the screen when the board changes, at most 30 times a second
+func (v *viewer) redraw() {
+	for range v.changed {
+		v.app.QueueUpdateDraw(v.draw)
+		time.Sleep(time.Second / 30)
+	}
+}
+
+// draw updates the views from the current session
+func (v *viewer) draw() {
+	v.mu.Lock()
+	s := v.current
+	v.mu.Unlock()
+
+	v.header.SetText(drawHeader(s.sim))
+	for i, d := range s.devices {
+		v.views[i].SetText(d.draw(s.sim))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.program
+	if s.connected {
+		status = fmt.Sprintf("%s, %d calls", s.program, s.calls)
+	} else if s.calls > 0 {
+		status = fmt.Sprintf("%s exited after %d calls", s.program, s.calls)
+	}
+	if s.lastErr != nil {
+		status += fmt.Sprintf(", [red::b]ERROR![green::-] %s", s.lastErr)
+	}
+	v.status.SetText(status + ". Press 'q' to quit.")
+}
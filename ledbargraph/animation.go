@@ -0,0 +1,306 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frame contains the brightness of each bar graph segment, from segOff (0) to segOn
+// (255). Without software PWM a segment is either on or off, so any brightness of
+// at least half is displayed as on.
+type frame []uint8
+
+const (
+	segOff uint8 = 0
+	segOn  uint8 = 255
+)
+
+// animation is a pattern played at 'fps' frames per second, 'loops' times
+type animation struct {
+	name   string
+	frames []frame
+	fps    float64
+	loops  int
+}
+
+// patterns contains the library of animation patterns. Each pattern generates the
+// frames for a bar graph with 'n' segments.
+var patterns = map[string]func(n int) []frame{
+	"fill":     fill,
+	"drain":    drain,
+	"bounce":   bounce,
+	"pingpong": pingPong,
+	"sparkle":  sparkle,
+	"counter":  counter,
+	"breathe":  breathe,
+	"gradient": gradient,
+	"comet":    comet,
+}
+
+// patternNames returns the names of the available patterns in alphabetical order
+func patternNames() []string {
+	names := []string{}
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fill lights the segments one at a time, bottom to top, until they're all lit
+func fill(n int) []frame {
+	frames := []frame{}
+	for i := 0; i <= n; i++ {
+		f := make(frame, n)
+		for j := 0; j < i; j++ {
+			f[j] = segOn
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// drain turns the segments off one at a time, top to bottom, starting with them all lit
+func drain(n int) []frame {
+	frames := fill(n)
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// bounce moves a single lit segment from one end of the bar graph to the other and
+// back again, like the scanner on the front of KITT in Knight Rider.
+func bounce(n int) []frame {
+	frames := []frame{}
+	for i := 0; i < n; i++ {
+		frames = append(frames, single(n, i))
+	}
+	for i := n - 2; i > 0; i-- {
+		frames = append(frames, single(n, i))
+	}
+	return frames
+}
+
+// pingPong moves a lit segment in from each end of the bar graph until they meet
+// in the middle, then back out again.
+func pingPong(n int) []frame {
+	frames := []frame{}
+	half := (n + 1) / 2
+	for i := 0; i < half; i++ {
+		f := make(frame, n)
+		f[i], f[n-1-i] = segOn, segOn
+		frames = append(frames, f)
+	}
+	for i := half - 2; i > 0; i-- {
+		frames = append(frames, frames[i])
+	}
+	return frames
+}
+
+// sparkle randomly lights about a quarter of the segments in each frame
+func sparkle(n int) []frame {
+	frames := []frame{}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < n*2; i++ {
+		f := make(frame, n)
+		for j := range f {
+			if r.Intn(4) == 0 {
+				f[j] = segOn
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// counter counts from 0 to 2^n-1 in binary, the bottom segment is the least
+// significant bit. Only the bottom 12 segments count on longer bar graphs, a 12
+// bit count already takes almost 7 minutes at 10 frames per second.
+func counter(n int) []frame {
+	frames := []frame{}
+	bits := n
+	if bits > 12 {
+		bits = 12
+	}
+	for v := 0; v < 1<<uint(bits); v++ {
+		f := make(frame, n)
+		for j := range f {
+			if v&(1<<uint(j)) != 0 {
+				f[j] = segOn
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// breathe slowly brightens all of the segments and then dims them again. It needs
+// software PWM ('-pwm'), without it the segments just blink.
+func breathe(n int) []frame {
+	frames := []frame{}
+	const steps = 32
+	for i := 0; i < steps*2; i++ {
+		// a raised cosine rises and falls more naturally than a linear ramp
+		level := uint8(math.Round((1 - math.Cos(float64(i)*math.Pi/steps)) / 2 * float64(segOn)))
+		f := make(frame, n)
+		for j := range f {
+			f[j] = level
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// gradient scrolls a ramp from dim to bright up the bar graph. It needs software
+// PWM ('-pwm').
+func gradient(n int) []frame {
+	frames := []frame{}
+	for i := 0; i < n; i++ {
+		f := make(frame, n)
+		for j := range f {
+			f[j] = uint8((((j + i) % n) + 1) * int(segOn) / n)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// comet moves a bright segment up the bar graph followed by a fading tail. It needs
+// software PWM ('-pwm') for the tail.
+func comet(n int) []frame {
+	frames := []frame{}
+	tail := []uint8{segOn, 96, 32, 8}
+	for head := 0; head < n+len(tail)-1; head++ {
+		f := make(frame, n)
+		for i, level := range tail {
+			if seg := head - i; seg >= 0 && seg < n {
+				f[seg] = level
+			}
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// single returns a frame with only segment 'i' lit
+func single(n, i int) frame {
+	f := make(frame, n)
+	f[i] = segOn
+	return f
+}
+
+// maxFPS is the highest animation frame rate
+const maxFPS = 1000
+
+// checkDefaults returns an error if the default frame rate, 'fps', or loop count,
+// 'loops', used by parseSequence isn't valid
+func checkDefaults(fps float64, loops int) error {
+	if fps <= 0 || fps > maxFPS {
+		return fmt.Errorf("invalid frame rate %g, must be greater than 0 and at most %d", fps, maxFPS)
+	}
+	if loops < 1 {
+		return fmt.Errorf("invalid loop count %d, must be at least 1", loops)
+	}
+	return nil
+}
+
+// parseSequence parses a comma separated list of animations. Each animation has
+// the form 'pattern[:fps[:loops]]', e.g., 'fill:20,bounce:30:5,counter'. 'fps' and
+// 'loops' default to 'defaultFPS' and 'defaultLoops' when they aren't specified.
+func parseSequence(s string, n int, defaultFPS float64, defaultLoops int) ([]animation, error) {
+	seq := []animation{}
+	for _, spec := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid animation %q, expected 'pattern[:fps[:loops]]'", spec)
+		}
+
+		gen, ok := patterns[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown pattern %q, must be one of %s", parts[0], strings.Join(patternNames(), ", "))
+		}
+		anim := animation{name: parts[0], frames: gen(n), fps: defaultFPS, loops: defaultLoops}
+
+		if len(parts) > 1 {
+			fps, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil || fps <= 0 || fps > maxFPS {
+				return nil, fmt.Errorf("invalid frame rate %q in %q, must be greater than 0 and at most %d", parts[1], spec, maxFPS)
+			}
+			anim.fps = fps
+		}
+		if len(parts) > 2 {
+			loops, err := strconv.Atoi(parts[2])
+			if err != nil || loops < 1 {
+				return nil, fmt.Errorf("invalid loop count %q in %q, must be at least 1", parts[2], spec)
+			}
+			anim.loops = loops
+		}
+
+		seq = append(seq, anim)
+	}
+	return seq, nil
+}
+
+// playSequence plays each animation in 'seq' in turn. The whole sequence is played
+// 'repeat' times, or forever if 'repeat' is 0. It returns false if it was stopped
+// before it finished.
+func playSequence(ctx context.Context, seq []animation, repeat int) bool {
+	for i := 0; repeat == 0 || i < repeat; i++ {
+		if ctx.Err() != nil {
+			return false
+		}
+		for _, anim := range seq {
+			if !play(ctx, anim) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// play displays each frame of 'anim' on the bar graph for 1/fps seconds, 'anim.loops'
+// times. It returns false if it was stopped before it finished.
+func play(ctx context.Context, anim animation) bool {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / anim.fps))
+	defer ticker.Stop()
+
+	for i := 0; i < anim.loops; i++ {
+		if ctx.Err() != nil {
+			return false
+		}
+		for _, f := range anim.frames {
+			showFrame(f)
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ticker.C:
+			}
+		}
+	}
+	return true
+}
+
+// showFrame sets the bar graph segments to the brightness in 'f'. Without software
+// PWM a segment is either on or off.
+func showFrame(f frame) {
+	if pwm != nil {
+		pwm.set(f)
+		return
+	}
+	for i, level := range f {
+		setSegment(gpins[i], level >= segOn/2)
+	}
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckDefaults(t *testing.T) {
+	tests := []struct {
+		fps     float64
+		loops   int
+		wantErr bool
+	}{
+		{fps: 10, loops: 1},
+		{fps: 0.5, loops: 3},
+		{fps: maxFPS, loops: 1},
+		{fps: 0, loops: 1, wantErr: true},
+		{fps: -10, loops: 1, wantErr: true},
+		{fps: maxFPS + 1, loops: 1, wantErr: true},
+		{fps: 1e12, loops: 1, wantErr: true},
+		{fps: 10, loops: 0, wantErr: true},
+		{fps: 10, loops: -1, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		err := checkDefaults(tc.fps, tc.loops)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("fps %g, loops %d: got error %v, want error %t", tc.fps, tc.loops, err, tc.wantErr)
+		}
+		// The defaults are checked the same way as an animation's own settings
+		_, seqErr := parseSequence("fill", 10, tc.fps, tc.loops)
+		if err == nil && seqErr != nil {
+			t.Errorf("fps %g, loops %d: parseSequence error %s", tc.fps, tc.loops, seqErr)
+		}
+	}
+}
+
+func TestParseSequenceErrors(t *testing.T) {
+	for _, s := range []string{"", "nope", "fill:0", "fill:-1", "fill:1001", "fill:x", "fill:10:0", "fill:10:x", "fill:10:1:1"} {
+		if _, err := parseSequence(s, 10, 10, 1); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestPlayStops(t *testing.T) {
+	useFake(t)
+
+	tests := []struct {
+		name string
+		seq  []animation
+	}{
+		// Nothing is shown so, before play checked the context, these never returned
+		{name: "no loops", seq: []animation{{name: "fill", frames: fill(len(gpins)), fps: 10, loops: 0}}},
+		{name: "no frames", seq: []animation{{name: "empty", fps: 10, loops: 1}}},
+		{name: "frames", seq: []animation{{name: "fill", frames: fill(len(gpins)), fps: 10, loops: 1}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan bool)
+			go func() { done <- playSequence(ctx, tc.seq, 0) }()
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+			select {
+			case finished := <-done:
+				if finished {
+					t.Error("playSequence returned true after it was stopped")
+				}
+			case <-time.After(stopWithin):
+				t.Fatalf("still running %s after the context was cancelled", stopWithin)
+			}
+		})
+	}
+
+	// A stopped sequence isn't started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if playSequence(ctx, tests[2].seq, 1) {
+		t.Error("playSequence played a sequence after it was stopped")
+	}
+}
@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// audioConfig contains the settings for the audio VU meter mode
+type audioConfig struct {
+	source  string        // WAV file, or '-' for WAV or raw PCM on stdin
+	raw     pcmFormat     // format of raw PCM on stdin
+	window  time.Duration // length of audio measured for each display update
+	detect  string        // 'rms' or 'peak'
+	attack  time.Duration // time for the meter to rise ~63% of the way to a louder level
+	release time.Duration // time for the meter to fall ~63% of the way to a quieter level
+	floor   float64       // level in dBFS that lights no segments, 0 dBFS lights them all
+	sync    bool          // pace the display to the audio's playback time
+}
+
+// validate checks the audio meter settings
+func (cfg audioConfig) validate() error {
+	if cfg.window < time.Millisecond {
+		return fmt.Errorf("audio window must be at least 1ms, got %s", cfg.window)
+	}
+	if cfg.detect != "rms" && cfg.detect != "peak" {
+		return fmt.Errorf("invalid audio detector %q, must be 'rms' or 'peak'", cfg.detect)
+	}
+	if cfg.attack < 0 || cfg.release < 0 {
+		return fmt.Errorf("audio attack and release must not be negative")
+	}
+	if cfg.floor >= 0 {
+		return fmt.Errorf("audio floor must be less than 0 dBFS, got %g", cfg.floor)
+	}
+	return nil
+}
+
+// levelDetector measures the level of successive windows of audio in dBFS and
+// smooths it with separate attack and release times, like the ballistics of an
+// analog VU meter.
+type levelDetector struct {
+	format pcmFormat
+	detect string
+	floor  float64
+	// attackCoef and releaseCoef are the fraction of the distance to a new level
+	// covered in one window
+	attackCoef, releaseCoef float64
+	level                   float64 // smoothed level in dBFS
+}
+
+func newLevelDetector(cfg audioConfig, format pcmFormat) *levelDetector {
+	coef := func(t time.Duration) float64 {
+		if t == 0 {
+			return 1
+		}
+		return 1 - math.Exp(-float64(cfg.window)/float64(t))
+	}
+	return &levelDetector{
+		format:      format,
+		detect:      cfg.detect,
+		floor:       cfg.floor,
+		attackCoef:  coef(cfg.attack),
+		releaseCoef: coef(cfg.release),
+		level:       cfg.floor,
+	}
+}
+
+// measure returns the smoothed level after the window of frames in 'buf'. All
+// channels are combined, so the meter shows the loudest channel's peak or the
+// RMS of all channels.
+func (d *levelDetector) measure(buf []byte) float64 {
+	size := d.format.bits / 8
+	peak, sumSquares, count := 0.0, 0.0, 0
+	for i := 0; i+size <= len(buf); i += size {
+		s := d.format.sample(buf[i:])
+		peak = math.Max(peak, math.Abs(s))
+		sumSquares += s * s
+		count++
+	}
+
+	amplitude := peak
+	if d.detect == "rms" && count > 0 {
+		amplitude = math.Sqrt(sumSquares / float64(count))
+	}
+	db := d.floor
+	if amplitude > 0 {
+		db = math.Max(d.floor, 20*math.Log10(amplitude))
+	}
+
+	if db > d.level {
+		d.level += (db - d.level) * d.attackCoef
+	} else {
+		d.level += (db - d.level) * d.releaseCoef
+	}
+	return d.level
+}
+
+// runAudio displays the level of the audio from 'cfg.source' on the bar graph.
+// 'mcfg' supplies the peak hold setting, the meter's scale is the audio floor
+// to 0 dBFS.
+func runAudio(ctx context.Context, cfg audioConfig, mcfg meterConfig, n int) error {
+	var in io.Reader = os.Stdin
+	if cfg.source != "-" {
+		f, err := os.Open(cfg.source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// WAV input is recognized by its header, anything else on stdin is raw PCM
+	r := bufio.NewReader(in)
+	format := cfg.raw
+	var samples io.Reader = r
+	if magic, err := r.Peek(4); cfg.source != "-" || (err == nil && string(magic) == "RIFF") {
+		var err error
+		if format, samples, err = readWAVHeader(r); err != nil {
+			return err
+		}
+	} else if err := format.validate(); err != nil {
+		return err
+	}
+
+	mcfg.min, mcfg.max, mcfg.scale, mcfg.decay = cfg.floor, 0, "linear", 0
+	m := newMeter(mcfg, n)
+	var framesPerWindow int
+	framesPerWindow, cfg.window = audioWindow(format, cfg.window)
+	d := newLevelDetector(cfg, format)
+	buf := make([]byte, framesPerWindow*format.frameSize())
+
+	start := time.Now()
+	var played time.Duration
+	for {
+		nread, err := io.ReadFull(samples, buf)
+		if nread > 0 {
+			m.set(d.measure(buf[:nread]))
+			played += time.Duration(int64(nread/format.frameSize()) * int64(time.Second) / int64(format.sampleRate))
+
+			// Wait until the end of this window would be heard if the audio was
+			// played when the meter started. Audio that arrives in real time, e.g.,
+			// from 'arecord', is already behind so it's displayed immediately.
+			if cfg.sync {
+				if !sleepUntil(ctx, start.Add(played)) {
+					return nil
+				}
+			}
+			now := time.Now()
+			m.advance(now)
+			showFrame(m.frame())
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+// maxAudioBuffer is the most audio, in bytes, measured for each meter update
+const maxAudioBuffer = 1 << 20
+
+// audioWindow returns the number of frames of audio in 'format' measured for each
+// meter update, and the length of audio they hold. It's at least one frame, and
+// fewer than 'window' if they wouldn't fit in maxAudioBuffer.
+func audioWindow(format pcmFormat, window time.Duration) (int, time.Duration) {
+	max := maxAudioBuffer / format.frameSize()
+	if maxWindow := time.Duration(max) * time.Second / time.Duration(format.sampleRate); window >= maxWindow {
+		return max, maxWindow
+	}
+	frames := int(int64(format.sampleRate) * int64(window) / int64(time.Second))
+	if frames < 1 {
+		frames = 1
+	}
+	return frames, window
+}
+
+// sleepUntil pauses until 't' and returns true, or returns false as soon as the
+// program is stopping.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
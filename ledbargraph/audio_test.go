@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// pcm16 returns 16 bit PCM samples with amplitudes 'samples', -1.0 to 1.0
+func pcm16(samples ...float64) []byte {
+	b := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(int16(math.Round(s*math.MaxInt16))))
+	}
+	return b
+}
+
+// square returns 'n' samples of a square wave with amplitude 'a'
+func square(n int, a float64) []byte {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = a
+		if i%2 == 1 {
+			samples[i] = -a
+		}
+	}
+	return pcm16(samples...)
+}
+
+func TestLevelDetector(t *testing.T) {
+	format := pcmFormat{sampleRate: 8000, channels: 2, bits: 16}
+	cfg := audioConfig{window: 10 * time.Millisecond, detect: "peak", floor: -48}
+
+	tests := []struct {
+		name   string
+		detect string
+		buf    []byte
+		want   float64
+	}{
+		{name: "silence", detect: "peak", buf: pcm16(0, 0, 0, 0), want: -48},
+		{name: "empty", detect: "rms", buf: nil, want: -48},
+		{name: "below the floor", detect: "peak", buf: pcm16(0.001, -0.001), want: -48},
+		{name: "full scale peak", detect: "peak", buf: square(8, 1), want: 0},
+		{name: "half scale peak", detect: "peak", buf: square(8, 0.5), want: -6.02},
+		{name: "loudest channel's peak", detect: "peak", buf: pcm16(0.1, -0.5, 0.2, 0.25), want: -6.02},
+		{name: "square wave RMS is its peak", detect: "rms", buf: square(8, 0.5), want: -6.02},
+		{name: "RMS of all channels", detect: "rms", buf: pcm16(0.5, 0, 0.5, 0), want: -9.03},
+		{name: "trailing partial sample", detect: "peak", buf: append(square(4, 0.5), 0xff), want: -6.02},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.detect = tc.detect
+			d := newLevelDetector(cfg, format)
+			if got := d.measure(tc.buf); math.Abs(got-tc.want) > 0.01 {
+				t.Errorf("got %.2f dBFS, want %.2f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLevelDetectorBallistics(t *testing.T) {
+	format := pcmFormat{sampleRate: 8000, channels: 1, bits: 16}
+	cfg := audioConfig{window: 10 * time.Millisecond, detect: "peak", floor: -40, attack: 10 * time.Millisecond, release: 100 * time.Millisecond}
+	d := newLevelDetector(cfg, format)
+
+	// The level rises ~63% of the way to a louder level in 'attack'
+	loud, quiet := square(80, 1), pcm16(make([]float64, 80)...)
+	if got, want := d.measure(loud), -40*math.Exp(-1); math.Abs(got-want) > 0.01 {
+		t.Errorf("after one attack time got %.2f dBFS, want %.2f", got, want)
+	}
+	for i := 0; i < 20; i++ {
+		d.measure(loud)
+	}
+	if got := d.measure(loud); got < -0.01 {
+		t.Errorf("got %.2f dBFS after a loud second, want 0", got)
+	}
+
+	// And falls ~63% of the way in 'release'
+	var got float64
+	for i := 0; i < 10; i++ {
+		got = d.measure(quiet)
+	}
+	if want := -40 * (1 - math.Exp(-1)); math.Abs(got-want) > 0.05 {
+		t.Errorf("after one release time got %.2f dBFS, want %.2f", got, want)
+	}
+
+	// With no attack or release the level follows the audio
+	cfg.attack, cfg.release = 0, 0
+	d = newLevelDetector(cfg, format)
+	if got := d.measure(loud); got < -0.01 {
+		t.Errorf("got %.2f dBFS, want 0", got)
+	}
+	if got := d.measure(quiet); got != -40 {
+		t.Errorf("got %.2f dBFS, want -40", got)
+	}
+}
+
+func TestAudioWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     pcmFormat
+		window     time.Duration
+		wantFrames int
+		wantWindow time.Duration
+	}{
+		{name: "CD", format: pcmFormat{sampleRate: 44100, channels: 2, bits: 16}, window: 20 * time.Millisecond, wantFrames: 882, wantWindow: 20 * time.Millisecond},
+		{name: "at least a frame", format: pcmFormat{sampleRate: 8000, channels: 1, bits: 8}, window: time.Microsecond, wantFrames: 1, wantWindow: time.Microsecond},
+		{
+			name:       "long window",
+			format:     pcmFormat{sampleRate: 48000, channels: 2, bits: 16},
+			window:     time.Hour,
+			wantFrames: maxAudioBuffer / 4,
+			wantWindow: time.Duration(maxAudioBuffer/4) * time.Second / 48000,
+		},
+		{
+			name:       "largest format",
+			format:     pcmFormat{sampleRate: maxSampleRate, channels: maxChannels, bits: 32},
+			window:     time.Second,
+			wantFrames: maxAudioBuffer / (maxChannels * 4),
+			wantWindow: time.Duration(maxAudioBuffer/(maxChannels*4)) * time.Second / maxSampleRate,
+		},
+		{
+			name:       "window that would overflow",
+			format:     pcmFormat{sampleRate: maxSampleRate, channels: 1, bits: 8},
+			window:     math.MaxInt64,
+			wantFrames: maxAudioBuffer,
+			wantWindow: time.Duration(maxAudioBuffer) * time.Second / maxSampleRate,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			frames, window := audioWindow(tc.format, tc.window)
+			if frames != tc.wantFrames || window != tc.wantWindow {
+				t.Errorf("got %d frames, %s, want %d frames, %s", frames, window, tc.wantFrames, tc.wantWindow)
+			}
+			if size := frames * tc.format.frameSize(); size > maxAudioBuffer {
+				t.Errorf("got a %d byte buffer, more than %d", size, maxAudioBuffer)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// reportFakePins writes the final state of each segment's pin on fake board 'f' to
+// 'w'. It's used with '-fake' to run the bar graph without a Raspberry Pi, and lets
+// the shutdown sequence be checked off-device, every segment should be off when the
+// program exits.
+func reportFakePins(w io.Writer, f *gpio.Fake) {
+	for i, bcm := range pins {
+		mode, level := f.ModeOf(bcm), f.Level(bcm)
+		segment := "off"
+		if mode == gpio.Output && (level == gpio.Low) == activeLow {
+			segment = "ON"
+		}
+		fmt.Fprintf(w, "segment %2d, BCM %2d: %s %s, segment %s, %d writes\n", i+1, bcm, mode, level, segment, f.Writes(bcm))
+	}
+}
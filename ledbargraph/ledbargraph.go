@@ -3,7 +3,44 @@
 // Use of this source code is governed by the GPL 3.0
 // license that can be found in the LICENSE file.
 //
-// Run using 'go run ledbargraph.go'
+// Run using 'go run *.go'
+//
+// By default the program lights each segment in turn and then randomly flickers
+// the segments. Use '-seq' to play a sequence of animations instead, e.g.,
+// 'go run *.go -seq=fill:20,drain:20,bounce:30:5,counter:100 -repeat=0'. Each
+// animation is 'pattern[:fps[:loops]]' and the available patterns are fill, drain,
+// bounce, pingpong, sparkle, counter, breathe, gradient, and comet.
+//
+// Use '-meter' to turn the bar graph into a level meter. Values are read from stdin,
+// a file, or the output of a command and scaled between '-min' and '-max', e.g.,
+// 'go run *.go -meter=/sys/class/thermal/thermal_zone0/temp -min=30000 -max=80000',
+// 'go run *.go -meter="exec:cat /proc/loadavg" -max=4 -interval=2s', or
+// 'vmstat 1 | awk "{print 100-\$15; fflush()}" | go run *.go -meter=- -decay=5 -peak-hold=1s'.
+//
+// Use '-audio' for a VU meter. The display is synchronized to the audio's playback
+// time so it can be run alongside a player, e.g., 'aplay song.wav & go run *.go -audio=song.wav',
+// or fed live audio, e.g., 'arecord -f cd | go run *.go -audio=- -peak-hold=500ms'.
+//
+// Use '-sysmon' to monitor the Pi, e.g., 'go run *.go -sysmon=cpu,temp -rotate=10s -critical=temp=70'.
+// The display rotates between the metrics, briefly lighting segment 1 for the first metric,
+// segment 2 for the second, and so on, before showing each one. The top segments blink when
+// a metric reaches its critical threshold. '-proc' and '-sys' can point at copies of /proc and
+// /sys, which is handy for trying out the thresholds.
+//
+// The segments are normally either on or off. '-pwm' drives all 10 pins with software PWM
+// so each segment has its own brightness, which the breathe, gradient, and comet patterns
+// need, e.g., 'go run *.go -pwm -seq=comet:30:5,breathe:30:3,gradient:8:4 -repeat=0'.
+//
+// ctl-C (or SIGTERM) stops any of the modes and turns off the LEDs. '-fake' runs the program
+// without a Raspberry Pi, the pins are simulated and their final state is printed on exit.
+// '-backend=cdev' drives the pins through the GPIO character device, '-chip', instead of
+// the go-rpio library. It doesn't need root and works on any Linux board. '-backend=sim'
+// runs the program on a simulated Raspberry Pi.
+//
+// The pins can be claimed in a file shared with the other demos, '-claims' or $GPIO_CLAIMS,
+// e.g., /run/lock/gpio-claims, so that running this program at the same time as one using
+// any of the same pins, e.g., ledmatrixspi, which uses BCM 8 as SPI CE0, fails with an
+// error naming the other program. The claims aren't shared by default.
 //
 // This program demonstrates how to drive an LED Bar Graph LED display. See
 // https://docs.sunfounder.com/projects/raphael-kit/en/latest/components/component_bar_graph.html
@@ -12,10 +49,24 @@
 // This program assumes the BCM board is wired up as specified
 // in the associated SunFounder project -
 // https://docs.sunfounder.com/projects/raphael-kit/en/latest/1.1.3_led_bar_graph_c.html
+//
+// That wiring uses the I2C and SPI CE0 pins. Other wiring can be described with
+// '-pins' (any number of segments, bottom segment first) using BCM, WiringPi, or
+// physical pin numbers, and '-active' for bar graphs that light when a pin is HIGH,
+// e.g., 'go run *.go -numbering=phys -pins=11,12,13,15,16,18,22,29,31,32 -active=high'.
+// The same settings can be kept in a file, e.g., 'go run *.go -pinconfig=bargraph.conf':
+//
+//	# bar graph on the left side of the header
+//	numbering = wpi
+//	pins = 0,1,2,3,4,5,6,21,22,26
+//	active = low
+//	strict = true
 
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
@@ -23,7 +74,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 // 'pins' references GPIO/BCM pins, except for  pins 2,
@@ -31,100 +82,310 @@ import (
 // pins respectively. Here are the associated WiringPi
 // pin numbers as a cross reference (from the C program).
 // int pins[10] = {0,1,2,3,4,5,6,8,9,10};
+// This is the default wiring, it can be changed with the
+// '-pins', '-numbering', '-active', and '-pinconfig' flags.
 var pins = []int{17, 18, 27, 22, 23, 24, 25, 2, 3, 8}
-var gpins = []rpio.Pin{}
+var gpins = []gpio.Pin{}
 
-// initPins will briefly flash all of the pins on before
-// turning them all off.
-func initPins() {
+// initPins will briefly flash all of the pins on 'board'
+// on before turning them all off.
+func initPins(board gpio.Board) error {
 	for _, pin := range pins {
-		pin := pin
-		gpin := rpio.Pin(pin)
+		gpin, err := board.Pin(pin)
+		if err != nil {
+			return err
+		}
 		gpin.Output()
 		gpins = append(gpins, gpin)
 	}
 	for i, _ := range gpins {
 		gpin := gpins[i]
-		gpin.Low()
+		setSegment(gpin, true)
 	}
 	time.Sleep(time.Millisecond * 300)
 	for _, gpin := range gpins {
-		gpin.High()
+		setSegment(gpin, false)
 	}
 	time.Sleep(time.Millisecond * 300)
+	return nil
 }
 
-// randBarGraph will randonly light up 'pins'
-func randBarGraph(upper int, stop chan interface{}) {
-	s1 := rand.NewSource(time.Now().UnixNano())
+// randBarGraph will randonly light up 'pins' until 'ctx'
+// is cancelled. The segment that's lit when 'ctx' is
+// cancelled is left lit, it's up to the caller to reset
+// the LEDs.
+func randBarGraph(ctx context.Context, upper int) {
+	r1 := rand.New(rand.NewSource(time.Now().UnixNano()))
 	for {
-		select {
-		case <-stop:
-			break
-		default:
-			r1 := rand.New(s1)
-			rnum := r1.Intn(upper)
-			gpins[rnum].Low()
-			time.Sleep(time.Millisecond * 30)
-			gpins[rnum].High()
-			time.Sleep(time.Millisecond * 30)
+		rnum := r1.Intn(upper)
+		setSegment(gpins[rnum], true)
+		if !sleepUntil(ctx, time.Now().Add(time.Millisecond*30)) {
+			return
+		}
+		setSegment(gpins[rnum], false)
+		if !sleepUntil(ctx, time.Now().Add(time.Millisecond*30)) {
+			return
 		}
 	}
 }
 
-// ledAll lights up all the leds in sequence.
-func ledAll(stop chan interface{}) {
-	for i, _ := range gpins {
-		select {
-		case <-stop:
-			break
-		default:
-			gpins[i].Low()
-			time.Sleep(time.Millisecond * 300)
-			gpins[i].High()
-			time.Sleep(time.Millisecond * 300)
+// ledAll lights up all the leds in sequence. It returns
+// early if 'ctx' is cancelled.
+func ledAll(ctx context.Context) {
+	for i := range gpins {
+		setSegment(gpins[i], true)
+		if !sleepUntil(ctx, time.Now().Add(time.Millisecond*300)) {
+			return
+		}
+		setSegment(gpins[i], false)
+		if !sleepUntil(ctx, time.Now().Add(time.Millisecond*300)) {
+			return
 		}
 	}
 }
 func main() {
-	// Initialize the rpio library
-	if err := rpio.Open(); err != nil {
+	var (
+		seqStr    string
+		fps       float64
+		loops     int
+		repeat    int
+		meterCfg  meterConfig
+		audioCfg  audioConfig
+		sysmonCfg sysmonConfig
+		usePWM    bool
+		pwmFreq   int
+		gamma     float64
+		pinCfg    pinConfig
+		pinFile   string
+		fake      bool
+		backend   string
+		chipName  string
+		claimFile string
+	)
+	flag.BoolVar(&fake, "fake", false, "use fake pins instead of GPIO pins and report their final state on exit, the same as '-backend=fake'")
+	flag.StringVar(&backend, "backend", "rpio", "how the pins are driven, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	flag.StringVar(&claimFile, "claims", gpio.ClaimsFile(), "file the pins are claimed in, shared with other programs so that conflicting uses are caught, defaults to $GPIO_CLAIMS, '' to not share the claims")
+	flag.StringVar(&pinCfg.pins, "pins", "17,18,27,22,23,24,25,2,3,8", "comma separated bar graph pins, bottom segment first")
+	flag.StringVar(&pinCfg.numbering, "numbering", "bcm", "pin numbering used by '-pins', 'bcm', 'wpi' (WiringPi), or 'phys' (physical header pin)")
+	flag.StringVar(&pinCfg.active, "active", "low", "pin level that lights a segment, 'low' or 'high'")
+	flag.BoolVar(&pinCfg.strict, "strict", false, "reject pins reserved for I2C, SPI, UART, and the ID EEPROM instead of warning")
+	flag.StringVar(&pinFile, "pinconfig", "", "file of 'key = value' pin settings (pins, numbering, active, strict), flags override the file")
+	flag.StringVar(&seqStr, "seq", "", "comma separated sequence of animations, each in the form 'pattern[:fps[:loops]]'")
+	flag.Float64Var(&fps, "fps", 10, "default animation frame rate (frames per second)")
+	flag.IntVar(&loops, "loops", 1, "default number of times each animation is played")
+	flag.IntVar(&repeat, "repeat", 1, "number of times the sequence is played, 0 to play it forever")
+	flag.StringVar(&meterCfg.source, "meter", "", "display values read from stdin ('-'), a file, or a command ('exec:COMMAND') as a level meter")
+	flag.Float64Var(&meterCfg.min, "min", 0, "meter value that lights no segments")
+	flag.Float64Var(&meterCfg.max, "max", 100, "meter value that lights all segments")
+	flag.StringVar(&meterCfg.scale, "scale", "linear", "meter scale, 'linear' or 'log'")
+	flag.DurationVar(&meterCfg.interval, "interval", time.Second, "how often the meter file is read or command is run")
+	flag.Float64Var(&meterCfg.decay, "decay", 0, "segments per second the meter falls when the value drops, 0 to drop immediately")
+	flag.DurationVar(&meterCfg.peakHold, "peak-hold", 0, "how long the meter's peak segment stays lit, 0 to disable")
+	flag.StringVar(&audioCfg.source, "audio", "", "display the level of a WAV file, or of WAV or raw PCM audio on stdin ('-'), as a VU meter")
+	flag.IntVar(&audioCfg.raw.sampleRate, "audio-rate", 44100, "sample rate of raw PCM audio")
+	flag.IntVar(&audioCfg.raw.channels, "audio-channels", 2, "number of channels in raw PCM audio")
+	flag.IntVar(&audioCfg.raw.bits, "audio-bits", 16, "bits per sample of raw PCM audio, 8, 16, 24, or 32")
+	flag.DurationVar(&audioCfg.window, "window", 20*time.Millisecond, "length of audio measured for each VU meter update")
+	flag.StringVar(&audioCfg.detect, "detect", "rms", "VU meter level detector, 'rms' or 'peak'")
+	flag.DurationVar(&audioCfg.attack, "attack", 10*time.Millisecond, "how quickly the VU meter rises")
+	flag.DurationVar(&audioCfg.release, "release", 300*time.Millisecond, "how quickly the VU meter falls")
+	flag.Float64Var(&audioCfg.floor, "floor", -48, "level in dBFS at the bottom of the VU meter")
+	flag.BoolVar(&audioCfg.sync, "sync", true, "pace the VU meter to the audio's playback time")
+	flag.StringVar(&sysmonCfg.metrics, "sysmon", "", "display system metrics, comma separated list of cpu, mem, temp, and load")
+	flag.DurationVar(&sysmonCfg.rotate, "rotate", 5*time.Second, "how long each system metric is displayed")
+	flag.StringVar(&sysmonCfg.critical, "critical", "", "critical thresholds that blink the top segments, e.g., 'temp=70,cpu=95'")
+	flag.StringVar(&sysmonCfg.procRoot, "proc", "/proc", "root of the proc file system")
+	flag.StringVar(&sysmonCfg.sysRoot, "sys", "/sys", "root of the sys file system")
+	flag.BoolVar(&usePWM, "pwm", false, "use software PWM so each segment's brightness can vary")
+	flag.IntVar(&pwmFreq, "pwm-freq", 100, "software PWM frequency in Hz")
+	flag.Float64Var(&gamma, "gamma", 2.2, "software PWM gamma correction, 1 for none")
+	flag.Parse()
+
+	if fake {
+		backend = "fake"
+	}
+
+	if usePWM && (pwmFreq < 50 || pwmFreq > 1000) {
+		fmt.Printf("Software PWM frequency must be between 50 and 1000Hz, got %d\n", pwmFreq)
+		os.Exit(1)
+	}
+
+	// Settings from the pin config file are overridden by any pin flags given on
+	// the command line.
+	if pinFile != "" {
+		fileCfg, err := readPinConfig(pinFile, pinCfg)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "pins":
+				fileCfg.pins = pinCfg.pins
+			case "numbering":
+				fileCfg.numbering = pinCfg.numbering
+			case "active":
+				fileCfg.active = pinCfg.active
+			case "strict":
+				fileCfg.strict = pinCfg.strict
+			}
+		})
+		pinCfg = fileCfg
+	}
+	bcmPins, warnings, err := pinCfg.resolve()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	pins = bcmPins
+	activeLow = pinCfg.active == "low"
+
+	var seq []animation
+	if seqStr != "" {
+		if err := checkDefaults(fps, loops); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if repeat < 0 {
+			fmt.Printf("Invalid repeat count %d, must be at least 0\n", repeat)
+			os.Exit(1)
+		}
+		if seq, err = parseSequence(seqStr, len(pins), fps, loops); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if meterCfg.source != "" {
+		if err := meterCfg.validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if audioCfg.source != "" {
+		if err := audioCfg.validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// Claim the pins, a fake board's pins aren't real so its claims aren't shared
+	if backend == "fake" {
+		claimFile = ""
+	}
+	claims, err := gpio.OpenRegistry(claimFile)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	for _, w := range claims.Warnings() {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	for i, pin := range pins {
+		if err := claims.Claim(pin, gpio.FuncGPIO, fmt.Sprintf("bar graph segment %d", i+1)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 
-	// stop channel is used to synchronize exiting the
-	// program so that the board is reset to the state
-	// it was in prior to the program starting.
-	stop := make(chan interface{})
+	// Open the board, e.g., initialize the rpio library
+	board, err := gpio.Open(backend, chipName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// ctx is cancelled when the program is interrupted. The
+	// display modes return promptly when that happens so that
+	// the main goroutine, and only the main goroutine, resets
+	// the board to the state it was in prior to the program
+	// starting.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// sigs is the channel used by Go's signals capability
 	// to notify the program that a signal has been raised.
-	sigs := make(chan os.Signal)
+	sigs := make(chan os.Signal, 1)
 
 	// signal.Notify() registers the program's interest
 	// in receiving signals and provides the channel used
-	// to send signals to the program.
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL)
-	go signalHandler(sigs, stop)
+	// to send signals to the program. SIGKILL can't be
+	// caught so it isn't included.
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go signalHandler(sigs, cancel)
 
-	initPins()
-	ledAll(stop)
-	randBarGraph(10, stop)
-}
+	if err := initPins(board); err != nil {
+		fmt.Println(err)
+		board.Close()
+		os.Exit(1)
+	}
 
-func signalHandler(sigs chan os.Signal, stop chan interface{}) {
-	<-sigs
-	// notify all listeners that the program is stopping
-	close(stop)
+	// run is the selected display mode
+	var run func()
+	switch {
+	case seq != nil:
+		run = func() { playSequence(ctx, seq, repeat) }
+	case meterCfg.source != "":
+		run = func() { runMeter(ctx, meterCfg, len(gpins)) }
+	case audioCfg.source != "":
+		run = func() {
+			if err := runAudio(ctx, audioCfg, meterCfg, len(gpins)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	case sysmonCfg.metrics != "":
+		run = func() {
+			if err := runSysmon(ctx, sysmonCfg, len(gpins)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	default:
+		run = func() {
+			ledAll(ctx)
+			randBarGraph(ctx, len(gpins))
+		}
+	}
+
+	if usePWM {
+		pwm = newSoftPWM(gpins, pwmFreq, gamma)
+		pwm.start()
+	}
+	run()
+
+	ledsOff()
+	if f, ok := board.(*gpio.Fake); ok {
+		reportFakePins(os.Stdout, f)
+	} else {
+		gpio.Report(os.Stdout, board)
+	}
+	// Release the board's resources, e.g., the rpio library's
+	if err := board.Close(); err != nil {
+		fmt.Println(err)
+	}
+	if err := claims.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
 
-	fmt.Println("\nExiting...\n")
+// ledsOff turns off all of the bar graph's LEDs, stopping software PWM if it's running
+func ledsOff() {
+	if pwm != nil {
+		pwm.close()
+		pwm = nil
+	}
 	for _, gpin := range gpins {
-		// turn off LEDs
-		gpin.High()
+		setSegment(gpin, false)
 	}
-	// Release rpio library resources
-	rpio.Close()
+}
 
-	os.Exit(0)
+// signalHandler cancels the display mode's context when a signal is received
+func signalHandler(sigs chan os.Signal, cancel context.CancelFunc) {
+	<-sigs
+	fmt.Println("\nExiting...")
+	cancel()
 }
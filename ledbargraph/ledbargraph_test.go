@@ -0,0 +1,109 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// stopWithin is how long a display mode has to return after its context is cancelled
+const stopWithin = 100 * time.Millisecond
+
+// useFake wires the bar graph's segments to a fake board, restoring the real
+// wiring when the test ends
+func useFake(t *testing.T) *gpio.Fake {
+	board := gpio.NewFake()
+	saved, savedLow := gpins, activeLow
+	t.Cleanup(func() { gpins, activeLow, pwm = saved, savedLow, nil })
+
+	gpins = nil
+	for _, bcm := range pins {
+		gpin, err := board.Pin(bcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gpin.Output()
+		gpins = append(gpins, gpin)
+	}
+	return board
+}
+
+func TestDisplayModesStop(t *testing.T) {
+	value := filepath.Join(t.TempDir(), "value")
+	if err := ioutil.WriteFile(value, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context)
+	}{
+		{name: "ledAll", run: ledAll},
+		{name: "randBarGraph", run: func(ctx context.Context) { randBarGraph(ctx, len(gpins)) }},
+		{name: "playSequence", run: func(ctx context.Context) {
+			seq, err := parseSequence("fill:50,bounce:50,breathe:50", len(gpins), 20, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			playSequence(ctx, seq, 0)
+		}},
+		{name: "runMeter", run: func(ctx context.Context) {
+			cfg := meterConfig{source: value, min: 0, max: 100, scale: "linear", interval: 10 * time.Millisecond, decay: 20}
+			runMeter(ctx, cfg, len(gpins))
+		}},
+	}
+
+	for _, tc := range tests {
+		for _, usePWM := range []bool{false, true} {
+			name := tc.name
+			if usePWM {
+				name += "/pwm"
+			}
+			t.Run(name, func(t *testing.T) {
+				for _, low := range []bool{true, false} {
+					board := useFake(t)
+					activeLow = low
+					if usePWM {
+						pwm = newSoftPWM(gpins, 1000, 2.2)
+						pwm.start()
+					}
+
+					ctx, cancel := context.WithCancel(context.Background())
+					done := make(chan struct{})
+					go func() {
+						tc.run(ctx)
+						close(done)
+					}()
+					time.Sleep(50 * time.Millisecond)
+					cancel()
+					select {
+					case <-done:
+					case <-time.After(stopWithin):
+						t.Fatalf("still running %s after the context was cancelled", stopWithin)
+					}
+
+					ledsOff()
+					if pwm != nil {
+						t.Error("ledsOff didn't stop software PWM")
+					}
+					for i, bcm := range pins {
+						if on := (board.Level(bcm) == gpio.Low) == activeLow; on {
+							t.Errorf("active low %t: segment %d (BCM %d) is still on", low, i+1, bcm)
+						}
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,224 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// meterRefresh is how often the meter display is updated. It's independent of how
+// often new values arrive so that the bar and peak segment decay smoothly.
+const meterRefresh = 30 * time.Millisecond
+
+// meterConfig contains the settings for the level meter mode
+type meterConfig struct {
+	source   string        // '-' for stdin, 'exec:COMMAND' to run a command, otherwise a file
+	min, max float64       // values at or below min light no segments, at or above max light them all
+	scale    string        // 'linear' or 'log'
+	interval time.Duration // how often a file is read or a command is run
+	decay    float64       // segments per second the bar falls when the value drops, 0 to drop immediately
+	peakHold time.Duration // how long the peak segment is held before it decays, 0 to disable
+}
+
+// validate checks the meter settings
+func (cfg meterConfig) validate() error {
+	if cfg.max <= cfg.min {
+		return fmt.Errorf("meter max (%g) must be greater than min (%g)", cfg.max, cfg.min)
+	}
+	if cfg.scale != "linear" && cfg.scale != "log" {
+		return fmt.Errorf("invalid meter scale %q, must be 'linear' or 'log'", cfg.scale)
+	}
+	if cfg.scale == "log" && cfg.min <= 0 {
+		return fmt.Errorf("meter min must be greater than 0 for a log scale, got %g", cfg.min)
+	}
+	if cfg.interval <= 0 {
+		return fmt.Errorf("meter interval must be greater than 0, got %s", cfg.interval)
+	}
+	if cfg.decay < 0 || cfg.peakHold < 0 {
+		return fmt.Errorf("meter decay and peak hold must not be negative")
+	}
+	return nil
+}
+
+// meter converts values to a number of lit segments and animates the bar and the
+// peak segment the way a VU meter's needle moves, jumping up immediately and
+// falling back slowly.
+type meter struct {
+	cfg    meterConfig
+	n      int       // number of segments
+	target float64   // level of the most recent value, in segments
+	level  float64   // displayed level, in segments
+	peak   float64   // peak level, in segments
+	peakAt time.Time // when the peak was reached
+	last   time.Time // when the display was last advanced
+}
+
+func newMeter(cfg meterConfig, n int) *meter {
+	return &meter{cfg: cfg, n: n}
+}
+
+// fraction returns where 'v' falls between the meter's min and max, from 0.0 to 1.0
+func (m *meter) fraction(v float64) float64 {
+	var f float64
+	if m.cfg.scale == "log" {
+		if v <= 0 {
+			return 0
+		}
+		f = math.Log(v/m.cfg.min) / math.Log(m.cfg.max/m.cfg.min)
+	} else {
+		f = (v - m.cfg.min) / (m.cfg.max - m.cfg.min)
+	}
+	return math.Max(0, math.Min(1, f))
+}
+
+// set sets the value the meter is displaying
+func (m *meter) set(v float64) {
+	m.target = m.fraction(v) * float64(m.n)
+}
+
+// advance moves the displayed level and peak forward to 'now'
+func (m *meter) advance(now time.Time) {
+	dt := 0.0
+	if !m.last.IsZero() {
+		dt = now.Sub(m.last).Seconds()
+	}
+	m.last = now
+
+	if m.target >= m.level || m.cfg.decay == 0 {
+		m.level = m.target
+	} else {
+		m.level = math.Max(m.target, m.level-m.cfg.decay*dt)
+	}
+
+	switch {
+	case m.level >= m.peak:
+		m.peak, m.peakAt = m.level, now
+	case now.Sub(m.peakAt) < m.cfg.peakHold:
+		// hold the peak
+	case m.cfg.decay == 0:
+		m.peak = m.level
+	default:
+		m.peak = math.Max(m.level, m.peak-m.cfg.decay*dt)
+	}
+}
+
+// frame returns the bar graph segments for the displayed level and peak
+func (m *meter) frame() frame {
+	f := make(frame, m.n)
+	lit := int(math.Round(m.level))
+	for i := 0; i < lit && i < m.n; i++ {
+		f[i] = segOn
+	}
+	if m.cfg.peakHold > 0 {
+		if p := int(math.Ceil(m.peak)) - 1; p >= 0 && p < m.n {
+			f[p] = segOn
+		}
+	}
+	return f
+}
+
+// runMeter displays the values read from 'cfg.source' on the bar graph until the
+// program is stopped or, for stdin, the input ends.
+func runMeter(ctx context.Context, cfg meterConfig, n int) {
+	values := make(chan float64)
+	go readValues(ctx, cfg, values)
+
+	m := newMeter(cfg, n)
+	ticker := time.NewTicker(meterRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-values:
+			if !ok {
+				return
+			}
+			m.set(v)
+		case now := <-ticker.C:
+			m.advance(now)
+			showFrame(m.frame())
+		}
+	}
+}
+
+// readValues sends the values read from 'cfg.source' to 'values'. Lines on stdin
+// are read as they arrive, 'values' is closed at the end of the input. Files and
+// commands are read every 'cfg.interval', the first number in the file or the
+// command's output is the value. Unreadable values are reported and skipped.
+func readValues(ctx context.Context, cfg meterConfig, values chan<- float64) {
+	send := func(v float64) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case values <- v:
+			return true
+		}
+	}
+
+	if cfg.source == "-" {
+		defer close(values)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			v, err := parseValue(scanner.Text())
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if !send(v) {
+				return
+			}
+		}
+		return
+	}
+
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for {
+		var out []byte
+		var err error
+		if strings.HasPrefix(cfg.source, "exec:") {
+			out, err = exec.Command("sh", "-c", strings.TrimPrefix(cfg.source, "exec:")).Output()
+		} else {
+			out, err = ioutil.ReadFile(cfg.source)
+		}
+
+		if err != nil {
+			fmt.Printf("Error reading %s: %s\n", cfg.source, err)
+		} else if v, err := parseValue(string(out)); err != nil {
+			fmt.Println(err)
+		} else if !send(v) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseValue returns the first number in 's'
+func parseValue(s string) (float64, error) {
+	for _, field := range strings.Fields(s) {
+		if v, err := strconv.ParseFloat(field, 64); err == nil {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("no number found in %q", strings.TrimSpace(s))
+}
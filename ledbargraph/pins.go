@@ -0,0 +1,170 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// wiringPiToBCM maps WiringPi pin numbers to BCM pin numbers for the 40 pin header
+// (WiringPi pins 17 thru 20 were on the P5 header of the original model B).
+var wiringPiToBCM = map[int]int{
+	0: 17, 1: 18, 2: 27, 3: 22, 4: 23, 5: 24, 6: 25, 7: 4, 8: 2, 9: 3,
+	10: 8, 11: 7, 12: 10, 13: 9, 14: 11, 15: 14, 16: 15, 21: 5, 22: 6, 23: 13,
+	24: 19, 25: 26, 26: 12, 27: 16, 28: 20, 29: 21, 30: 0, 31: 1,
+}
+
+// physicalToBCM maps physical header pin numbers to BCM pin numbers. Header pins
+// that are power or ground aren't included.
+var physicalToBCM = map[int]int{
+	3: 2, 5: 3, 7: 4, 8: 14, 10: 15, 11: 17, 12: 18, 13: 27, 15: 22, 16: 23,
+	18: 24, 19: 10, 21: 9, 22: 25, 23: 11, 24: 8, 26: 7, 27: 0, 28: 1, 29: 5,
+	31: 6, 32: 12, 33: 13, 35: 19, 36: 16, 37: 26, 38: 20, 40: 21,
+}
+
+// reservedPins are BCM pins that are normally used by a peripheral. Using them for
+// the bar graph works, but the peripheral can't be used at the same time.
+var reservedPins = map[int]string{
+	0:  "ID EEPROM SDA",
+	1:  "ID EEPROM SCL",
+	2:  "I2C1 SDA",
+	3:  "I2C1 SCL",
+	7:  "SPI0 CE1",
+	8:  "SPI0 CE0",
+	9:  "SPI0 MISO",
+	10: "SPI0 MOSI",
+	11: "SPI0 SCLK",
+	14: "UART TXD",
+	15: "UART RXD",
+}
+
+// activeLow is true when the bar graph is wired so that setting a pin LOW lights
+// its segment, which is how the SunFounder kit is wired.
+var activeLow = true
+
+// pinConfig describes how the bar graph is wired
+type pinConfig struct {
+	pins      string // comma separated list of pins, bottom segment first
+	numbering string // 'bcm', 'wpi' (WiringPi), or 'phys' (physical header pin)
+	active    string // 'low' or 'high', the level that lights a segment
+	strict    bool   // reject reserved pins rather than warning about them
+}
+
+// readPinConfig reads settings from a file of 'key = value' lines, where key is
+// 'pins', 'numbering', 'active', or 'strict'. Blank lines and lines starting with
+// '#' are ignored. Settings in the file replace the ones in 'cfg'.
+func readPinConfig(path string, cfg pinConfig) (pinConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return cfg, fmt.Errorf("%s line %d: expected 'key = value', got %q", path, lineNum, line)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "pins":
+			cfg.pins = value
+		case "numbering":
+			cfg.numbering = value
+		case "active":
+			cfg.active = value
+		case "strict":
+			if cfg.strict, err = strconv.ParseBool(value); err != nil {
+				return cfg, fmt.Errorf("%s line %d: invalid strict value %q", path, lineNum, value)
+			}
+		default:
+			return cfg, fmt.Errorf("%s line %d: unknown setting %q", path, lineNum, key)
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+// resolve returns the BCM pin numbers for the bar graph's segments. Duplicate and
+// invalid pins are errors. Reserved pins are reported as warnings, or as errors
+// when 'cfg.strict' is set.
+func (cfg pinConfig) resolve() (bcmPins []int, warnings []string, err error) {
+	var mapping map[int]int
+	switch cfg.numbering {
+	case "bcm":
+	case "wpi":
+		mapping = wiringPiToBCM
+	case "phys":
+		mapping = physicalToBCM
+	default:
+		return nil, nil, fmt.Errorf("invalid pin numbering %q, must be 'bcm', 'wpi', or 'phys'", cfg.numbering)
+	}
+
+	if cfg.active != "low" && cfg.active != "high" {
+		return nil, nil, fmt.Errorf("invalid active level %q, must be 'low' or 'high'", cfg.active)
+	}
+
+	used := map[int]string{}
+	for _, field := range strings.Split(cfg.pins, ",") {
+		field = strings.TrimSpace(field)
+		pin, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pin %q", field)
+		}
+
+		bcm := pin
+		if mapping != nil {
+			var ok bool
+			if bcm, ok = mapping[pin]; !ok {
+				return nil, nil, fmt.Errorf("%s pin %d isn't a GPIO pin", cfg.numbering, pin)
+			}
+		} else if pin < 0 || pin > 27 {
+			return nil, nil, fmt.Errorf("BCM pin %d isn't on the 40 pin header, must be 0 thru 27", pin)
+		}
+
+		if prev, ok := used[bcm]; ok {
+			if mapping == nil {
+				return nil, nil, fmt.Errorf("BCM pin %d is used more than once", bcm)
+			}
+			return nil, nil, fmt.Errorf("%s pins %s and %s are both BCM pin %d", cfg.numbering, prev, field, bcm)
+		}
+		used[bcm] = field
+
+		if use, ok := reservedPins[bcm]; ok {
+			msg := fmt.Sprintf("BCM pin %d is reserved for %s", bcm, use)
+			if cfg.strict {
+				return nil, nil, fmt.Errorf("%s", msg)
+			}
+			warnings = append(warnings, msg)
+		}
+		bcmPins = append(bcmPins, bcm)
+	}
+
+	return bcmPins, warnings, nil
+}
+
+// setSegment lights or darkens the segment attached to 'pin' according to how the
+// bar graph is wired.
+func setSegment(pin gpio.Pin, on bool) {
+	if on == activeLow {
+		pin.Low()
+	} else {
+		pin.High()
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// spinThreshold is the shortest wait that's done with time.Sleep(). The scheduler
+// spins for shorter waits since sleeping overshoots by tens of microseconds, which
+// would make the dimmest levels flicker or disappear.
+const spinThreshold = 200 * time.Microsecond
+
+// pwm is the software PWM scheduler driving the bar graph, nil when '-pwm' isn't used
+var pwm *softPWM
+
+// softPWM varies the brightness of a set of pins from a single timing loop. The
+// pins with a brightness greater than 0 are turned on at the start of each period
+// and each one is turned off when its share of the period has elapsed. Since the
+// pins are sorted by on time there are at most len(pins)+1 waits per period no matter
+// how many brightness levels there are, unlike the pwmdemo/dimled approach of one
+// loop per pin.
+type softPWM struct {
+	pins   []gpio.Pin
+	period time.Duration
+	gamma  float64
+
+	mu     sync.Mutex
+	levels []uint8
+
+	stop chan interface{}
+	done chan interface{}
+}
+
+// newSoftPWM returns a scheduler for 'pins' with a PWM frequency of 'freq' Hz.
+// 'gamma' corrects the brightness levels for the eye's non-linear response, a
+// level of 128 looks about half as bright as 255 with a gamma of 2.2. Use a gamma
+// of 1 for no correction.
+func newSoftPWM(pins []gpio.Pin, freq int, gamma float64) *softPWM {
+	return &softPWM{
+		pins:   pins,
+		period: time.Second / time.Duration(freq),
+		gamma:  gamma,
+		levels: make([]uint8, len(pins)),
+		stop:   make(chan interface{}),
+		done:   make(chan interface{}),
+	}
+}
+
+// set sets the brightness of each pin, it takes effect at the start of the next period
+func (p *softPWM) set(levels []uint8) {
+	p.mu.Lock()
+	copy(p.levels, levels)
+	p.mu.Unlock()
+}
+
+// start runs the timing loop in its own goroutine. The goroutine is locked to an OS
+// thread so the Go scheduler doesn't move it around between periods.
+func (p *softPWM) start() {
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer close(p.done)
+
+		type offTime struct {
+			pin int
+			at  time.Duration
+		}
+		offs := make([]offTime, 0, len(p.pins))
+
+		for {
+			select {
+			case <-p.stop:
+				for _, pin := range p.pins {
+					setSegment(pin, false)
+				}
+				return
+			default:
+			}
+
+			offs = offs[:0]
+			p.mu.Lock()
+			for i, level := range p.levels {
+				duty := math.Pow(float64(level)/float64(segOn), p.gamma)
+				offs = append(offs, offTime{pin: i, at: time.Duration(duty * float64(p.period))})
+			}
+			p.mu.Unlock()
+			sort.Slice(offs, func(i, j int) bool { return offs[i].at < offs[j].at })
+
+			start := time.Now()
+			for _, off := range offs {
+				setSegment(p.pins[off.pin], off.at > 0)
+			}
+			for _, off := range offs {
+				if off.at == 0 || off.at >= p.period {
+					continue
+				}
+				waitUntil(start.Add(off.at))
+				setSegment(p.pins[off.pin], false)
+			}
+			waitUntil(start.Add(p.period))
+		}
+	}()
+}
+
+// close stops the timing loop and turns all of the pins off
+func (p *softPWM) close() {
+	close(p.stop)
+	<-p.done
+}
+
+// waitUntil returns at time 't', sleeping if 't' is far enough away and spinning otherwise
+func waitUntil(t time.Time) {
+	for {
+		d := time.Until(t)
+		if d <= 0 {
+			return
+		}
+		if d > spinThreshold {
+			time.Sleep(d - spinThreshold)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sysmonSample is how often the system metrics are read
+	sysmonSample = time.Second
+	// sysmonBlink is how often the top segments toggle when a metric is critical
+	sysmonBlink = 250 * time.Millisecond
+	// sysmonBlinkSegments is the number of top segments that blink when a metric is critical
+	sysmonBlinkSegments = 2
+	// sysmonIdent is how long the segment identifying a metric is shown when the
+	// display rotates to it
+	sysmonIdent = 500 * time.Millisecond
+)
+
+// sysmonConfig contains the settings for the system monitor mode
+type sysmonConfig struct {
+	metrics  string        // comma separated list of metrics to display
+	rotate   time.Duration // how long each metric is displayed
+	critical string        // comma separated 'metric=value' critical thresholds
+	procRoot string        // normally /proc, can be changed to test against fixture files
+	sysRoot  string        // normally /sys
+}
+
+// metric is a system resource that can be displayed on the bar graph
+type metric struct {
+	name     string
+	min, max float64 // values that light no segments and all segments respectively
+	critical float64 // values at or above this blink the top segments
+	read     func(*sysMonitor) (float64, error)
+}
+
+// sysMonitor reads system metrics from the proc and sys file systems
+type sysMonitor struct {
+	procRoot, sysRoot string
+	// prevBusy and prevTotal are the CPU times from the previous read of /proc/stat,
+	// CPU utilization is the change in busy time over the change in total time.
+	prevBusy, prevTotal uint64
+}
+
+// newMetrics returns the metrics named in 'cfg.metrics' with their critical
+// thresholds. The load average is scaled to the number of CPUs, a load equal to
+// the number of CPUs lights all of the segments.
+func newMetrics(cfg sysmonConfig, mon *sysMonitor) ([]metric, error) {
+	cpus, err := mon.cpuCount()
+	if err != nil {
+		return nil, err
+	}
+	available := map[string]metric{
+		"cpu":  {name: "cpu", min: 0, max: 100, critical: 90, read: (*sysMonitor).cpuPercent},
+		"mem":  {name: "mem", min: 0, max: 100, critical: 90, read: (*sysMonitor).memPercent},
+		"temp": {name: "temp", min: 30, max: 85, critical: 75, read: (*sysMonitor).temperature},
+		"load": {name: "load", min: 0, max: float64(cpus), critical: float64(cpus), read: (*sysMonitor).loadAverage},
+	}
+
+	metrics := []metric{}
+	for _, name := range strings.Split(cfg.metrics, ",") {
+		m, ok := available[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown metric %q, must be one of cpu, mem, temp, or load", name)
+		}
+		metrics = append(metrics, m)
+	}
+
+	if cfg.critical != "" {
+		for _, threshold := range strings.Split(cfg.critical, ",") {
+			parts := strings.SplitN(threshold, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid critical threshold %q, expected 'metric=value'", threshold)
+			}
+			v, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid critical threshold %q: %s", threshold, err)
+			}
+			found := false
+			for i := range metrics {
+				if metrics[i].name == strings.TrimSpace(parts[0]) {
+					metrics[i].critical, found = v, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("critical threshold %q is for a metric that isn't displayed", threshold)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+// runSysmon displays system metrics on the bar graph, rotating between them every
+// 'cfg.rotate', until the program is stopped.
+func runSysmon(ctx context.Context, cfg sysmonConfig, n int) error {
+	mon := &sysMonitor{procRoot: cfg.procRoot, sysRoot: cfg.sysRoot}
+	metrics, err := newMetrics(cfg, mon)
+	if err != nil {
+		return err
+	}
+
+	// The first CPU reading only establishes a baseline
+	if _, err := mon.cpuPercent(); err != nil {
+		return err
+	}
+
+	meters := make([]*meter, len(metrics))
+	values := make([]float64, len(metrics))
+	for i, m := range metrics {
+		meters[i] = newMeter(meterConfig{min: m.min, max: m.max, scale: "linear"}, n)
+	}
+
+	sample := func() {
+		for i, m := range metrics {
+			v, err := m.read(mon)
+			if err != nil {
+				fmt.Printf("Error reading %s: %s\n", m.name, err)
+				continue
+			}
+			values[i] = v
+			meters[i].set(v)
+		}
+	}
+	sample()
+
+	current := 0
+	rotatedAt := time.Now()
+	sampleTicker := time.NewTicker(sysmonSample)
+	defer sampleTicker.Stop()
+	blinkTicker := time.NewTicker(sysmonBlink)
+	defer blinkTicker.Stop()
+	blinkOn := false
+
+	for {
+		now := time.Now()
+		if len(metrics) > 1 && now.Sub(rotatedAt) >= cfg.rotate {
+			current = (current + 1) % len(metrics)
+			rotatedAt = now
+		}
+
+		// Identify the metric by lighting its segment (cpu is the bottom segment,
+		// mem the next, and so on in the order given) before displaying it.
+		var f frame
+		if len(metrics) > 1 && now.Sub(rotatedAt) < sysmonIdent {
+			f = single(n, current%n)
+		} else {
+			meters[current].advance(now)
+			f = meters[current].frame()
+			if values[current] >= metrics[current].critical {
+				for i := n - sysmonBlinkSegments; i < n; i++ {
+					if i >= 0 {
+						f[i] = segOff
+						if blinkOn {
+							f[i] = segOn
+						}
+					}
+				}
+			}
+		}
+		showFrame(f)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sampleTicker.C:
+			sample()
+		case <-blinkTicker.C:
+			blinkOn = !blinkOn
+		}
+	}
+}
+
+// cpuCount returns the number of CPUs listed in /proc/stat
+func (mon *sysMonitor) cpuCount() (int, error) {
+	lines, err := readLines(filepath.Join(mon.procRoot, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "cpu") && !strings.HasPrefix(line, "cpu ") {
+			count++
+		}
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count, nil
+}
+
+// cpuPercent returns the percentage of CPU time spent doing work since the
+// previous call. The first call returns the utilization since boot.
+func (mon *sysMonitor) cpuPercent() (float64, error) {
+	lines, err := readLines(filepath.Join(mon.procRoot, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "cpu ") {
+		return 0, fmt.Errorf("%s/stat has no aggregate cpu line", mon.procRoot)
+	}
+
+	// cpu user nice system idle iowait irq softirq steal ...
+	fields := strings.Fields(lines[0])[1:]
+	var total, idle uint64
+	for i, field := range fields {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpu time %q in %s/stat", field, mon.procRoot)
+		}
+		// guest time is already included in user time
+		if i < 8 {
+			total += v
+		}
+		if i == 3 || i == 4 { // idle and iowait
+			idle += v
+		}
+	}
+	busy := total - idle
+
+	// The counters can go backwards, iowait in particular isn't guaranteed to only
+	// increase, so the changes are signed and negative changes are treated as none
+	deltaBusy := clampDelta(int64(busy - mon.prevBusy))
+	deltaTotal := clampDelta(int64(total - mon.prevTotal))
+	mon.prevBusy, mon.prevTotal = busy, total
+	if deltaTotal == 0 {
+		return 0, nil
+	}
+	if deltaBusy > deltaTotal {
+		deltaBusy = deltaTotal
+	}
+	return float64(deltaBusy) / float64(deltaTotal) * 100, nil
+}
+
+// clampDelta returns 'd', or 0 if it's negative
+func clampDelta(d int64) int64 {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// memPercent returns the percentage of memory in use
+func (mon *sysMonitor) memPercent() (float64, error) {
+	lines, err := readLines(filepath.Join(mon.procRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	info := map[string]float64{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			info[strings.TrimSuffix(fields[0], ":")] = v
+		}
+	}
+
+	total := info["MemTotal"]
+	if total == 0 {
+		return 0, fmt.Errorf("%s/meminfo has no MemTotal", mon.procRoot)
+	}
+	available, ok := info["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 don't report MemAvailable
+		available = info["MemFree"] + info["Buffers"] + info["Cached"]
+	}
+	return (total - available) / total * 100, nil
+}
+
+// temperature returns the temperature in degrees Celsius of the first thermal
+// zone, which on a Raspberry Pi is the SoC.
+func (mon *sysMonitor) temperature() (float64, error) {
+	path := filepath.Join(mon.sysRoot, "class", "thermal", "thermal_zone0", "temp")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	milliC, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature %q in %s", strings.TrimSpace(string(data)), path)
+	}
+	return milliC / 1000, nil
+}
+
+// loadAverage returns the 1 minute load average
+func (mon *sysMonitor) loadAverage() (float64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(mon.procRoot, "loadavg"))
+	if err != nil {
+		return 0, err
+	}
+	return parseValue(string(data))
+}
+
+// readLines returns the lines in the file at 'path'
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
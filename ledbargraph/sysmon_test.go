@@ -0,0 +1,227 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture is a fake proc and sys file system tree
+type fixture struct {
+	t    *testing.T
+	root string
+}
+
+func newFixture(t *testing.T) *fixture {
+	return &fixture{t: t, root: t.TempDir()}
+}
+
+// write writes 'contents' to file 'name', relative to the root of the tree
+func (f *fixture) write(name, contents string) {
+	path := filepath.Join(f.root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fixture) monitor() *sysMonitor {
+	return &sysMonitor{procRoot: filepath.Join(f.root, "proc"), sysRoot: filepath.Join(f.root, "sys")}
+}
+
+func TestCPUPercent(t *testing.T) {
+	// cpu user nice system idle iowait irq softirq steal guest guest_nice
+	tests := []struct {
+		name  string
+		stats []string
+		want  []float64
+	}{
+		{
+			name:  "since boot",
+			stats: []string{"cpu  100 0 100 700 100 0 0 0 0 0"},
+			want:  []float64{20},
+		},
+		{
+			name: "busy",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  175 0 100 725 100 0 0 0 0 0",
+			},
+			want: []float64{20, 75},
+		},
+		{
+			name: "guest time isn't counted twice",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  150 0 100 750 100 0 0 0 50 0",
+			},
+			want: []float64{20, 50},
+		},
+		{
+			name: "idle",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+			},
+			want: []float64{20, 0},
+		},
+		{
+			name: "iowait goes backwards",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  150 0 100 760 90 0 0 0 0 0",
+			},
+			want: []float64{20, 50},
+		},
+		{
+			name: "busy goes backwards",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  100 0 90 720 100 0 0 0 0 0",
+				"cpu  150 0 90 770 100 0 0 0 0 0",
+			},
+			want: []float64{20, 0, 50},
+		},
+		{
+			name: "total goes backwards",
+			stats: []string{
+				"cpu  100 0 100 700 100 0 0 0 0 0",
+				"cpu  100 0 100 700 50 0 0 0 0 0",
+				"cpu  120 0 100 780 50 0 0 0 0 0",
+			},
+			want: []float64{20, 0, 20},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			mon := f.monitor()
+			for i, stat := range tc.stats {
+				f.write("proc/stat", stat+"\ncpu0 0 0 0 0 0 0 0 0 0 0\n")
+				got, err := mon.cpuPercent()
+				if err != nil {
+					t.Fatalf("read %d: unexpected error %s", i, err)
+				}
+				if math.Abs(got-tc.want[i]) > 1e-9 {
+					t.Errorf("read %d: got %g%%, want %g%%", i, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCPUPercentErrors(t *testing.T) {
+	tests := []struct {
+		name, stat string
+	}{
+		{name: "no aggregate line", stat: "cpu0 1 2 3 4\n"},
+		{name: "invalid time", stat: "cpu  1 2 x 4\n"},
+		{name: "negative time", stat: "cpu  1 2 -3 4\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.write("proc/stat", tc.stat)
+			if _, err := f.monitor().cpuPercent(); err == nil {
+				t.Errorf("expected an error for %q", tc.stat)
+			}
+		})
+	}
+}
+
+func TestMemPercent(t *testing.T) {
+	tests := []struct {
+		name, meminfo string
+		want          float64
+		wantErr       bool
+	}{
+		{
+			name:    "available",
+			meminfo: "MemTotal:        1000 kB\nMemFree:          100 kB\nMemAvailable:     250 kB\nBuffers:           50 kB\nCached:           100 kB\n",
+			want:    75,
+		},
+		{
+			name:    "no MemAvailable",
+			meminfo: "MemTotal:        1000 kB\nMemFree:          100 kB\nBuffers:           50 kB\nCached:           100 kB\n",
+			want:    75,
+		},
+		{
+			name:    "no MemTotal",
+			meminfo: "MemFree:          100 kB\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.write("proc/meminfo", tc.meminfo)
+			got, err := f.monitor().memPercent()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %g%%", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %g%%, want %g%%", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSysmonMetrics(t *testing.T) {
+	f := newFixture(t)
+	f.write("proc/stat", "cpu  1 0 1 8 0 0 0 0 0 0\ncpu0 1 0 1 8 0 0 0 0 0 0\ncpu1 0 0 0 0 0 0 0 0 0 0\n")
+	f.write("proc/loadavg", "1.50 0.75 0.25 2/345 6789\n")
+	f.write("sys/class/thermal/thermal_zone0/temp", "48312\n")
+	mon := f.monitor()
+
+	metrics, err := newMetrics(sysmonConfig{metrics: "temp,load", critical: "temp=70"}, mon)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2", len(metrics))
+	}
+	if metrics[0].critical != 70 {
+		t.Errorf("temp critical threshold is %g, want 70", metrics[0].critical)
+	}
+	// The load average is scaled to the number of CPUs
+	if metrics[1].max != 2 {
+		t.Errorf("load max is %g, want 2 for 2 CPUs", metrics[1].max)
+	}
+
+	if temp, err := mon.temperature(); err != nil || temp != 48.312 {
+		t.Errorf("got temperature %g, %v, want 48.312", temp, err)
+	}
+	if load, err := mon.loadAverage(); err != nil || load != 1.5 {
+		t.Errorf("got load average %g, %v, want 1.5", load, err)
+	}
+
+	for _, cfg := range []sysmonConfig{
+		{metrics: "cpu,disk"},
+		{metrics: "cpu", critical: "cpu"},
+		{metrics: "cpu", critical: "cpu=high"},
+		{metrics: "cpu", critical: "mem=50"},
+	} {
+		if _, err := newMetrics(cfg, mon); err == nil {
+			t.Errorf("expected an error for metrics %q, critical %q", cfg.metrics, cfg.critical)
+		}
+	}
+}
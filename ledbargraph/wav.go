@@ -0,0 +1,166 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// WAV format codes for integer PCM samples
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xfffe
+)
+
+// wavSubFormatPCM is the SubFormat GUID of a WAVE_FORMAT_EXTENSIBLE file's integer
+// PCM samples, KSDATAFORMAT_SUBTYPE_PCM, as it's stored in the file
+var wavSubFormatPCM = []byte{
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00,
+	0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71,
+}
+
+// wavFmtSize is the size of a WAVE_FORMAT_EXTENSIBLE fmt chunk, the largest fmt
+// chunk that's used. Anything after that is skipped.
+const wavFmtSize = 40
+
+// The largest PCM formats that are decoded, well beyond what audio hardware uses
+const (
+	maxSampleRate = 384000
+	maxChannels   = 32
+)
+
+// pcmFormat describes a stream of interleaved little endian integer PCM samples
+type pcmFormat struct {
+	sampleRate int
+	channels   int
+	bits       int // bits per sample, 8 (unsigned), 16, 24, or 32 (signed)
+}
+
+// validate checks that the format is one that can be decoded
+func (f pcmFormat) validate() error {
+	if f.sampleRate <= 0 || f.sampleRate > maxSampleRate {
+		return fmt.Errorf("invalid PCM sample rate %d, must be greater than 0 and at most %d", f.sampleRate, maxSampleRate)
+	}
+	if f.channels <= 0 || f.channels > maxChannels {
+		return fmt.Errorf("invalid PCM channel count %d, must be greater than 0 and at most %d", f.channels, maxChannels)
+	}
+	switch f.bits {
+	case 8, 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("unsupported PCM sample size %d bits, must be 8, 16, 24, or 32", f.bits)
+	}
+}
+
+// frameSize is the number of bytes in one sample for every channel
+func (f pcmFormat) frameSize() int {
+	return f.channels * f.bits / 8
+}
+
+// sample decodes the sample at the start of 'b' to a value between -1.0 and 1.0
+func (f pcmFormat) sample(b []byte) float64 {
+	switch f.bits {
+	case 8:
+		return (float64(b[0]) - 128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+// readWAVHeader reads a RIFF WAVE header from 'r', leaving 'r' positioned at the
+// start of the sample data. It returns the sample format and a reader limited to
+// the sample data.
+func readWAVHeader(r io.Reader) (pcmFormat, io.Reader, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return pcmFormat{}, nil, fmt.Errorf("error reading WAV header: %s", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return pcmFormat{}, nil, fmt.Errorf("not a WAV file")
+	}
+
+	var format pcmFormat
+	haveFormat := false
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return pcmFormat{}, nil, fmt.Errorf("WAV file has no data chunk: %s", err)
+		}
+		id, size := string(hdr[0:4]), int64(binary.LittleEndian.Uint32(hdr[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return pcmFormat{}, nil, fmt.Errorf("WAV fmt chunk is too short")
+			}
+			// The size comes from the file, so only as much as is needed is read
+			n := size
+			if n > wavFmtSize {
+				n = wavFmtSize
+			}
+			chunk := make([]byte, n)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return pcmFormat{}, nil, fmt.Errorf("error reading WAV fmt chunk: %s", err)
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, size-n); err != nil {
+				return pcmFormat{}, nil, fmt.Errorf("error reading WAV fmt chunk: %s", err)
+			}
+			code := binary.LittleEndian.Uint16(chunk[0:2])
+			switch code {
+			case wavFormatPCM:
+			case wavFormatExtensible:
+				if len(chunk) < wavFmtSize {
+					return pcmFormat{}, nil, fmt.Errorf("WAV fmt chunk is too short for WAVE_FORMAT_EXTENSIBLE")
+				}
+				if !bytes.Equal(chunk[24:40], wavSubFormatPCM) {
+					return pcmFormat{}, nil, fmt.Errorf("unsupported WAV sub-format %x, only integer PCM is supported", chunk[24:40])
+				}
+			default:
+				return pcmFormat{}, nil, fmt.Errorf("unsupported WAV format code %#x, only integer PCM is supported", code)
+			}
+			format = pcmFormat{
+				channels:   int(binary.LittleEndian.Uint16(chunk[2:4])),
+				sampleRate: int(binary.LittleEndian.Uint32(chunk[4:8])),
+				bits:       int(binary.LittleEndian.Uint16(chunk[14:16])),
+			}
+			if err := format.validate(); err != nil {
+				return pcmFormat{}, nil, err
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return pcmFormat{}, nil, fmt.Errorf("WAV data chunk precedes the fmt chunk")
+			}
+			// Streaming encoders that don't know the length in advance write a size
+			// of 0 or 0xffffffff, in which case the data runs to the end of the file.
+			if size == 0 || size == 0xffffffff {
+				return format, r, nil
+			}
+			return format, io.LimitReader(r, size), nil
+		default:
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return pcmFormat{}, nil, fmt.Errorf("error skipping WAV %q chunk: %s", id, err)
+			}
+		}
+
+		// Chunks are padded to an even length
+		if id == "fmt " && size%2 == 1 {
+			if _, err := io.CopyN(ioutil.Discard, r, 1); err != nil {
+				return pcmFormat{}, nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// wavChunk returns a RIFF chunk, padded to an even length
+func wavChunk(id string, data []byte) []byte {
+	chunk := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// wavFmt returns the contents of a PCM fmt chunk
+func wavFmt(code uint16, channels uint16, rate uint32, bits uint16) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:], code)
+	binary.LittleEndian.PutUint16(b[2:], channels)
+	binary.LittleEndian.PutUint32(b[4:], rate)
+	binary.LittleEndian.PutUint32(b[8:], rate*uint32(channels)*uint32(bits/8))
+	binary.LittleEndian.PutUint16(b[12:], channels*(bits/8))
+	binary.LittleEndian.PutUint16(b[14:], bits)
+	return b
+}
+
+// wavExtensible returns the contents of a WAVE_FORMAT_EXTENSIBLE fmt chunk
+func wavExtensible(channels uint16, rate uint32, bits uint16, subFormat []byte) []byte {
+	b := wavFmt(wavFormatExtensible, channels, rate, bits)
+	ext := make([]byte, 8)
+	binary.LittleEndian.PutUint16(ext[0:], 22)
+	binary.LittleEndian.PutUint16(ext[2:], bits)
+	return append(append(b, ext...), subFormat...)
+}
+
+// wavFile returns a WAV file made up of 'chunks'
+func wavFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return wavChunk("RIFF", body)
+}
+
+func TestReadWAVHeader(t *testing.T) {
+	samples := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	cd := wavFmt(wavFormatPCM, 2, 44100, 16)
+	oddFmt := append(wavFmt(wavFormatPCM, 1, 8000, 8), 0xaa)
+	hugeFmt := wavChunk("fmt ", wavFmt(wavFormatPCM, 2, 44100, 16))
+	binary.LittleEndian.PutUint32(hugeFmt[4:], 0xfffffff0)
+	streamed := wavChunk("data", samples)
+	binary.LittleEndian.PutUint32(streamed[4:], 0xffffffff)
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    pcmFormat
+		data    []byte
+		wantErr string
+	}{
+		{
+			name: "PCM",
+			file: wavFile(wavChunk("fmt ", cd), wavChunk("data", samples)),
+			want: pcmFormat{sampleRate: 44100, channels: 2, bits: 16},
+			data: samples,
+		},
+		{
+			name: "data is limited to its chunk",
+			file: wavFile(wavChunk("fmt ", cd), wavChunk("data", samples[:4]), wavChunk("LIST", samples)),
+			want: pcmFormat{sampleRate: 44100, channels: 2, bits: 16},
+			data: samples[:4],
+		},
+		{
+			name: "streamed data runs to the end of the file",
+			file: wavFile(wavChunk("fmt ", cd), streamed),
+			want: pcmFormat{sampleRate: 44100, channels: 2, bits: 16},
+			data: samples,
+		},
+		{
+			name: "other chunks are skipped",
+			file: wavFile(wavChunk("LIST", []byte("odd")), wavChunk("fmt ", cd), wavChunk("fact", samples[:4]), wavChunk("data", samples)),
+			want: pcmFormat{sampleRate: 44100, channels: 2, bits: 16},
+			data: samples,
+		},
+		{
+			name: "odd sized fmt chunk",
+			file: wavFile(wavChunk("fmt ", oddFmt), wavChunk("data", samples)),
+			want: pcmFormat{sampleRate: 8000, channels: 1, bits: 8},
+			data: samples,
+		},
+		{
+			name: "extensible",
+			file: wavFile(wavChunk("fmt ", wavExtensible(6, 48000, 24, wavSubFormatPCM)), wavChunk("data", samples)),
+			want: pcmFormat{sampleRate: 48000, channels: 6, bits: 24},
+			data: samples,
+		},
+		{
+			name: "most channels at the highest rate",
+			file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, maxChannels, maxSampleRate, 32)), wavChunk("data", samples)),
+			want: pcmFormat{sampleRate: maxSampleRate, channels: maxChannels, bits: 32},
+			data: samples,
+		},
+		{name: "empty", file: nil, wantErr: "error reading WAV header"},
+		{name: "truncated RIFF header", file: []byte("RIFF\x00\x00"), wantErr: "error reading WAV header"},
+		{name: "not RIFF", file: append([]byte("RIFX\x00\x00\x00\x00WAVE"), wavChunk("fmt ", cd)...), wantErr: "not a WAV file"},
+		{name: "not WAVE", file: append([]byte("RIFF\x00\x00\x00\x00AVI "), wavChunk("fmt ", cd)...), wantErr: "not a WAV file"},
+		{name: "no chunks", file: wavFile(), wantErr: "no data chunk"},
+		{name: "no data chunk", file: wavFile(wavChunk("fmt ", cd)), wantErr: "no data chunk"},
+		{name: "truncated chunk header", file: wavFile(wavChunk("fmt ", cd), []byte("da")), wantErr: "no data chunk"},
+		{name: "data before fmt", file: wavFile(wavChunk("data", samples), wavChunk("fmt ", cd)), wantErr: "precedes the fmt chunk"},
+		{name: "short fmt chunk", file: wavFile(wavChunk("fmt ", cd[:14]), wavChunk("data", samples)), wantErr: "too short"},
+		{name: "truncated fmt chunk", file: wavFile(wavChunk("fmt ", cd))[:30], wantErr: "error reading WAV fmt chunk"},
+		{name: "oversized fmt chunk", file: wavFile(hugeFmt, wavChunk("data", samples)), wantErr: "error reading WAV fmt chunk"},
+		{name: "truncated skipped chunk", file: wavFile(wavChunk("fmt ", cd), wavChunk("LIST", samples))[:50], wantErr: "error skipping WAV \"LIST\" chunk"},
+		{name: "float samples", file: wavFile(wavChunk("fmt ", wavFmt(3, 2, 44100, 32)), wavChunk("data", samples)), wantErr: "unsupported WAV format code 0x3"},
+		{name: "short extensible", file: wavFile(wavChunk("fmt ", wavExtensible(2, 44100, 16, wavSubFormatPCM)[:30]), wavChunk("data", samples)), wantErr: "too short for WAVE_FORMAT_EXTENSIBLE"},
+		{name: "float extensible", file: wavFile(wavChunk("fmt ", wavExtensible(2, 44100, 32, append([]byte{3}, wavSubFormatPCM[1:]...))), wavChunk("data", samples)), wantErr: "unsupported WAV sub-format"},
+		{name: "no channels", file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, 0, 44100, 16)), wavChunk("data", samples)), wantErr: "invalid PCM channel count 0"},
+		{name: "too many channels", file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, 0xffff, 44100, 16)), wavChunk("data", samples)), wantErr: "invalid PCM channel count 65535"},
+		{name: "no sample rate", file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, 2, 0, 16)), wavChunk("data", samples)), wantErr: "invalid PCM sample rate 0"},
+		{name: "sample rate too high", file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, 2, 0xffffffff, 16)), wavChunk("data", samples)), wantErr: "invalid PCM sample rate 4294967295"},
+		{name: "unsupported sample size", file: wavFile(wavChunk("fmt ", wavFmt(wavFormatPCM, 2, 44100, 12)), wavChunk("data", samples)), wantErr: "unsupported PCM sample size 12 bits"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			format, r, err := readWAVHeader(bytes.NewReader(tc.file))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if format != tc.want {
+				t.Errorf("got format %+v, want %+v", format, tc.want)
+			}
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tc.data) {
+				t.Errorf("got data %v, want %v", data, tc.data)
+			}
+		})
+	}
+}
+
+func TestPCMSample(t *testing.T) {
+	tests := []struct {
+		bits int
+		b    []byte
+		want float64
+	}{
+		{bits: 8, b: []byte{0x80}, want: 0},
+		{bits: 8, b: []byte{0x00}, want: -1},
+		{bits: 8, b: []byte{0xc0}, want: 0.5},
+		{bits: 16, b: []byte{0x00, 0x40}, want: 0.5},
+		{bits: 16, b: []byte{0x00, 0x80}, want: -1},
+		{bits: 24, b: []byte{0x00, 0x00, 0xc0}, want: -0.5},
+		{bits: 24, b: []byte{0x00, 0x00, 0x40}, want: 0.5},
+		{bits: 32, b: []byte{0x00, 0x00, 0x00, 0x80}, want: -1},
+		{bits: 32, b: []byte{0x00, 0x00, 0x00, 0x40}, want: 0.5},
+	}
+
+	for _, tc := range tests {
+		f := pcmFormat{sampleRate: 8000, channels: 1, bits: tc.bits}
+		if got := f.sample(tc.b); got != tc.want {
+			t.Errorf("%d bits % x: got %g, want %g", tc.bits, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package bcm controls the Raspberry Pi's GPIO pins and SPI0 interface by reading and
+// writing the BCM2835 (and BCM2836/7, BCM2711) peripheral registers directly. It's a
+// Go port of ledblink/bcmfuncs.c, which in turn is a cut down version of Mike
+// McCauley's BCM2835 C library (https://www.airspayce.com/mikem/bcm2835/index.html).
+// Like bcmfuncs.c it's meant to show how the hardware is programmed, the register
+// offsets and bit layouts come from the BCM2835 datasheet at
+// https://www.raspberrypi.org/app/uploads/2012/02/BCM2835-ARM-Peripherals.pdf.
+//
+// Open maps the registers from /dev/mem, or /dev/gpiomem when not running as root,
+// in which case only the GPIO registers are available. NewFake returns a Board whose
+// registers are ordinary memory so that the bit manipulation can be tested without
+// a Raspberry Pi.
+package bcm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Offsets of the GPIO registers from the start of the GPIO register block, in bytes,
+// per section 6.1 of the datasheet. Each register is 32 bits.
+const (
+	GPFSEL0   = 0x00 // GPIO Function Select 0, pins 0-9, 10 more pins per register after that
+	GPSET0    = 0x1c // GPIO Pin Output Set 0, pins 0-31
+	GPCLR0    = 0x28 // GPIO Pin Output Clear 0, pins 0-31
+	GPLEV0    = 0x34 // GPIO Pin Level 0, pins 0-31
+	GPPUD     = 0x94 // GPIO Pin Pull-up/down Enable, BCM2835 thru BCM2837
+	GPPUDCLK0 = 0x98 // GPIO Pin Pull-up/down Enable Clock 0, BCM2835 thru BCM2837
+	GPPUPPDN0 = 0xe4 // GPIO Pull-up/down Register 0, BCM2711 (RPi 4) only, pins 0-15
+)
+
+// gpioMemSize is the size of the GPIO register block
+const gpioMemSize = 4096
+
+// Function is a pin's function, the values are the 3 bit function select codes
+type Function uint32
+
+// Pin functions
+const (
+	Input  Function = 0x0 // 0b000
+	Output Function = 0x1 // 0b001
+	Alt0   Function = 0x4 // 0b100
+	Alt1   Function = 0x5 // 0b101
+	Alt2   Function = 0x6 // 0b110
+	Alt3   Function = 0x7 // 0b111
+	Alt4   Function = 0x3 // 0b011
+	Alt5   Function = 0x2 // 0b010
+
+	fselMask = 0x7 // function select bits mask 0b111
+)
+
+// Pull is a pin's pull-up/down resistor setting
+type Pull uint32
+
+// Pull settings, the values are the BCM2835's GPPUD codes. The BCM2711 swaps the codes
+// for up and down, see SetPull.
+const (
+	PullOff  Pull = 0
+	PullDown Pull = 1
+	PullUp   Pull = 2
+)
+
+// registers is a block of 32 bit peripheral registers
+type registers interface {
+	load(offset uint32) uint32
+	store(offset uint32, v uint32)
+}
+
+// memory is a block of registers in memory. Accesses are atomic, which gives them the
+// ordering bcmfuncs.c gets from __sync_synchronize() (memory barriers), so registers
+// are never read or written out of order.
+type memory []uint32
+
+func (m memory) load(offset uint32) uint32 {
+	return atomic.LoadUint32(&m[offset/4])
+}
+
+func (m memory) store(offset uint32, v uint32) {
+	atomic.StoreUint32(&m[offset/4], v)
+}
+
+// Board is the Raspberry Pi's peripheral registers. The register accesses aren't
+// synchronized, like bcmfuncs.c a read-modify-write of a register, e.g., Fsel, can
+// be interrupted by another goroutine or process changing the same register.
+type Board struct {
+	gpio registers
+	spi0 registers // nil if SPI0 isn't available, i.e., /dev/gpiomem is mapped
+
+	// bcm2711 is true for the RPi 4, which has different pull-up/down registers
+	bcm2711 bool
+	// spiBitOrder is the SPI bit order, SPI0 only supports MSB first so LSB first is
+	// done by reversing the bits in software
+	spiBitOrder BitOrder
+	// unmap releases the mapped memory, nil for a fake
+	unmap func() error
+}
+
+// Close releases the memory mapped by Open. The Board mustn't be used afterwards.
+func (b *Board) Close() error {
+	if b.unmap == nil {
+		return nil
+	}
+	err := b.unmap()
+	b.gpio, b.spi0, b.unmap = nil, nil, nil
+	return err
+}
+
+// setBits sets the bits covered by 'mask' in the register at 'offset' to the bits in
+// 'value', leaving the other bits unchanged. It isn't atomic.
+func setBits(regs registers, offset, value, mask uint32) {
+	v := regs.load(offset)
+	v = (v &^ mask) | (value & mask)
+	regs.store(offset, v)
+}
+
+// Fsel sets the function of 'pin', e.g., to Output. Each function select register
+// has 3 bits for each of 10 pins.
+func (b *Board) Fsel(pin uint8, f Function) {
+	offset := GPFSEL0 + uint32(pin/10)*4
+	shift := uint32(pin%10) * 3
+	setBits(b.gpio, offset, uint32(f)<<shift, fselMask<<shift)
+}
+
+// FunctionOf returns the function of 'pin'
+func (b *Board) FunctionOf(pin uint8) Function {
+	offset := GPFSEL0 + uint32(pin/10)*4
+	shift := uint32(pin%10) * 3
+	return Function(b.gpio.load(offset)>>shift) & fselMask
+}
+
+// Set sets output 'pin' HIGH. Writing a 1 to a pin's bit in a set register sets the
+// pin, 0 bits have no effect, so other pins aren't disturbed.
+func (b *Board) Set(pin uint8) {
+	b.gpio.store(GPSET0+uint32(pin/32)*4, 1<<(pin%32))
+}
+
+// Clr sets output 'pin' LOW, like Set but using the clear registers
+func (b *Board) Clr(pin uint8) {
+	b.gpio.store(GPCLR0+uint32(pin/32)*4, 1<<(pin%32))
+}
+
+// Write sets output 'pin' HIGH if 'high' is true, otherwise LOW
+func (b *Board) Write(pin uint8, high bool) {
+	if high {
+		b.Set(pin)
+	} else {
+		b.Clr(pin)
+	}
+}
+
+// Level returns true if 'pin' is HIGH
+func (b *Board) Level(pin uint8) bool {
+	return b.gpio.load(GPLEV0+uint32(pin/32)*4)&(1<<(pin%32)) != 0
+}
+
+// SetPull sets the pull-up/down resistor of 'pin'.
+//
+// On the BCM2835 thru BCM2837 the setting is written to GPPUD, then clocked into the
+// pin by setting its bit in GPPUDCLK0/1. Each step has to be held for 150 clock
+// cycles, a few microseconds is plenty (section 6.1 of the datasheet). The BCM2711
+// has a register with 2 bits per pin instead, whose codes for up and down are the
+// reverse of GPPUD's.
+func (b *Board) SetPull(pin uint8, pull Pull) {
+	if b.bcm2711 {
+		code := uint32(pull)
+		switch pull {
+		case PullUp:
+			code = 1
+		case PullDown:
+			code = 2
+		}
+		offset := GPPUPPDN0 + uint32(pin/16)*4
+		shift := uint32(pin%16) * 2
+		setBits(b.gpio, offset, code<<shift, 0x3<<shift)
+		return
+	}
+
+	clk := GPPUDCLK0 + uint32(pin/32)*4
+	b.gpio.store(GPPUD, uint32(pull))
+	time.Sleep(10 * time.Microsecond)
+	b.gpio.store(clk, 1<<(pin%32))
+	time.Sleep(10 * time.Microsecond)
+	b.gpio.store(GPPUD, uint32(PullOff))
+	b.gpio.store(clk, 0)
+}
@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package bcm
+
+import "testing"
+
+func TestFsel(t *testing.T) {
+	tests := []struct {
+		pin    uint8
+		offset uint32 // of the pin's GPFSEL register
+		shift  uint32
+	}{
+		{pin: 0, offset: GPFSEL0, shift: 0},
+		{pin: 9, offset: GPFSEL0, shift: 27},
+		{pin: 10, offset: GPFSEL0 + 4, shift: 0},
+		{pin: 17, offset: GPFSEL0 + 4, shift: 21},
+		{pin: 19, offset: GPFSEL0 + 4, shift: 27},
+		{pin: 20, offset: GPFSEL0 + 8, shift: 0},
+		{pin: 53, offset: GPFSEL0 + 20, shift: 9},
+	}
+
+	for _, tc := range tests {
+		for _, f := range []Function{Output, Alt0, Alt4, Alt5, Alt3} {
+			b := NewFake(false)
+			// The pins on either side must keep their functions
+			if tc.pin > 0 {
+				b.Fsel(tc.pin-1, Alt3)
+			}
+			b.Fsel(tc.pin+1, Alt3)
+
+			b.Fsel(tc.pin, f)
+			if got := b.FunctionOf(tc.pin); got != f {
+				t.Errorf("pin %d: FunctionOf returned %#x, want %#x", tc.pin, got, f)
+			}
+			if got := (b.GPIORegister(tc.offset) >> tc.shift) & fselMask; got != uint32(f) {
+				t.Errorf("pin %d: GPFSEL register %#x bits %d-%d are %#x, want %#x", tc.pin, tc.offset, tc.shift, tc.shift+2, got, f)
+			}
+			if tc.pin > 0 && b.FunctionOf(tc.pin-1) != Alt3 {
+				t.Errorf("pin %d: setting its function changed pin %d's to %#x", tc.pin, tc.pin-1, b.FunctionOf(tc.pin-1))
+			}
+			if b.FunctionOf(tc.pin+1) != Alt3 {
+				t.Errorf("pin %d: setting its function changed pin %d's to %#x", tc.pin, tc.pin+1, b.FunctionOf(tc.pin+1))
+			}
+
+			b.Fsel(tc.pin, Input)
+			if got := b.FunctionOf(tc.pin); got != Input {
+				t.Errorf("pin %d: FunctionOf returned %#x after Fsel(Input)", tc.pin, got)
+			}
+		}
+	}
+}
+
+func TestSetClrLevel(t *testing.T) {
+	tests := []struct {
+		pin    uint8
+		offset uint32 // of the pin's GPLEV register
+		bit    uint32
+	}{
+		{pin: 0, offset: GPLEV0, bit: 1 << 0},
+		{pin: 17, offset: GPLEV0, bit: 1 << 17},
+		{pin: 31, offset: GPLEV0, bit: 1 << 31},
+		{pin: 32, offset: GPLEV0 + 4, bit: 1 << 0},
+		{pin: 53, offset: GPLEV0 + 4, bit: 1 << 21},
+	}
+
+	for _, tc := range tests {
+		b := NewFake(false)
+		// A pin in each bank that must be left alone
+		b.Set(1)
+		b.Set(40)
+
+		b.Set(tc.pin)
+		if !b.Level(tc.pin) {
+			t.Errorf("pin %d: LOW after Set", tc.pin)
+		}
+		if b.GPIORegister(tc.offset)&tc.bit == 0 {
+			t.Errorf("pin %d: GPLEV register %#x is %#x after Set, want bit %#x set", tc.pin, tc.offset, b.GPIORegister(tc.offset), tc.bit)
+		}
+		if b.GPIORegister(GPSET0) != 0 || b.GPIORegister(GPSET0+4) != 0 {
+			t.Errorf("pin %d: GPSET registers don't read as 0", tc.pin)
+		}
+
+		b.Clr(tc.pin)
+		if b.Level(tc.pin) {
+			t.Errorf("pin %d: HIGH after Clr", tc.pin)
+		}
+		if b.GPIORegister(tc.offset)&tc.bit != 0 {
+			t.Errorf("pin %d: GPLEV register %#x is %#x after Clr, want bit %#x clear", tc.pin, tc.offset, b.GPIORegister(tc.offset), tc.bit)
+		}
+
+		b.Write(tc.pin, true)
+		if !b.Level(tc.pin) {
+			t.Errorf("pin %d: LOW after Write(true)", tc.pin)
+		}
+		b.Write(tc.pin, false)
+		if b.Level(tc.pin) {
+			t.Errorf("pin %d: HIGH after Write(false)", tc.pin)
+		}
+
+		if !b.Level(1) || !b.Level(40) {
+			t.Errorf("pin %d: changing its level changed pin 1's or 40's", tc.pin)
+		}
+	}
+
+	b := NewFake(false)
+	b.SetLevel(33, true)
+	if !b.Level(33) {
+		t.Error("pin 33: LOW after SetLevel(true)")
+	}
+}
+
+func TestSetPull(t *testing.T) {
+	tests := []struct {
+		pin  uint8
+		pull Pull
+		code uint32 // the BCM2711's GPIO_PUP_PDN_CNTRL code
+	}{
+		{pin: 0, pull: PullUp, code: 1},
+		{pin: 4, pull: PullDown, code: 2},
+		{pin: 15, pull: PullUp, code: 1},
+		{pin: 16, pull: PullDown, code: 2},
+		{pin: 31, pull: PullUp, code: 1},
+		{pin: 32, pull: PullDown, code: 2},
+		{pin: 47, pull: PullUp, code: 1},
+		{pin: 17, pull: PullOff, code: 0},
+	}
+
+	t.Run("BCM2835", func(t *testing.T) {
+		for _, tc := range tests {
+			b := NewFake(false)
+			b.SetPull(tc.pin+1, PullUp)
+			b.SetPull(tc.pin, PullDown)
+			b.SetPull(tc.pin, tc.pull)
+			if got := b.Pull(tc.pin); got != tc.pull {
+				t.Errorf("pin %d: pull is %d, want %d", tc.pin, got, tc.pull)
+			}
+			if got := b.Pull(tc.pin + 1); got != PullUp {
+				t.Errorf("pin %d: pin %d's pull changed to %d", tc.pin, tc.pin+1, got)
+			}
+			// The latch sequence leaves GPPUD off and the clocks stopped
+			if b.GPIORegister(GPPUD) != uint32(PullOff) || b.GPIORegister(GPPUDCLK0) != 0 || b.GPIORegister(GPPUDCLK0+4) != 0 {
+				t.Errorf("pin %d: GPPUD %#x, GPPUDCLK0 %#x, GPPUDCLK1 %#x, want 0", tc.pin,
+					b.GPIORegister(GPPUD), b.GPIORegister(GPPUDCLK0), b.GPIORegister(GPPUDCLK0+4))
+			}
+			if b.GPIORegister(GPPUPPDN0+uint32(tc.pin/16)*4) != 0 {
+				t.Errorf("pin %d: the BCM2711 register was written on a BCM2835", tc.pin)
+			}
+		}
+	})
+
+	t.Run("BCM2711", func(t *testing.T) {
+		for _, tc := range tests {
+			b := NewFake(true)
+			b.SetPull(tc.pin+1, PullUp)
+			b.SetPull(tc.pin, PullDown)
+			b.SetPull(tc.pin, tc.pull)
+			if got := b.Pull(tc.pin); got != tc.pull {
+				t.Errorf("pin %d: pull is %d, want %d", tc.pin, got, tc.pull)
+			}
+			if got := b.Pull(tc.pin + 1); got != PullUp {
+				t.Errorf("pin %d: pin %d's pull changed to %d", tc.pin, tc.pin+1, got)
+			}
+			offset, shift := GPPUPPDN0+uint32(tc.pin/16)*4, uint32(tc.pin%16)*2
+			if got := (b.GPIORegister(offset) >> shift) & 0x3; got != tc.code {
+				t.Errorf("pin %d: register %#x bits %d-%d are %d, want %d", tc.pin, offset, shift, shift+1, got, tc.code)
+			}
+			if b.GPIORegister(GPPUD) != 0 || b.GPIORegister(GPPUDCLK0) != 0 || b.GPIORegister(GPPUDCLK0+4) != 0 {
+				t.Errorf("pin %d: the BCM2835 registers were written on a BCM2711", tc.pin)
+			}
+		}
+	})
+}
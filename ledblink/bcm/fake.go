@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package bcm
+
+import "sync"
+
+// Fake is a Board whose registers are ordinary memory, for testing code that uses a
+// Board without a Raspberry Pi. The registers that have side effects on real hardware
+// behave like it:
+//   - writing to a GPSET or GPCLR register sets or clears the pins' bits in the GPLEV
+//     register, and reading GPSET or GPCLR returns 0
+//   - on a BCM2835 the pull setting in GPPUD is latched into a pin when its GPPUDCLK
+//     bit is set, Pull reports the latched setting
+//   - SPI0 can always accept data and a transfer completes as soon as the FIFO is
+//     written, the bytes sent are recorded and the byte received is the one sent,
+//     as if MOSI were connected to MISO, unless SetSPIResponse is used
+type Fake struct {
+	*Board
+	gpio *fakeGPIO
+	spi0 *fakeSPI
+}
+
+// NewFake returns a fake Board, 'bcm2711' selects the RPi 4's pull-up/down registers.
+// All of the registers are initially 0, i.e., all pins are inputs and LOW.
+func NewFake(bcm2711 bool) *Fake {
+	gpio := &fakeGPIO{memory: make(memory, gpioMemSize/4), pulls: map[uint8]Pull{}}
+	spi0 := &fakeSPI{memory: make(memory, 0x18/4)}
+	return &Fake{
+		Board: &Board{gpio: gpio, spi0: spi0, bcm2711: bcm2711, spiBitOrder: MSBFirst},
+		gpio:  gpio,
+		spi0:  spi0,
+	}
+}
+
+// GPIORegister returns the value of the GPIO register at 'offset', e.g., GPFSEL0
+func (f *Fake) GPIORegister(offset uint32) uint32 {
+	return f.gpio.load(offset)
+}
+
+// SPIRegister returns the value of the SPI0 register at 'offset', e.g., SPI0CS
+func (f *Fake) SPIRegister(offset uint32) uint32 {
+	return f.spi0.memory.load(offset)
+}
+
+// SetLevel sets the level of 'pin', e.g., to simulate an input
+func (f *Fake) SetLevel(pin uint8, high bool) {
+	f.gpio.setLevel(pin, high)
+}
+
+// Pull returns the pull-up/down setting of 'pin'
+func (f *Fake) Pull(pin uint8) Pull {
+	if !f.bcm2711 {
+		f.gpio.mu.Lock()
+		defer f.gpio.mu.Unlock()
+		return f.gpio.pulls[pin]
+	}
+	code := (f.gpio.load(GPPUPPDN0+uint32(pin/16)*4) >> (uint32(pin%16) * 2)) & 0x3
+	switch code {
+	case 1:
+		return PullUp
+	case 2:
+		return PullDown
+	}
+	return PullOff
+}
+
+// SPISent returns the bytes sent over SPI0, as they appeared on MOSI, i.e., after
+// any bit reversal for LSB first.
+func (f *Fake) SPISent() []byte {
+	f.spi0.mu.Lock()
+	defer f.spi0.mu.Unlock()
+	return append([]byte{}, f.spi0.sent...)
+}
+
+// SetSPIResponse sets the function that returns the byte the device sends back for
+// each byte sent to it
+func (f *Fake) SetSPIResponse(response func(sent byte) byte) {
+	f.spi0.mu.Lock()
+	defer f.spi0.mu.Unlock()
+	f.spi0.response = response
+}
+
+// fakeGPIO is GPIO registers in memory
+type fakeGPIO struct {
+	memory
+	mu    sync.Mutex
+	pulls map[uint8]Pull // latched BCM2835 pull settings
+}
+
+func (g *fakeGPIO) load(offset uint32) uint32 {
+	if isRegister(offset, GPSET0) || isRegister(offset, GPCLR0) {
+		return 0
+	}
+	return g.memory.load(offset)
+}
+
+func (g *fakeGPIO) store(offset uint32, v uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case isRegister(offset, GPSET0):
+		lev := GPLEV0 + (offset - GPSET0)
+		g.memory.store(lev, g.memory.load(lev)|v)
+	case isRegister(offset, GPCLR0):
+		lev := GPLEV0 + (offset - GPCLR0)
+		g.memory.store(lev, g.memory.load(lev)&^v)
+	case isRegister(offset, GPPUDCLK0):
+		first := uint8((offset - GPPUDCLK0) * 8)
+		pull := Pull(g.memory.load(GPPUD) & 0x3)
+		for i := uint8(0); i < 32; i++ {
+			if v&(1<<i) != 0 {
+				g.pulls[first+i] = pull
+			}
+		}
+		g.memory.store(offset, v)
+	default:
+		g.memory.store(offset, v)
+	}
+}
+
+func (g *fakeGPIO) setLevel(pin uint8, high bool) {
+	if high {
+		g.store(GPSET0+uint32(pin/32)*4, 1<<(pin%32))
+	} else {
+		g.store(GPCLR0+uint32(pin/32)*4, 1<<(pin%32))
+	}
+}
+
+// isRegister returns true if 'offset' is the first or second register of a pair
+// starting at 'first', e.g., GPSET0 and GPSET1
+func isRegister(offset, first uint32) bool {
+	return offset == first || offset == first+4
+}
+
+// fakeSPI is SPI0 registers in memory
+type fakeSPI struct {
+	memory
+	mu       sync.Mutex
+	sent     []byte
+	response func(sent byte) byte
+	received byte
+}
+
+func (s *fakeSPI) load(offset uint32) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch offset {
+	case SPI0CS:
+		return s.memory.load(offset) | SPI0CSTXD
+	case SPI0FIFO:
+		return uint32(s.received)
+	}
+	return s.memory.load(offset)
+}
+
+func (s *fakeSPI) store(offset uint32, v uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch offset {
+	case SPI0CS:
+		// The clear bits aren't stored, they're actions. The status bits are read
+		// only, DONE is cleared when a new transfer starts.
+		cur := s.memory.load(SPI0CS)
+		done := cur & SPI0CSDone
+		if v&SPI0CSTA != 0 && cur&SPI0CSTA == 0 {
+			done = 0
+		}
+		s.memory.store(offset, v&^(SPI0CSClear|SPI0CSDone|SPI0CSRXD|SPI0CSTXD)|done)
+	case SPI0FIFO:
+		b := byte(v)
+		s.sent = append(s.sent, b)
+		s.received = b
+		if s.response != nil {
+			s.received = s.response(b)
+		}
+		s.memory.store(SPI0CS, s.memory.load(SPI0CS)|SPI0CSDone)
+	default:
+		s.memory.store(offset, v)
+	}
+}
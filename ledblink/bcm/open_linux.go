@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package bcm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Peripheral block physical base addresses and sizes, and the offsets of the register
+// blocks within it
+const (
+	periBase     = 0x20000000 // RPi 1
+	periSize     = 0x01000000
+	rpi2PeriBase = 0x3F000000 // RPi 2 and 3
+	rpi4PeriBase = 0xFE000000 // RPi 4
+	rpi4PeriSize = 0x01800000
+
+	gpioBase = 0x200000
+	spi0Base = 0x204000
+
+	// dtRanges contains the base address and size of the peripheral block
+	dtRanges = "/proc/device-tree/soc/ranges"
+)
+
+// Open maps the peripheral registers into memory, it's bcm_init() in bcmfuncs.c.
+//
+// The peripheral block's base address and size are read from the device tree's
+// 'ranges' property for the 'soc' node. When running as root the whole block is
+// mapped from /dev/mem. Otherwise only the GPIO registers are mapped, from
+// /dev/gpiomem, and SPI0 isn't available.
+func Open() (*Board, error) {
+	base, size, bcm2711 := peripheralBlock()
+	b := &Board{bcm2711: bcm2711, spiBitOrder: MSBFirst}
+
+	if os.Geteuid() == 0 {
+		mem, err := mapFile("/dev/mem", int64(base), size)
+		if err != nil {
+			return nil, err
+		}
+		regs := asRegisters(mem)
+		b.gpio = regs[gpioBase/4:]
+		b.spi0 = regs[spi0Base/4:]
+		b.unmap = func() error { return syscall.Munmap(mem) }
+		return b, nil
+	}
+
+	// The GPIO registers are at the start of /dev/gpiomem, not at an offset
+	mem, err := mapFile("/dev/gpiomem", 0, gpioMemSize)
+	if err != nil {
+		return nil, err
+	}
+	b.gpio = asRegisters(mem)
+	b.unmap = func() error { return syscall.Munmap(mem) }
+	return b, nil
+}
+
+// peripheralBlock returns the physical base address and size of the peripheral
+// block and whether it's an RPi 4. The RPi 1's address and size are returned if
+// the device tree can't be read.
+//
+// The 'ranges' property is big-endian. It starts with the bus address of the block,
+// 0x7e000000, followed by the physical address and size. On an RPi 4 the physical
+// address is 64 bits, so its first 32 bits are 0.
+func peripheralBlock() (base uint32, size int, bcm2711 bool) {
+	buf, err := ioutil.ReadFile(dtRanges)
+	if err != nil || len(buf) < 12 || binary.BigEndian.Uint32(buf) != 0x7e000000 {
+		return periBase, periSize, false
+	}
+	addr, sz := binary.BigEndian.Uint32(buf[4:]), binary.BigEndian.Uint32(buf[8:])
+	if addr == 0 && len(buf) >= 16 {
+		addr, sz = binary.BigEndian.Uint32(buf[8:]), binary.BigEndian.Uint32(buf[12:])
+	}
+	switch addr {
+	case periBase, rpi2PeriBase:
+		return addr, int(sz), false
+	case rpi4PeriBase:
+		return addr, int(sz), true
+	}
+	return periBase, periSize, false
+}
+
+// mapFile maps 'size' bytes of 'path', starting at 'offset', into memory
+func mapFile(path string, offset int64, size int) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	// The mapping remains valid after the file is closed
+	defer f.Close()
+
+	mem, err := syscall.Mmap(int(f.Fd()), offset, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("unable to map %s: %w", path, err)
+	}
+	return mem, nil
+}
+
+// asRegisters returns mapped memory as 32 bit registers
+func asRegisters(mem []byte) memory {
+	n := len(mem) / 4
+	return (*[1 << 28]uint32)(unsafe.Pointer(&mem[0]))[:n:n]
+}
@@ -0,0 +1,17 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+//go:build !linux
+// +build !linux
+
+package bcm
+
+import "errors"
+
+// Open maps the peripheral registers into memory, they can only be mapped on Linux
+func Open() (*Board, error) {
+	return nil, errors.New("the peripheral registers can only be mapped on Linux")
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package bcm
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// Offsets of the SPI0 registers from the start of the SPI0 register block, in bytes,
+// per section 10.5 of the datasheet
+const (
+	SPI0CS   = 0x00 // SPI Master Control and Status
+	SPI0FIFO = 0x04 // SPI Master TX and RX FIFOs
+	SPI0CLK  = 0x08 // SPI Master Clock Divider
+)
+
+// Bits of the SPI0 CS register
+const (
+	SPI0CSDone  = 0x00010000 // transfer is done
+	SPI0CSRXD   = 0x00020000 // RX FIFO contains data
+	SPI0CSTXD   = 0x00040000 // TX FIFO can accept data
+	SPI0CSTA    = 0x00000080 // transfer is active
+	SPI0CSClear = 0x00000030 // clear the RX and TX FIFOs
+	SPI0CSCPOL  = 0x00000008 // clock polarity
+	SPI0CSCPHA  = 0x00000004 // clock phase
+)
+
+// SPI0 pins, they're set to function Alt0 to use SPI0
+const (
+	SPI0CE1  uint8 = 7
+	SPI0CE0  uint8 = 8
+	SPI0MISO uint8 = 9
+	SPI0MOSI uint8 = 10
+	SPI0SCLK uint8 = 11
+)
+
+// BitOrder is the order of the bits in an SPI transfer
+type BitOrder int
+
+// SPI bit orders
+const (
+	LSBFirst BitOrder = 0
+	MSBFirst BitOrder = 1
+)
+
+// SPI clock dividers, the SPI clock is the core clock, 250MHz on an RPi 1 or 2, 400MHz
+// on an RPi 3, divided by the divider. Any even divider can be used.
+const (
+	ClockDivider65536 uint16 = 0    // 3.814697260kHz on an RPi 2, 6.1035156kHz on an RPi 3
+	ClockDivider4096  uint16 = 4096 // 61.03515625kHz on an RPi 2, 97.65625kHz on an RPi 3
+	ClockDivider1024  uint16 = 1024 // 244.140625kHz on an RPi 2, 390.625kHz on an RPi 3
+	ClockDivider256   uint16 = 256  // 976.5625kHz on an RPi 2, 1.5625MHz on an RPi 3
+	ClockDivider64    uint16 = 64   // 3.90625MHz on an RPi 2, 6.250MHz on an RPi 3
+	ClockDivider16    uint16 = 16   // 15.625MHz on an RPi 2, 25MHz on an RPi 3
+)
+
+// ErrNoSPI is returned by SPIBegin when the SPI0 registers aren't available, i.e.,
+// the Board was opened without root access
+var ErrNoSPI = errors.New("SPI0 isn't available, it requires root access to /dev/mem")
+
+var spiPins = []uint8{SPI0CE1, SPI0CE0, SPI0MISO, SPI0MOSI, SPI0SCLK}
+
+// SPIBegin sets the SPI0 pins to their SPI function, Alt0 (section 6.2 of the
+// datasheet), resets the SPI0 control register, and clears the FIFOs.
+func (b *Board) SPIBegin() error {
+	if b.spi0 == nil {
+		return ErrNoSPI
+	}
+	for _, pin := range spiPins {
+		b.Fsel(pin, Alt0)
+	}
+	b.spi0.store(SPI0CS, 0)
+	b.spi0.store(SPI0CS, SPI0CSClear)
+	return nil
+}
+
+// SPIEnd sets the SPI0 pins back to inputs
+func (b *Board) SPIEnd() {
+	for _, pin := range spiPins {
+		b.Fsel(pin, Input)
+	}
+}
+
+// SPISetBitOrder sets the order bits are sent and received in
+func (b *Board) SPISetBitOrder(order BitOrder) {
+	b.spiBitOrder = order
+}
+
+// SPISetDataMode sets the clock polarity and phase, mode 0 thru 3
+func (b *Board) SPISetDataMode(mode uint8) {
+	setBits(b.spi0, SPI0CS, uint32(mode)<<2, SPI0CSCPOL|SPI0CSCPHA)
+}
+
+// SPISetClockDivider sets the SPI clock divider, e.g., ClockDivider256
+func (b *Board) SPISetClockDivider(divider uint16) {
+	b.spi0.store(SPI0CLK, uint32(divider))
+}
+
+// SPITransfer sends 'value' and returns the byte received at the same time. It's a
+// polled transfer per section 10.6.1 of the datasheet.
+func (b *Board) SPITransfer(value byte) byte {
+	// Clear the FIFOs and start the transfer
+	setBits(b.spi0, SPI0CS, SPI0CSClear, SPI0CSClear)
+	setBits(b.spi0, SPI0CS, SPI0CSTA, SPI0CSTA)
+
+	// Wait until the TX FIFO can accept data, then write to it
+	for b.spi0.load(SPI0CS)&SPI0CSTXD == 0 {
+	}
+	b.spi0.store(SPI0FIFO, uint32(b.correctOrder(value)))
+
+	// Wait for the transfer to finish, then read the byte sent back by the device
+	for b.spi0.load(SPI0CS)&SPI0CSDone == 0 {
+	}
+	ret := b.correctOrder(byte(b.spi0.load(SPI0FIFO)))
+
+	// The transfer isn't active anymore
+	setBits(b.spi0, SPI0CS, 0, SPI0CSTA)
+	return ret
+}
+
+// correctOrder reverses the bits of 'v' if the bit order is LSB first
+func (b *Board) correctOrder(v byte) byte {
+	if b.spiBitOrder == LSBFirst {
+		return bits.Reverse8(v)
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package bcm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSPITransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    BitOrder
+		send     []byte
+		sent     []byte // as it appears on MOSI
+		response func(sent byte) byte
+		received []byte
+	}{
+		{
+			name:     "MSB first",
+			order:    MSBFirst,
+			send:     []byte{0x01, 0x3c, 0x80, 0xf0},
+			sent:     []byte{0x01, 0x3c, 0x80, 0xf0},
+			received: []byte{0x01, 0x3c, 0x80, 0xf0},
+		},
+		{
+			name:     "LSB first",
+			order:    LSBFirst,
+			send:     []byte{0x01, 0x3c, 0x80, 0xf0},
+			sent:     []byte{0x80, 0x3c, 0x01, 0x0f},
+			received: []byte{0x01, 0x3c, 0x80, 0xf0},
+		},
+		{
+			name:     "MSB first response",
+			order:    MSBFirst,
+			send:     []byte{0x01, 0x02},
+			sent:     []byte{0x01, 0x02},
+			response: func(sent byte) byte { return sent | 0x40 },
+			received: []byte{0x41, 0x42},
+		},
+		{
+			name:     "LSB first response",
+			order:    LSBFirst,
+			send:     []byte{0x01, 0x02},
+			sent:     []byte{0x80, 0x40},
+			response: func(sent byte) byte { return sent | 0x01 },
+			received: []byte{0x81, 0x82},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewFake(false)
+			if err := b.SPIBegin(); err != nil {
+				t.Fatal(err)
+			}
+			for _, pin := range spiPins {
+				if b.FunctionOf(pin) != Alt0 {
+					t.Errorf("pin %d's function is %#x after SPIBegin, want Alt0", pin, b.FunctionOf(pin))
+				}
+			}
+			if tc.response != nil {
+				b.SetSPIResponse(tc.response)
+			}
+			b.SPISetBitOrder(tc.order)
+
+			received := []byte{}
+			for _, v := range tc.send {
+				received = append(received, b.SPITransfer(v))
+				if b.SPIRegister(SPI0CS)&SPI0CSTA != 0 {
+					t.Errorf("transfer of %#02x is still active", v)
+				}
+			}
+			if got := b.SPISent(); !bytes.Equal(got, tc.sent) {
+				t.Errorf("sent % x, want % x", got, tc.sent)
+			}
+			if !bytes.Equal(received, tc.received) {
+				t.Errorf("received % x, want % x", received, tc.received)
+			}
+
+			b.SPIEnd()
+			for _, pin := range spiPins {
+				if b.FunctionOf(pin) != Input {
+					t.Errorf("pin %d's function is %#x after SPIEnd, want Input", pin, b.FunctionOf(pin))
+				}
+			}
+		})
+	}
+}
+
+func TestSPIDataMode(t *testing.T) {
+	b := NewFake(false)
+	for mode := uint8(0); mode < 4; mode++ {
+		b.SPISetDataMode(mode)
+		if got := b.SPIRegister(SPI0CS) & (SPI0CSCPOL | SPI0CSCPHA); got != uint32(mode)<<2 {
+			t.Errorf("mode %d: CPOL and CPHA are %#x, want %#x", mode, got, uint32(mode)<<2)
+		}
+	}
+	b.SPISetClockDivider(ClockDivider256)
+	if got := b.SPIRegister(SPI0CLK); got != uint32(ClockDivider256) {
+		t.Errorf("clock divider is %d, want %d", got, ClockDivider256)
+	}
+}
+
+func TestSPIWithoutRoot(t *testing.T) {
+	b := &Board{gpio: make(memory, gpioMemSize/4)}
+	if err := b.SPIBegin(); err != ErrNoSPI {
+		t.Errorf("SPIBegin returned %v, want ErrNoSPI", err)
+	}
+}
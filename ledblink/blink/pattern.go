@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package blink plays blink patterns on an LED. A pattern is written in a small
+// language of comma separated statements, e.g., 'on 100ms, off 100ms, repeat 3, pause 1s':
+//
+//	on DURATION     turn the LED on for DURATION, e.g., '250ms' or '1.5s'
+//	off DURATION    turn the LED off for DURATION
+//	pause DURATION  the same as 'off'
+//	repeat N        play the statements since the previous 'repeat', or since the
+//	                start, N times in all
+//	on              turn the LED on and leave it on, must be the last statement
+//	off             turn the LED off and leave it off, must be the last statement
+//
+// Statements can also be separated by semicolons or newlines. Patterns that don't end
+// with a plain 'on' or 'off' play over and over.
+package blink
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSteps limits the length of a pattern after its repeats are expanded
+const maxSteps = 10000
+
+// Step is the LED being on or off for a period of time
+type Step struct {
+	On       bool
+	Duration time.Duration
+}
+
+// Pattern is a parsed blink pattern
+type Pattern struct {
+	Name   string // the pattern's name, or its source if it isn't a named pattern
+	Source string
+	Steps  []Step
+	// Hold is true if the last step is held until the pattern is changed rather
+	// than the pattern playing over and over. The last step's Duration is 0.
+	Hold bool
+}
+
+// named contains the sources of the named patterns
+var named = map[string]string{
+	// two quick beats and a rest, the system is alive
+	"heartbeat": "on 100ms, off 100ms, on 100ms, off 700ms",
+	// three fast blinks and a pause, something's wrong
+	"error": "on 100ms, off 100ms, repeat 3, pause 1s",
+	// a brief blip every couple of seconds, everything's fine
+	"ok": "on 50ms, off 2s",
+	// a steady blink, working on something
+	"busy": "on 250ms, off 250ms",
+}
+
+// Names returns the names of the named patterns in alphabetical order
+func Names() []string {
+	names := []string{}
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the named pattern 's', or if there isn't one, the pattern 's' is the source of
+func Lookup(s string) (Pattern, error) {
+	if src, ok := named[strings.TrimSpace(s)]; ok {
+		p, err := Parse(src)
+		p.Name = strings.TrimSpace(s)
+		return p, err
+	}
+	return Parse(s)
+}
+
+// Parse parses the pattern in 's'
+func Parse(s string) (Pattern, error) {
+	p := Pattern{Name: s, Source: s}
+	// groupStart is the index of the first step repeated by the next 'repeat'
+	groupStart := 0
+
+	statements := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '\n' })
+	for i, stmt := range statements {
+		stmt = strings.TrimSpace(stmt)
+		fields := strings.Fields(stmt)
+		if len(fields) == 0 {
+			continue
+		}
+		if p.Hold {
+			return Pattern{}, fmt.Errorf("statement %d %q follows a held %q, it must be last", i+1, stmt, p.Steps[len(p.Steps)-1].label())
+		}
+
+		keyword := strings.ToLower(fields[0])
+		switch {
+		case (keyword == "on" || keyword == "off") && len(fields) == 1:
+			p.Steps = append(p.Steps, Step{On: keyword == "on"})
+			p.Hold = true
+		case keyword == "on" || keyword == "off" || keyword == "pause":
+			if len(fields) != 2 {
+				return Pattern{}, fmt.Errorf("statement %d %q: expected '%s DURATION'", i+1, stmt, keyword)
+			}
+			d, err := time.ParseDuration(fields[1])
+			if err != nil || d <= 0 {
+				return Pattern{}, fmt.Errorf("statement %d %q: invalid duration %q, e.g., use '100ms' or '1.5s'", i+1, stmt, fields[1])
+			}
+			p.Steps = append(p.Steps, Step{On: keyword == "on", Duration: d})
+		case keyword == "repeat":
+			if len(fields) != 2 {
+				return Pattern{}, fmt.Errorf("statement %d %q: expected 'repeat N'", i+1, stmt)
+			}
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				return Pattern{}, fmt.Errorf("statement %d %q: invalid repeat count %q, must be at least 1", i+1, stmt, fields[1])
+			}
+			group := p.Steps[groupStart:]
+			if len(group) == 0 {
+				return Pattern{}, fmt.Errorf("statement %d %q: nothing to repeat", i+1, stmt)
+			}
+			if len(p.Steps)+len(group)*(n-1) > maxSteps {
+				return Pattern{}, fmt.Errorf("statement %d %q: pattern is too long, it can have at most %d steps", i+1, stmt, maxSteps)
+			}
+			group = append([]Step{}, group...)
+			for j := 1; j < n; j++ {
+				p.Steps = append(p.Steps, group...)
+			}
+			groupStart = len(p.Steps)
+		default:
+			return Pattern{}, fmt.Errorf("statement %d %q: unknown statement %q, must be 'on', 'off', 'pause', or 'repeat'", i+1, stmt, fields[0])
+		}
+	}
+
+	if len(p.Steps) == 0 {
+		return Pattern{}, fmt.Errorf("empty pattern")
+	}
+	return p, nil
+}
+
+// label returns a step's statement
+func (s Step) label() string {
+	state := "off"
+	if s.On {
+		state = "on"
+	}
+	if s.Duration == 0 {
+		return state
+	}
+	return state + " " + s.Duration.String()
+}
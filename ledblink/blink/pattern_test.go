@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package blink
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ms = time.Millisecond
+
+// on and off return steps of 'n' milliseconds
+func on(n int) Step  { return Step{On: true, Duration: time.Duration(n) * ms} }
+func off(n int) Step { return Step{Duration: time.Duration(n) * ms} }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		want     []Step
+		wantHold bool
+	}{
+		{name: "on and off", s: "on 100ms, off 200ms", want: []Step{on(100), off(200)}},
+		{name: "pause", s: "on 50ms, pause 1.5s", want: []Step{on(50), off(1500)}},
+		{name: "case and spacing", s: "  ON 1s ,Off   2s,PAUSE 3s  ", want: []Step{on(1000), off(2000), off(3000)}},
+		{name: "separators", s: "on 1ms; off 2ms\non 3ms,\n\noff 4ms;", want: []Step{on(1), off(2), on(3), off(4)}},
+		{name: "repeat", s: "on 100ms, off 100ms, repeat 3", want: []Step{on(100), off(100), on(100), off(100), on(100), off(100)}},
+		{name: "repeat 1", s: "on 100ms, repeat 1, off 1s", want: []Step{on(100), off(1000)}},
+		{
+			// Repeats don't nest, a repeat only repeats the statements since the
+			// previous one
+			name: "repeats in turn",
+			s:    "on 1ms, repeat 2, off 2ms, repeat 3, on 3ms",
+			want: []Step{on(1), on(1), off(2), off(2), off(2), on(3)},
+		},
+		{name: "hold on", s: "on 100ms, off 100ms, repeat 2, on", want: []Step{on(100), off(100), on(100), off(100), {On: true}}, wantHold: true},
+		{name: "hold off", s: "off", want: []Step{{}}, wantHold: true},
+		{name: "hold with a trailing separator", s: "on 1s, on;", want: []Step{on(1000), {On: true}}, wantHold: true},
+		{name: "longest pattern", s: "on 1ms, off 1ms, repeat 5000", want: nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Parse(tc.s)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if p.Name != tc.s || p.Source != tc.s {
+				t.Errorf("got name %q, source %q, want %q", p.Name, p.Source, tc.s)
+			}
+			if tc.want == nil {
+				if len(p.Steps) != maxSteps {
+					t.Errorf("got %d steps, want %d", len(p.Steps), maxSteps)
+				}
+			} else if !reflect.DeepEqual(p.Steps, tc.want) {
+				t.Errorf("got steps %v, want %v", p.Steps, tc.want)
+			}
+			if p.Hold != tc.wantHold {
+				t.Errorf("got Hold %t, want %t", p.Hold, tc.wantHold)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr string
+	}{
+		{s: "", wantErr: "empty pattern"},
+		{s: " , ;\n", wantErr: "empty pattern"},
+		{s: "blink 1s", wantErr: `statement 1 "blink 1s": unknown statement "blink", must be 'on', 'off', 'pause', or 'repeat'`},
+		{s: "on 1s, pause", wantErr: `statement 2 "pause": expected 'pause DURATION'`},
+		{s: "on 1s 2s", wantErr: `statement 1 "on 1s 2s": expected 'on DURATION'`},
+		{s: "off 1s, off 100", wantErr: `statement 2 "off 100": invalid duration "100", e.g., use '100ms' or '1.5s'`},
+		{s: "on 0s", wantErr: `statement 1 "on 0s": invalid duration "0s"`},
+		{s: "on -1s", wantErr: `statement 1 "on -1s": invalid duration "-1s"`},
+		{s: "on 1s, repeat", wantErr: `statement 2 "repeat": expected 'repeat N'`},
+		{s: "on 1s, repeat 2 3", wantErr: `statement 2 "repeat 2 3": expected 'repeat N'`},
+		{s: "on 1s, repeat 0", wantErr: `statement 2 "repeat 0": invalid repeat count "0", must be at least 1`},
+		{s: "on 1s, repeat x", wantErr: `statement 2 "repeat x": invalid repeat count "x"`},
+		{s: "repeat 2", wantErr: `statement 1 "repeat 2": nothing to repeat`},
+		{s: "on 1s, repeat 2, repeat 3", wantErr: `statement 3 "repeat 3": nothing to repeat`},
+		{s: "on 1ms, off 1ms, repeat 5001", wantErr: `statement 3 "repeat 5001": pattern is too long, it can have at most 10000 steps`},
+		{s: "on 1ms, repeat 10000, off 1ms, repeat 2", wantErr: `statement 4 "repeat 2": pattern is too long`},
+		{s: "on, off 1s", wantErr: `statement 2 "off 1s" follows a held "on", it must be last`},
+		{s: "off 1s, off, repeat 2", wantErr: `statement 3 "repeat 2" follows a held "off", it must be last`},
+	}
+
+	for _, tc := range tests {
+		_, err := Parse(tc.s)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: got error %v, want one containing %q", tc.s, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range Names() {
+		p, err := Lookup(" " + name + " ")
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if p.Name != name || p.Source != named[name] || len(p.Steps) == 0 || p.Hold {
+			t.Errorf("%s: got %+v", name, p)
+		}
+	}
+
+	p, err := Lookup("error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Step{on(100), off(100), on(100), off(100), on(100), off(100), off(1000)}; !reflect.DeepEqual(p.Steps, want) {
+		t.Errorf("got error pattern %v, want %v", p.Steps, want)
+	}
+
+	// Anything else is a pattern's source
+	if p, err := Lookup("on 1s"); err != nil || p.Name != "on 1s" || !reflect.DeepEqual(p.Steps, []Step{on(1000)}) {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	if _, err := Lookup("heartbeats"); err == nil {
+		t.Error("expected an error for an unknown name")
+	}
+}
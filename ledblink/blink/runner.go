@@ -0,0 +1,86 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package blink
+
+import (
+	"context"
+	"time"
+)
+
+// Pin is the LED's GPIO pin, rpio.Pin satisfies it
+type Pin interface {
+	High()
+	Low()
+}
+
+// Runner plays patterns on an LED
+type Runner struct {
+	pin       Pin
+	activeLow bool
+}
+
+// NewRunner returns a runner for the LED attached to 'pin'. 'activeLow' is true if
+// setting the pin LOW turns the LED on, which is how the LED in blinkingled.go is wired.
+// The pin must already be in OUTPUT mode.
+func NewRunner(pin Pin, activeLow bool) *Runner {
+	return &Runner{pin: pin, activeLow: activeLow}
+}
+
+// Run plays 'p' until a new pattern is received on 'patterns', then plays that one,
+// and so on, until 'ctx' is cancelled. A new pattern replaces the current one
+// immediately, in the middle of a step if need be. If 'patterns' is closed, or nil,
+// the current pattern plays until 'ctx' is cancelled. The LED is turned off before
+// Run returns.
+func (r *Runner) Run(ctx context.Context, p Pattern, patterns <-chan Pattern) {
+	defer r.set(false)
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for i := 0; ; i = (i + 1) % len(p.Steps) {
+		step := p.Steps[i]
+		r.set(step.On)
+
+		// A held step has no timer, it lasts until the pattern's replaced
+		var expired <-chan time.Time
+		if !p.Hold || i < len(p.Steps)-1 {
+			timer.Reset(step.Duration)
+			expired = timer.C
+		}
+
+		for waiting := true; waiting; {
+			select {
+			case <-ctx.Done():
+				return
+			case next, ok := <-patterns:
+				if !ok {
+					patterns = nil
+					continue
+				}
+				if expired != nil && !timer.Stop() {
+					<-timer.C
+				}
+				p, i = next, -1
+				waiting = false
+			case <-expired:
+				waiting = false
+			}
+		}
+	}
+}
+
+// set turns the LED on or off
+func (r *Runner) set(on bool) {
+	if on == r.activeLow {
+		r.pin.Low()
+	} else {
+		r.pin.High()
+	}
+}
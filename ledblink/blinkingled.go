@@ -5,34 +5,126 @@
 //
 // Run using 'go run blinkingled.go'
 //
+// By default the LED blinks 5 times. '-morse' sends a message in Morse code instead,
+// e.g., 'go run blinkingled.go -morse "CQ CQ DE W1AW <AR>" -wpm 20 -fwpm 10'. Prosigns
+// are written in angle brackets. '-fwpm' uses Farnsworth timing, the characters are
+// sent at '-wpm' with longer spaces between them.
+//
+// '-pattern' plays a blink pattern until ctl-C is pressed. It's either the name of
+// a pattern, 'busy', 'error', 'heartbeat', or 'ok', or a pattern such as
+// 'on 100ms, off 100ms, repeat 3, pause 1s' (see the blink package for details).
+// Sending the program SIGUSR1, e.g., 'pkill -USR1 blinkingled', switches to the next
+// named pattern.
+//
+// '-backend=cdev' drives the LED through the GPIO character device, '-chip', instead of
+// the go-rpio library, e.g., 'go run blinkingled.go -backend=cdev -chip=gpiochip0'.
+// '-backend=fake' and '-backend=sim' run the program without a Raspberry Pi, the pin's
+// final state is printed on exit.
+//
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/ledblink/blink"
+	"github.com/youngkin/gpio/ledblink/morse"
 )
 
 func main() {
-	// Initialize the go-rpio library. By default it uses BCM pin numbering.
-	if err := rpio.Open(); err != nil {
+	var (
+		message     string
+		timing      morse.Timing
+		patternName string
+		backend     string
+		chipName    string
+	)
+	flag.StringVar(&backend, "backend", "rpio", "how the LED's pin is driven, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	flag.StringVar(&message, "morse", "", "send this message in Morse code instead of blinking 5 times")
+	flag.Float64Var(&timing.WPM, "wpm", 15, "Morse code character speed in words per minute")
+	flag.Float64Var(&timing.FarnsworthWPM, "fwpm", 0, "overall Morse code speed in words per minute for Farnsworth timing, 0 for standard timing")
+	flag.StringVar(&patternName, "pattern", "", "play this blink pattern, or named pattern, instead of blinking 5 times")
+	flag.Parse()
+
+	var pattern blink.Pattern
+	if patternName != "" {
+		var err error
+		if pattern, err = blink.Lookup(patternName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	var symbols []morse.Symbol
+	if message != "" {
+		var err error
+		if symbols, err = morse.Encode(message); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err = timing.Validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	board, err := gpio.Open(backend, chipName)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// Release resources held by the go-rpio library obtained above after
-	// 'main()' exits.
-	defer rpio.Close()
+	// Release resources held by the board obtained above after 'main()' exits.
+	// A fake or simulated board reports the pin's final state first.
+	defer func() {
+		gpio.Report(os.Stdout, board)
+		if err := board.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}()
 
 	// Select the GPIO pin to use, BCM pin 17
-	pin := rpio.Pin(17)
+	pin, err := board.Pin(17)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// Set the pin (BCM pin 17) to OUTPUT mode to allow writes to the pin,
 	// e.g., set the pin to LOW or HIGH
 	pin.Output()
 
+	if patternName != "" {
+		playPattern(pin, pattern)
+		return
+	}
+
+	if message != "" {
+		// A message can take a while to send, stop sending when the
+		// program is interrupted so the LED can be turned off.
+		stop := make(chan interface{})
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			close(stop)
+		}()
+
+		fmt.Println(morse.Format(symbols))
+		sendMorse(pin, symbols, timing, stop)
+
+		// Turn off the LED
+		pin.High()
+		return
+	}
+
 	for i := 0; i < 5; i++ {
 		// Setting the GPIO pin to LOW allows current to flow from the power source thru
 		// the anode to cathode turning on the LED.
@@ -49,3 +141,57 @@ func main() {
 	// Turn off the LED
 	pin.High()
 }
+
+// sendMorse blinks the LED attached to 'pin' to send 'symbols', printing each
+// character and its code as it's sent. It returns early if 'stop' is closed.
+func sendMorse(pin gpio.Pin, symbols []morse.Symbol, timing morse.Timing, stop chan interface{}) {
+	for i, sym := range symbols {
+		if sym.Code == "" {
+			fmt.Println("/")
+			continue
+		}
+		fmt.Printf("%-5s %s\n", sym.Text, sym.Code)
+
+		for _, e := range timing.Elements(symbols, i) {
+			// As above, LOW turns the LED on
+			if e.On {
+				pin.Low()
+			} else {
+				pin.High()
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(e.Duration):
+			}
+		}
+	}
+}
+
+// playPattern plays 'p' on the LED attached to 'pin' until the program is interrupted.
+// SIGUSR1 switches to the next named pattern.
+func playPattern(pin gpio.Pin, p blink.Pattern) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	patterns := make(chan blink.Pattern)
+	go func() {
+		names := blink.Names()
+		next := 0
+		for sig := range sigs {
+			if sig != syscall.SIGUSR1 {
+				cancel()
+				return
+			}
+			np, _ := blink.Lookup(names[next])
+			next = (next + 1) % len(names)
+			fmt.Printf("Playing %s: %s\n", np.Name, np.Source)
+			patterns <- np
+		}
+	}()
+
+	fmt.Printf("Playing %s, ctl-C to stop\n", p.Name)
+	blink.NewRunner(pin, true).Run(ctx, p, patterns)
+}
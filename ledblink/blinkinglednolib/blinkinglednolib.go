@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// This is the Go version of blinkinglednolib.c. Like the C version it doesn't use a
+// GPIO library (e.g., go-rpio), it uses the bcm package to access the BCM2835 registers
+// directly. It blinks the LED on BCM pin 17 twice a second until ctl-C is pressed.
+//
+// Run using 'go run blinkinglednolib.go'
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gpio/ledblink/bcm"
+)
+
+const ledPin = 17 // BCM GPIO pin 17
+
+func main() {
+	board, err := bcm.Open()
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("Unable to init GPIO.")
+		os.Exit(1)
+	}
+
+	// Gracefully handle interrupts, releases all resources prior to exiting
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+
+	// Set ledPin to output mode so it can be written to.
+	board.Fsel(ledPin, bcm.Output)
+
+	// Blink LED twice/second
+	for {
+		// Setting the GPIO pin to LOW allows current to flow from the power source thru
+		// the anode to cathode turning on the LED.
+		board.Clr(ledPin) // LED on
+		if sleep(500*time.Millisecond, sigs) {
+			break
+		}
+
+		board.Set(ledPin) // LED off
+		if sleep(500*time.Millisecond, sigs) {
+			break
+		}
+	}
+
+	board.Set(ledPin) // LED off
+	board.Close()     // Release resources
+
+	fmt.Println("\nExiting...")
+}
+
+// sleep pauses for 'd' and returns false, or returns true as soon as a signal is received
+func sleep(d time.Duration, sigs chan os.Signal) bool {
+	select {
+	case <-sigs:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
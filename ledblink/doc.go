@@ -1 +1,8 @@
-This is companion code for the article at https://youngkin.github.io/post/sunfoundergpionotesled/
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// This is companion code for the article at https://youngkin.github.io/post/sunfoundergpionotesled/
+package main
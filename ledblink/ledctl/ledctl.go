@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// ledctl sends a command to the ledd status LED daemon and prints its reply, e.g.,
+//
+//	go run ledctl.go blink 2Hz
+//	go run ledctl.go disk pattern "on 100ms, off 100ms, repeat 3, pause 1s"
+//
+// See ledd for the commands. ledctl exits with a non-zero status if the command fails.
+//
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	var (
+		socketPath string
+		timeout    time.Duration
+	)
+	flag.StringVar(&socketPath, "socket", "/tmp/ledd.sock", "path of ledd's Unix domain socket")
+	flag.DurationVar(&timeout, "timeout", 2*time.Second, "how long to wait for ledd to reply")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [LED] COMMAND [ARGS]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Commands are a single line, a multi-line pattern's lines are separated by ';' instead
+	command := strings.Join(flag.Args(), " ")
+	command = strings.Replace(command, "\n", ";", -1)
+
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "error") {
+		fmt.Fprintln(os.Stderr, reply)
+		os.Exit(1)
+	}
+	if text := strings.TrimSpace(strings.TrimPrefix(reply, "ok")); text != "" {
+		fmt.Println(text)
+	}
+}
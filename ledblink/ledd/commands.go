@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gpio/ledblink/blink"
+)
+
+// command runs a command on 'l', 'args' is the rest of the command line. It returns
+// the text of the reply, if any.
+type command func(l *led, leds []*led, args string) (string, error)
+
+// commands contains the daemon's commands
+var commands = map[string]command{
+	"set":      setCmd,
+	"on":       func(l *led, leds []*led, args string) (string, error) { return setCmd(l, leds, "on "+args) },
+	"off":      func(l *led, leds []*led, args string) (string, error) { return setCmd(l, leds, "off "+args) },
+	"blink":    blinkCmd,
+	"pattern":  patternCmd,
+	"status":   statusCmd,
+	"patterns": patternsCmd,
+}
+
+// run runs the command 'line'. The command applies to the first LED unless the
+// line starts with an LED's name.
+func run(line string, leds []*led) (string, error) {
+	l := leds[0]
+	name, rest := splitWord(line)
+	for _, candidate := range leds {
+		if candidate.name == name {
+			l = candidate
+			name, rest = splitWord(rest)
+			break
+		}
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("missing command for LED %s", l.name)
+	}
+	cmd, ok := commands[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown command or LED %q", name)
+	}
+	return cmd(l, leds, rest)
+}
+
+// splitWord returns the first word of 's' and the rest of it
+func splitWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
+
+// setCmd turns the LED on or off and leaves it that way
+func setCmd(l *led, leds []*led, args string) (string, error) {
+	state := strings.ToLower(strings.TrimSpace(args))
+	if state != "on" && state != "off" {
+		return "", fmt.Errorf("expected 'set on' or 'set off'")
+	}
+	p, err := blink.Parse(state)
+	if err != nil {
+		return "", err
+	}
+	l.play(p, state)
+	return "", nil
+}
+
+// blinkCmd blinks the LED at a frequency, e.g., '2Hz', with equal on and off times
+func blinkCmd(l *led, leds []*led, args string) (string, error) {
+	s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(args)), "hz")
+	freq, err := strconv.ParseFloat(s, 64)
+	if err != nil || freq < 0.05 || freq > 50 {
+		return "", fmt.Errorf("invalid frequency %q, must be 0.05Hz thru 50Hz", args)
+	}
+	half := time.Duration(float64(time.Second) / freq / 2)
+	p, err := blink.Parse(fmt.Sprintf("on %s, off %s", half, half))
+	if err != nil {
+		return "", err
+	}
+	l.play(p, fmt.Sprintf("blink %gHz", freq))
+	return "", nil
+}
+
+// patternCmd plays a named pattern or a pattern written in the blink package's language
+func patternCmd(l *led, leds []*led, args string) (string, error) {
+	if args == "" {
+		return "", fmt.Errorf("expected 'pattern NAME' or 'pattern PATTERN'")
+	}
+	p, err := blink.Lookup(args)
+	if err != nil {
+		return "", err
+	}
+	l.play(p, "pattern "+p.Name)
+	return "", nil
+}
+
+// statusCmd reports what every LED is doing
+func statusCmd(l *led, leds []*led, args string) (string, error) {
+	states := []string{}
+	for _, l := range leds {
+		states = append(states, l.status())
+	}
+	return strings.Join(states, "; "), nil
+}
+
+// patternsCmd lists the named patterns
+func patternsCmd(l *led, leds []*led, args string) (string, error) {
+	return strings.Join(blink.Names(), " "), nil
+}
@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gpio/ledblink/blink"
+)
+
+// testLEDs returns LEDs 'red' on BCM 17 and 'green' on BCM 27 whose patterns are
+// buffered, so commands don't wait for a runner
+func testLEDs(t *testing.T) []*led {
+	leds, err := parseLEDs("red=17,green=27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range leds {
+		l.patterns = make(chan blink.Pattern, 1)
+	}
+	return leds
+}
+
+// played returns the pattern sent to 'l', if any
+func played(l *led) (blink.Pattern, bool) {
+	select {
+	case p := <-l.patterns:
+		return p, true
+	default:
+		return blink.Pattern{}, false
+	}
+}
+
+func TestRun(t *testing.T) {
+	half := func(d time.Duration) []blink.Step {
+		return []blink.Step{{On: true, Duration: d}, {Duration: d}}
+	}
+	heartbeat, err := blink.Lookup("heartbeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line      string
+		led       int // the LED the command is for
+		wantSteps []blink.Step
+		wantHold  bool
+		wantState string
+	}{
+		{line: "on", led: 0, wantSteps: []blink.Step{{On: true}}, wantHold: true, wantState: "on"},
+		{line: "off", led: 0, wantSteps: []blink.Step{{}}, wantHold: true, wantState: "off"},
+		{line: "set on", led: 0, wantSteps: []blink.Step{{On: true}}, wantHold: true, wantState: "on"},
+		{line: "  SET   Off ", led: 0, wantSteps: []blink.Step{{}}, wantHold: true, wantState: "off"},
+		{line: "green on", led: 1, wantSteps: []blink.Step{{On: true}}, wantHold: true, wantState: "on"},
+		{line: "green\tset on", led: 1, wantSteps: []blink.Step{{On: true}}, wantHold: true, wantState: "on"},
+		{line: "blink 2Hz", led: 0, wantSteps: half(250 * time.Millisecond), wantState: "blink 2Hz"},
+		{line: "red blink 0.5hz", led: 0, wantSteps: half(time.Second), wantState: "blink 0.5Hz"},
+		{line: "blink 50", led: 0, wantSteps: half(10 * time.Millisecond), wantState: "blink 50Hz"},
+		{line: "blink 0.05Hz", led: 0, wantSteps: half(10 * time.Second), wantState: "blink 0.05Hz"},
+		{line: "pattern heartbeat", led: 0, wantSteps: heartbeat.Steps, wantState: "pattern heartbeat"},
+		{
+			line:      "green pattern on 1s, off 500ms, repeat 2",
+			led:       1,
+			wantSteps: []blink.Step{{On: true, Duration: time.Second}, {Duration: 500 * time.Millisecond}, {On: true, Duration: time.Second}, {Duration: 500 * time.Millisecond}},
+			wantState: "pattern on 1s, off 500ms, repeat 2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			leds := testLEDs(t)
+			reply, err := run(tc.line, leds)
+			if err != nil || reply != "" {
+				t.Fatalf("got reply %q, %v, want no reply", reply, err)
+			}
+			for i, l := range leds {
+				p, ok := played(l)
+				if i != tc.led {
+					if ok {
+						t.Errorf("LED %s was sent %+v", l.name, p)
+					}
+					continue
+				}
+				if !ok {
+					t.Fatalf("LED %s wasn't sent a pattern", l.name)
+				}
+				if !reflect.DeepEqual(p.Steps, tc.wantSteps) || p.Hold != tc.wantHold {
+					t.Errorf("got steps %v, hold %t, want %v, hold %t", p.Steps, p.Hold, tc.wantSteps, tc.wantHold)
+				}
+				if l.state != tc.wantState {
+					t.Errorf("got state %q, want %q", l.state, tc.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestRunReplies(t *testing.T) {
+	leds := testLEDs(t)
+	if _, err := run("green blink 1Hz", leds); err != nil {
+		t.Fatal(err)
+	}
+	played(leds[1])
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "status", want: "red(BCM 17)=off; green(BCM 27)=blink 1Hz"},
+		{line: "green status", want: "red(BCM 17)=off; green(BCM 27)=blink 1Hz"},
+		{line: "patterns", want: strings.Join(blink.Names(), " ")},
+		{line: "PATTERNS", want: strings.Join(blink.Names(), " ")},
+	}
+	for _, tc := range tests {
+		if reply, err := run(tc.line, leds); err != nil || reply != tc.want {
+			t.Errorf("%q: got reply %q, %v, want %q", tc.line, reply, err, tc.want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantErr string
+	}{
+		{line: "", wantErr: "missing command for LED red"},
+		{line: "green", wantErr: "missing command for LED green"},
+		{line: "flash", wantErr: `unknown command or LED "flash"`},
+		{line: "blue on", wantErr: `unknown command or LED "blue"`},
+		{line: "Red on", wantErr: `unknown command or LED "Red"`},
+		{line: "green red on", wantErr: `unknown command or LED "red"`},
+		{line: "set", wantErr: "expected 'set on' or 'set off'"},
+		{line: "set dim", wantErr: "expected 'set on' or 'set off'"},
+		{line: "on 1s", wantErr: "expected 'set on' or 'set off'"},
+		{line: "off now", wantErr: "expected 'set on' or 'set off'"},
+		{line: "blink", wantErr: `invalid frequency "", must be 0.05Hz thru 50Hz`},
+		{line: "blink fast", wantErr: `invalid frequency "fast"`},
+		{line: "blink 51Hz", wantErr: `invalid frequency "51Hz"`},
+		{line: "blink 0.01Hz", wantErr: `invalid frequency "0.01Hz"`},
+		{line: "blink -2Hz", wantErr: `invalid frequency "-2Hz"`},
+		{line: "blink 2 Hz", wantErr: `invalid frequency "2 Hz"`},
+		{line: "pattern", wantErr: "expected 'pattern NAME' or 'pattern PATTERN'"},
+		{line: "pattern sos", wantErr: `unknown statement "sos"`},
+		{line: "pattern on 0s", wantErr: `invalid duration "0s"`},
+		{line: "pattern on, off 1s", wantErr: `follows a held "on"`},
+	}
+
+	for _, tc := range tests {
+		leds := testLEDs(t)
+		_, err := run(tc.line, leds)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: got error %v, want one containing %q", tc.line, err, tc.wantErr)
+		}
+		for _, l := range leds {
+			if p, ok := played(l); ok {
+				t.Errorf("%q: LED %s was sent %+v", tc.line, l.name, p)
+			}
+			if l.state != "off" {
+				t.Errorf("%q: LED %s's state was changed to %q", tc.line, l.name, l.state)
+			}
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	leds := testLEDs(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		serve(ctx, server, leds)
+		close(done)
+	}()
+
+	replies := bufio.NewScanner(client)
+	for _, tc := range []struct{ line, want string }{
+		{line: "on", want: "ok"},
+		{line: "", want: ""},
+		{line: "green status", want: "ok red(BCM 17)=on; green(BCM 27)=off"},
+		{line: "green bogus", want: `error unknown command or LED "bogus"`},
+	} {
+		if _, err := client.Write([]byte(tc.line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if tc.want == "" {
+			// Blank lines aren't answered
+			continue
+		}
+		if !replies.Scan() {
+			t.Fatalf("%q: no reply, %v", tc.line, replies.Err())
+		}
+		if got := replies.Text(); got != tc.want {
+			t.Errorf("%q: got reply %q, want %q", tc.line, got, tc.want)
+		}
+	}
+	if p, ok := played(leds[0]); !ok || !p.Hold {
+		t.Errorf("got %+v, %t, want the red LED held on", p, ok)
+	}
+
+	// The connection is closed when the daemon stops
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("serve didn't return when the daemon stopped")
+	}
+}
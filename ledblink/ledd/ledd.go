@@ -0,0 +1,270 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// ledd is a daemon that owns one or more status LEDs and accepts commands over a
+// Unix domain socket, so other programs can signal their state without needing
+// access to the GPIO pins or linking go-rpio. Use ledctl, or anything that can
+// write a line to a Unix socket, to send it commands, e.g.,
+//
+//	ledctl set on
+//	ledctl blink 2Hz
+//	ledctl pattern error
+//	ledctl disk pattern "on 50ms, off 950ms"
+//	ledctl off
+//
+// Commands are one per line, each gets a one line reply that starts with 'ok' or
+// 'error'. A command applies to the first LED unless it starts with an LED's name.
+// The commands are
+//
+//	set on|off       turn the LED on or off and leave it that way
+//	on, off          the same as 'set on' and 'set off'
+//	blink FREQ       blink the LED, e.g., 'blink 2Hz' or 'blink 0.5'
+//	pattern PATTERN  play a named pattern, e.g., 'heartbeat', or a pattern such as
+//	                 'on 100ms, off 100ms, repeat 3, pause 1s' (see the blink package)
+//	status           report what every LED is doing
+//	patterns         list the named patterns
+//
+// Run using 'go run ledd.go', with '-leds' to name the LEDs and their BCM pins, e.g.,
+// '-leds power=17,disk=27'. By default the socket can be used by the daemon's user
+// and group, '-group' and '-mode' control who else can use it. '-backend' selects how
+// the pins are driven, e.g., '-backend=cdev' uses the GPIO character device so the
+// daemon doesn't need root, and '-backend=sim' runs it without a Raspberry Pi.
+//
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/ledblink/blink"
+)
+
+// led is an LED owned by the daemon
+type led struct {
+	name     string
+	bcm      int
+	patterns chan blink.Pattern
+
+	mu    sync.Mutex
+	state string // what the LED is doing, reported by 'status'
+}
+
+// play switches the LED to 'p', 'state' describes it for 'status'
+func (l *led) play(p blink.Pattern, state string) {
+	l.patterns <- p
+	l.mu.Lock()
+	l.state = state
+	l.mu.Unlock()
+}
+
+func (l *led) status() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprintf("%s(BCM %d)=%s", l.name, l.bcm, l.state)
+}
+
+func main() {
+	var (
+		socketPath string
+		ledSpec    string
+		active     string
+		group      string
+		mode       string
+		backend    string
+		chipName   string
+	)
+	flag.StringVar(&socketPath, "socket", "/tmp/ledd.sock", "path of the Unix domain socket to listen on")
+	flag.StringVar(&ledSpec, "leds", "led=17", "comma separated list of LEDs as 'name=BCM pin', the first one is the default")
+	flag.StringVar(&active, "active", "low", "pin level, 'low' or 'high', that turns the LEDs on")
+	flag.StringVar(&group, "group", "", "group that owns the socket, defaults to the daemon's group")
+	flag.StringVar(&mode, "mode", "0660", "permissions of the socket")
+	flag.StringVar(&backend, "backend", "rpio", "how the LEDs' pins are driven, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	flag.Parse()
+
+	leds, err := parseLEDs(ledSpec)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if active != "low" && active != "high" {
+		fmt.Printf("invalid active level %q, must be 'low' or 'high'\n", active)
+		os.Exit(1)
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		fmt.Printf("invalid socket mode %q, must be octal, e.g., 0660\n", mode)
+		os.Exit(1)
+	}
+
+	listener, err := listen(socketPath, os.FileMode(perm), group)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	board, err := gpio.Open(backend, chipName)
+	if err != nil {
+		listener.Close()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	pins := []gpio.Pin{}
+	for _, l := range leds {
+		pin, err := board.Pin(l.bcm)
+		if err != nil {
+			listener.Close()
+			board.Close()
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		pins = append(pins, pin)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Println("\nExiting...")
+		cancel()
+		// Closing the listener removes the socket and stops accepting connections
+		listener.Close()
+	}()
+
+	// Each LED is driven by its own runner, the LEDs start off
+	var wg sync.WaitGroup
+	off, _ := blink.Parse("off")
+	for i, l := range leds {
+		pin := pins[i]
+		pin.Output()
+		runner := blink.NewRunner(pin, active == "low")
+		wg.Add(1)
+		go func(l *led) {
+			defer wg.Done()
+			runner.Run(ctx, off, l.patterns)
+		}(l)
+	}
+
+	fmt.Printf("Listening on %s\n", socketPath)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Println(err)
+				cancel()
+			}
+			break
+		}
+		go serve(ctx, conn, leds)
+	}
+
+	// The runners turn the LEDs off when they stop
+	wg.Wait()
+	gpio.Report(os.Stdout, board)
+	if err := board.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// parseLEDs parses a list of 'name=BCM pin' LEDs
+func parseLEDs(spec string) ([]*led, error) {
+	leds := []*led{}
+	names := map[string]bool{}
+	pins := map[int]bool{}
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid LED %q, expected 'name=BCM pin'", field)
+		}
+		name := parts[0]
+		if _, ok := commands[name]; ok || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid LED name %q, it can't be a command or contain spaces", name)
+		}
+		bcm, err := strconv.Atoi(parts[1])
+		if err != nil || bcm < 0 || bcm > 27 {
+			return nil, fmt.Errorf("invalid pin %q for LED %s, must be a BCM pin, 0 thru 27", parts[1], name)
+		}
+		if names[name] || pins[bcm] {
+			return nil, fmt.Errorf("LED %q is a duplicate name or pin", field)
+		}
+		names[name], pins[bcm] = true, true
+		leds = append(leds, &led{name: name, bcm: bcm, patterns: make(chan blink.Pattern), state: "off"})
+	}
+	return leds, nil
+}
+
+// listen creates the socket at 'path'. A socket left behind by a daemon that didn't
+// exit cleanly is removed, but not one that's in use.
+func listen(path string, perm os.FileMode, group string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use, is ledd already running?", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		if err := os.Chown(path, -1, gid); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// serve runs the commands sent on 'conn' until the client closes it or the daemon stops
+func serve(ctx context.Context, conn net.Conn, leds []*led) {
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply, err := run(line, leds)
+		if err != nil {
+			reply = "error " + err.Error()
+		} else {
+			reply = strings.TrimSpace("ok " + reply)
+		}
+		if _, err := fmt.Fprintln(conn, reply); err != nil {
+			return
+		}
+	}
+}
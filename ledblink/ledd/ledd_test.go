@@ -0,0 +1,61 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLEDs(t *testing.T) {
+	tests := []struct {
+		spec      string
+		wantNames []string
+		wantPins  []int
+		wantErr   string
+	}{
+		{spec: "led=17", wantNames: []string{"led"}, wantPins: []int{17}},
+		{spec: "red=17, green=27 ,blue=0", wantNames: []string{"red", "green", "blue"}, wantPins: []int{17, 27, 0}},
+		{spec: "", wantErr: `invalid LED "", expected 'name=BCM pin'`},
+		{spec: "red", wantErr: `invalid LED "red", expected 'name=BCM pin'`},
+		{spec: "=17", wantErr: `invalid LED "=17", expected 'name=BCM pin'`},
+		{spec: "red=17,", wantErr: `invalid LED "", expected 'name=BCM pin'`},
+		{spec: "red=", wantErr: `invalid pin "" for LED red, must be a BCM pin, 0 thru 27`},
+		{spec: "red=x", wantErr: `invalid pin "x" for LED red`},
+		{spec: "red=28", wantErr: `invalid pin "28" for LED red`},
+		{spec: "red=-1", wantErr: `invalid pin "-1" for LED red`},
+		{spec: "red=17=18", wantErr: `invalid pin "17=18" for LED red`},
+		{spec: "status=17", wantErr: `invalid LED name "status", it can't be a command or contain spaces`},
+		{spec: "on=17", wantErr: `invalid LED name "on"`},
+		{spec: "red led=17", wantErr: `invalid LED name "red led"`},
+		{spec: "red=17,red=27", wantErr: `LED "red=27" is a duplicate name or pin`},
+		{spec: "red=17,green=17", wantErr: `LED "green=17" is a duplicate name or pin`},
+	}
+
+	for _, tc := range tests {
+		leds, err := parseLEDs(tc.spec)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q: got error %v, want one containing %q", tc.spec, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tc.spec, err)
+			continue
+		}
+		if len(leds) != len(tc.wantNames) {
+			t.Errorf("%q: got %d LEDs, want %d", tc.spec, len(leds), len(tc.wantNames))
+			continue
+		}
+		for i, l := range leds {
+			if l.name != tc.wantNames[i] || l.bcm != tc.wantPins[i] || l.state != "off" || l.patterns == nil {
+				t.Errorf("%q: got LED %d %s", tc.spec, i, l.status())
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// This is the Go version of matrixlednolib.c. Like the C version it doesn't use a GPIO
+// library (e.g., go-rpio), it uses the bcm package to access the BCM2835 registers
+// directly. It must be run as root since SPI0 is only available via /dev/mem.
+//
+// This program demonstrates controlling a MAX7219 LED display by causing it to display
+// the numbers 0-9 and the letters A-Z.
+//
+// References:
+//  1. https://datasheets.maximintegrated.com/en/ds/MAX7219-MAX7221.pdf - MAX7219 LED display datasheet
+//  2. https://www.airspayce.com/mikem/bcm2835/index.html - BCM2835 library documentation
+//
+// Run using 'sudo go run matrixlednolib.go'
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gpio/ledblink/bcm"
+)
+
+const (
+	max7219PinCS = bcm.SPI0CE0 // Pi pin 24, GPIO pin 8
+	numChars     = 37          // number of characters to display on the LED matrix
+	matrixRow    = 8           // LED matrix row values (i.e., which LEDs to light on a given matrix row) to create a character
+	numScroll    = 64          // Scrolling display
+)
+
+// numChars represents a specific character to create on the LED matrix display. `disp1`
+// contains the specification of characters 0-9, A-Z, and the greek theta character.
+// matrixRow contains the hex representation to create a display character. Each hex character
+// defines which LEDs to turn on in each row of the LED matrix. In the first row of the `disp1`
+// array 0x3C is represented in binary as 0011 1100. This will cause the middle 4 LEDS in the
+// first LED matrix display row to be lit and the 2 LEDS closest to each edge will be unlit.
+// 0x42 (0100 0010) specifies the LEDs to be lit in the second row of the LED Matrix display.
+// And so on for the remaining characters in the first numChars of the array until each of the rows
+// of the LED Matrix display have been set. The characters in this array row in binary represent the
+// following character in the LED Matrix display. In the representation below the 0's are replaced
+// with spaces:
+//
+//	  1111
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	  1111
+//
+//	If you follow the pattern of 1's in the above rows you can see that they represent the
+//	number 0. Recall that spaces replaced 0's.
+var disp1 = [numChars][matrixRow]byte{
+	{0x3C, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x3C}, //0
+	{0x08, 0x18, 0x28, 0x08, 0x08, 0x08, 0x08, 0x08}, //1
+	{0x7E, 0x2, 0x2, 0x7E, 0x40, 0x40, 0x40, 0x7E},   //2
+	{0x3E, 0x2, 0x2, 0x3E, 0x2, 0x2, 0x3E, 0x0},      //3
+	{0x8, 0x18, 0x28, 0x48, 0xFE, 0x8, 0x8, 0x8},     //4
+	{0x3C, 0x20, 0x20, 0x3C, 0x4, 0x4, 0x3C, 0x0},    //5
+	{0x3C, 0x20, 0x20, 0x3C, 0x24, 0x24, 0x3C, 0x0},  //6
+	{0x3E, 0x22, 0x4, 0x8, 0x8, 0x8, 0x8, 0x8},       //7
+	{0x0, 0x3E, 0x22, 0x22, 0x3E, 0x22, 0x22, 0x3E},  //8
+	{0x3E, 0x22, 0x22, 0x3E, 0x2, 0x2, 0x2, 0x3E},    //9
+	{0x8, 0x14, 0x22, 0x3E, 0x22, 0x22, 0x22, 0x22},  //A
+	{0x3C, 0x22, 0x22, 0x3E, 0x22, 0x22, 0x3C, 0x0},  //B
+	{0x3C, 0x40, 0x40, 0x40, 0x40, 0x40, 0x3C, 0x0},  //C
+	{0x7C, 0x42, 0x42, 0x42, 0x42, 0x42, 0x7C, 0x0},  //D
+	{0x7C, 0x40, 0x40, 0x7C, 0x40, 0x40, 0x40, 0x7C}, //E
+	{0x7C, 0x40, 0x40, 0x7C, 0x40, 0x40, 0x40, 0x40}, //F
+	{0x3C, 0x40, 0x40, 0x40, 0x40, 0x44, 0x44, 0x3C}, //G
+	{0x44, 0x44, 0x44, 0x7C, 0x44, 0x44, 0x44, 0x44}, //H
+	{0x7C, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x7C}, //I
+	{0x3C, 0x8, 0x8, 0x8, 0x8, 0x8, 0x48, 0x30},      //J
+	{0x0, 0x24, 0x28, 0x30, 0x20, 0x30, 0x28, 0x24},  //K
+	{0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x7C}, //L
+	{0x81, 0xC3, 0xA5, 0x99, 0x81, 0x81, 0x81, 0x81}, //M
+	{0x0, 0x42, 0x62, 0x52, 0x4A, 0x46, 0x42, 0x0},   //N
+	{0x3C, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x3C}, //O
+	{0x3C, 0x22, 0x22, 0x22, 0x3C, 0x20, 0x20, 0x20}, //P
+	{0x1C, 0x22, 0x22, 0x22, 0x22, 0x26, 0x22, 0x1D}, //Q
+	{0x3C, 0x22, 0x22, 0x22, 0x3C, 0x24, 0x22, 0x21}, //R
+	{0x0, 0x1E, 0x20, 0x20, 0x3E, 0x2, 0x2, 0x3C},    //S
+	{0x0, 0x3E, 0x8, 0x8, 0x8, 0x8, 0x8, 0x8},        //T
+	{0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x3E}, //U
+	{0x22, 0x22, 0x22, 0x22, 0x22, 0x22, 0x14, 0x8},  //V
+	//    {0x42,0x42,0x42,0x42,0x42,0x42,0x22,0x1C},  //U
+	//    {0x42,0x42,0x42,0x42,0x42,0x42,0x24,0x18},  //V
+	{0x0, 0x49, 0x49, 0x49, 0x49, 0x2A, 0x1C, 0x0}, //W
+	{0x0, 0x41, 0x22, 0x14, 0x8, 0x14, 0x22, 0x41}, //X
+	{0x41, 0x22, 0x14, 0x8, 0x8, 0x8, 0x8, 0x8},    //Y
+	{0x0, 0x7F, 0x2, 0x4, 0x8, 0x10, 0x20, 0x7F},   //Z
+	{0x18, 0x24, 0x42, 0xFF, 0x42, 0x24, 0x18},     //Theta
+}
+
+// scrollDisp is a diagonal line scrolling across the display, one frame per row
+var scrollDisp = [numScroll][matrixRow]byte{
+	{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x40, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x20, 0x40, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x10, 0x20, 0x40, 0x80, 0x00, 0x00, 0x00, 0x00},
+	{0x08, 0x10, 0x20, 0x40, 0x80, 0x00, 0x00, 0x00},
+	{0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x00, 0x00},
+	{0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x00},
+	{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80},
+	{0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40},
+	{0x00, 0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20},
+	{0x00, 0x00, 0x00, 0x01, 0x02, 0x04, 0x08, 0x10},
+	{0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x04, 0x08},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x04},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x04},
+	{0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x04, 0x08},
+	{0x00, 0x00, 0x00, 0x01, 0x02, 0x04, 0x08, 0x10},
+	{0x00, 0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20},
+	{0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40},
+	{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80},
+	{0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x00},
+	{0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x00, 0x00},
+	{0x08, 0x10, 0x20, 0x40, 0x80, 0x00, 0x00, 0x00},
+	{0x10, 0x20, 0x40, 0x80, 0x00, 0x00, 0x00, 0x00},
+	{0x20, 0x40, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x40, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x40},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x40, 0x20},
+	{0x00, 0x00, 0x00, 0x00, 0x80, 0x40, 0x20, 0x10},
+	{0x00, 0x00, 0x00, 0x80, 0x40, 0x20, 0x10, 0x08},
+	{0x00, 0x00, 0x80, 0x40, 0x20, 0x10, 0x08, 0x04},
+	{0x00, 0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01},
+	{0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00},
+	{0x20, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00},
+	{0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00, 0x00},
+	{0x08, 0x04, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00},
+	{0x04, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+
+	{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x04, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x08, 0x04, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00},
+	{0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00, 0x00},
+	{0x20, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00},
+	{0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00},
+	{0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01},
+	{0x00, 0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x00, 0x00, 0x80, 0x40, 0x20, 0x10, 0x08, 0x04},
+	{0x00, 0x00, 0x00, 0x80, 0x40, 0x20, 0x10, 0x08},
+	{0x00, 0x00, 0x00, 0x00, 0x80, 0x40, 0x20, 0x10},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x40, 0x20},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80, 0x40},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x80},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+}
+
+// writeMax7219Byte writes 1 byte to the MAX7219 display driver. The MAX7219 expects 16 bits, 2 bytes, to be
+// written before data is transferred to the display. See https://datasheets.maximintegrated.com/en/ds/MAX7219-MAX7221.pdf,
+// Table 1. Serial-Data Format (16 bits) for more detail.
+func writeMax7219Byte(board *bcm.Board, data byte) {
+	board.SPITransfer(data)
+}
+
+// writeMax7219 writes 'dat1' to the MAX7219 register 'address1'. 'address1' can reference a
+// row on the display (1-8) or control registers 9, a, b, c, and f. The control
+// registers are used to specify things like the brightness of the display's LEDs.
+// See https://datasheets.maximintegrated.com/en/ds/MAX7219-MAX7221.pdf, Table 2. Register
+// Address Map for more details regarding writing to the LED matrix vs. the control registers. Also
+// see 'initMax7219()' for the implementation of control register use in this program.
+func writeMax7219(board *bcm.Board, address1, dat1 byte) {
+	// Enable chip select (CE0) using GPIO pin write (vs. SPI). This is needed to enable
+	// data transfer to the SPI device connected to SPI0 CE0 pin. Chip select is also
+	// known as chip enable (CE).
+	board.Clr(max7219PinCS)
+	writeMax7219Byte(board, address1) // Choose row in the Max7219 address register.
+	writeMax7219Byte(board, dat1)     // Write data to the selected address register.
+	// Disable Chip Select. At this point address1 and dat1 have been written into the
+	// MAX7219's shift register. When the CS pin is set to high this data will be
+	// transferred to the LED display.
+	board.Set(max7219PinCS)
+}
+
+// initMax7219 initializes the control registers on the MAX7219 display driver.
+// See https://datasheets.maximintegrated.com/en/ds/MAX7219-MAX7221.pdf, Table 2. Register
+// Address Map, for details.
+func initMax7219(board *bcm.Board) {
+	writeMax7219(board, 0x09, 0x00) // Decode mode register
+	writeMax7219(board, 0x0a, 0x03) //  medium brightness
+	//    writeMax7219(board, 0x0a,0x0f);// max brightness
+	writeMax7219(board, 0x0b, 0x07) // Scan limit register
+	writeMax7219(board, 0x0c, 0x01) // Shutdown register
+	writeMax7219(board, 0x0f, 0x00) // Display test register, normal mode
+	//    writeMax7219(board, 0x0f,0x01);// Display test register, test mode (light all leds)
+}
+
+// initSPI initializes the SPI0 interface on the BCM2835 board
+func initSPI(board *bcm.Board) error {
+	// Defines which pins will be used for SPI and sets them to SPI mode (Alternate function 0).
+	if err := board.SPIBegin(); err != nil {
+		return err
+	}
+	// Using most significant bit ordering. The MAX7219 uses MSB ordering.
+	// See https://datasheets.maximintegrated.com/en/ds/MAX7219-MAX7221.pdf,
+	// see Table 1 page 6, for more details. More importantly, the BCM2835
+	// board only supports MSB addressing.
+	board.SPISetBitOrder(bcm.MSBFirst)
+	board.SPISetDataMode(0)                       // Set clock polarity and phase. Mostly don't worry about this.
+	board.SPISetClockDivider(bcm.ClockDivider256) // Set the clock speed. Mostly don't worry about this.
+	board.Fsel(max7219PinCS, bcm.Output)          // set chip select pin to OUTPUT so it can be set HIGH/LOW.
+	return nil
+}
+
+// NOTE: the use of the SPI0 set of pins is hardcoded (i.e., GPIO pins 7-11 are used).
+func main() {
+	board, err := bcm.Open()
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("Unable to init bcm2835.")
+		os.Exit(1)
+	}
+
+	// Gracefully handle ctl-C, clearing the display and releasing all resources prior to exiting
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+
+	if err := initSPI(board); err != nil {
+		fmt.Println(err)
+		board.Close()
+		os.Exit(1)
+	}
+	time.Sleep(50 * time.Millisecond)
+	initMax7219(board)
+
+	// Iterate through the disp1 array writing to the MAX7219 display driver. For each character written
+	// delay 300ms in order to provide time to see the character displayed on the LED Matrix display.
+	for running := true; running; {
+		for j := 0; j < numChars && running; j++ {
+			for i := 1; i < matrixRow+1; i++ {
+				writeMax7219(board, byte(i), disp1[j][i-1])
+			}
+			running = !sleep(300*time.Millisecond, sigs)
+		}
+
+		for j := 0; j < numScroll && running; j++ {
+			for i := 1; i < matrixRow+1; i++ {
+				writeMax7219(board, byte(i), scrollDisp[j][i-1])
+			}
+			running = !sleep(25*time.Millisecond, sigs)
+		}
+	}
+
+	// Clear display
+	for i := 1; i < 9; i++ {
+		writeMax7219(board, byte(i), 0x0)
+	}
+
+	// release resources
+	board.SPIEnd()
+	board.Close() // reverses bcm.Open()
+
+	fmt.Println("\nExiting...")
+}
+
+// sleep pauses for 'd' and returns false, or returns true as soon as a signal is received
+func sleep(d time.Duration, sigs chan os.Signal) bool {
+	select {
+	case <-sigs:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
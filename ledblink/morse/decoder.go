@@ -0,0 +1,225 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package morse
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// recent is the number of marks, and of spaces between characters or words, the
+// decoder uses to estimate the sender's speed and spacing
+const recent = 16
+
+// prosigns are decoded when a code isn't a character. AR, BT, KN, and AS have the same
+// codes as '+', '=', '(', and '&', so they're decoded as those characters.
+var prosigns = []string{"SK", "SOS", "HH", "CT", "SN"}
+
+// decodeTable maps codes to the characters and prosigns they decode to
+var decodeTable = func() map[string]string {
+	table := map[string]string{}
+	for r, code := range codes {
+		// '×' is sent the same as 'X'
+		if r != '×' {
+			table[code] = string(r)
+		}
+	}
+	for _, p := range prosigns {
+		code := ""
+		for _, l := range p {
+			code += codes[l]
+		}
+		if _, ok := table[code]; !ok {
+			table[code] = "<" + p + ">"
+		}
+	}
+	return table
+}()
+
+// Decode returns the character or prosign sent as 'code', or the code itself in
+// square brackets if it isn't recognized.
+func Decode(code string) string {
+	if text, ok := decodeTable[code]; ok {
+		return text
+	}
+	return "[" + code + "]"
+}
+
+// Decoder converts the lengths of marks and spaces into text. It adapts to the
+// sender's speed, hand sent code in particular rarely matches the speed it's
+// expected to be.
+//
+// The speed is estimated from the most recent marks. When they include both dots
+// and dashes they're split into two groups at the largest ratio between their
+// lengths, the dot length is then the average of the short marks and a third of
+// the average of the long ones. When the marks are all about the same length the
+// current estimate decides whether they're dots or dashes. The space between
+// characters is estimated the same way from the recent spaces that ended a
+// character or word, so code sent with Farnsworth timing is also decoded.
+type Decoder struct {
+	dot       time.Duration   // estimated length of a dot
+	charSpace time.Duration   // estimated space between characters
+	marks     []time.Duration // recent marks, most recent last
+	gaps      []time.Duration // recent spaces between characters or words, most recent last
+	space     time.Duration   // length of the current space so far
+	code      string          // dots and dashes of the character being received
+	// charDone and wordDone are true once the current space has ended the
+	// character or the word. wordDone starts true so text never starts with a space.
+	charDone, wordDone bool
+}
+
+// NewDecoder returns a decoder that initially expects code sent at 'wpm' words per minute
+func NewDecoder(wpm float64) *Decoder {
+	t := Timing{WPM: wpm}
+	return &Decoder{dot: t.Dot(), charSpace: t.CharSpace(), wordDone: true}
+}
+
+// WPM returns the estimate of the sender's character speed in words per minute
+func (d *Decoder) WPM() float64 {
+	return float64(1200*time.Millisecond) / float64(d.dot)
+}
+
+// Mark records a mark, the input being on, that lasted 'length'. Space must be
+// called with the full length of the space before the mark, if there was one.
+func (d *Decoder) Mark(length time.Duration) {
+	gap := d.space >= 2*d.dot
+	if gap {
+		d.gaps = addRecent(d.gaps, d.space)
+	}
+	d.space = 0
+
+	d.marks = addRecent(d.marks, length)
+	d.estimateSpeed()
+	if gap {
+		d.estimateSpacing()
+	}
+
+	if length < 2*d.dot {
+		d.code += "."
+	} else {
+		d.code += "-"
+	}
+	d.charDone, d.wordDone = false, false
+}
+
+// Space reports that the input has been off for 'length' since the end of the last
+// mark. It can be called repeatedly as the space gets longer, e.g., while waiting
+// for the next mark, so that text is decoded as it's received. It returns the text
+// the space completes, the character being received once the space is long enough
+// to end it, and then " " once it's long enough to end the word.
+func (d *Decoder) Space(length time.Duration) string {
+	d.space = length
+	text := ""
+	if !d.charDone && length >= 2*d.dot {
+		text += d.Flush()
+	}
+	if d.charDone && !d.wordDone && length >= d.wordSpace() {
+		d.wordDone = true
+		text += " "
+	}
+	return text
+}
+
+// Flush returns the character being received, if there is one, e.g., at the end of
+// the input.
+func (d *Decoder) Flush() string {
+	d.charDone = true
+	if d.code == "" {
+		return ""
+	}
+	text := Decode(d.code)
+	d.code = ""
+	return text
+}
+
+// wordSpace returns the shortest space that ends a word. It's halfway between the
+// nominal 3 unit space between characters and the 7 unit space between words.
+func (d *Decoder) wordSpace() time.Duration {
+	return d.charSpace * 5 / 3
+}
+
+// estimateSpeed updates the estimated dot length from the recent marks
+func (d *Decoder) estimateSpeed() {
+	// A dash is nominally 3 times as long as a dot, anything over 2 allows for
+	// sloppy sending while still telling dots from dashes.
+	if dots, dashes, ok := split(d.marks, 2); ok {
+		d.dot = (dots + dashes/3) / 2
+		return
+	}
+	if m := mean(d.marks); m < 2*d.dot {
+		d.dot = m
+	} else {
+		d.dot = m / 3
+	}
+}
+
+// estimateSpacing updates the estimated space between characters from the recent
+// spaces between characters and words
+func (d *Decoder) estimateSpacing() {
+	// Spaces recorded before the speed estimate caught up with the sender can be
+	// too short to end a character at the sender's speed, they're ignored
+	gaps := []time.Duration{}
+	for _, g := range d.gaps {
+		if g >= 2*d.dot {
+			gaps = append(gaps, g)
+		}
+	}
+	if len(gaps) == 0 {
+		return
+	}
+
+	// A word space is nominally 7/3 as long as a character space, anything over
+	// 1.4 allows for uneven spacing
+	if chars, _, ok := split(gaps, 1.4); ok {
+		d.charSpace = chars
+		return
+	}
+	// The spaces are all the same length, they're character spaces if they're
+	// short enough for either the current spacing or the current speed.
+	if m := mean(gaps); m < d.wordSpace() || m < 5*d.dot {
+		d.charSpace = m
+	} else {
+		d.charSpace = m * 3 / 7
+	}
+}
+
+// split divides 'durations' into short and long groups at the largest ratio between
+// successive lengths and returns the average of each group. 'ok' is false if the
+// ratio is less than 'minRatio', i.e., the durations all belong to one group.
+func split(durations []time.Duration, minRatio float64) (short, long time.Duration, ok bool) {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at, ratio := 0, 0.0
+	for i := 1; i < len(sorted); i++ {
+		if r := float64(sorted[i]) / math.Max(1, float64(sorted[i-1])); r > ratio {
+			at, ratio = i, r
+		}
+	}
+	if ratio < minRatio {
+		return 0, 0, false
+	}
+	return mean(sorted[:at]), mean(sorted[at:]), true
+}
+
+// addRecent appends 'd' to 'durations', dropping the oldest if there are more than 'recent'
+func addRecent(durations []time.Duration, d time.Duration) []time.Duration {
+	durations = append(durations, d)
+	if len(durations) > recent {
+		durations = durations[1:]
+	}
+	return durations
+}
+
+func mean(durations []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	return sum / time.Duration(len(durations))
+}
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package morse
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// record returns the times, in milliseconds from the start, of the edges of
+// 'text' sent with timing 't'. The edges alternate between the input turning on
+// and off, starting with on. Each element's length is changed by up to 'jitter'
+// percent, the way hand sent code or a slow receiver would record it.
+func record(tb testing.TB, text string, t Timing, jitter float64, seed int64) []float64 {
+	symbols, err := Encode(text)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(seed))
+	edges := []float64{0}
+	at := 0.0
+	for i := range symbols {
+		for _, e := range t.Elements(symbols, i) {
+			ms := float64(e.Duration) / float64(time.Millisecond)
+			at += ms * (1 + jitter/100*(2*r.Float64()-1))
+			edges = append(edges, at)
+		}
+	}
+	return edges
+}
+
+// decode feeds the time between each of 'edges' to a decoder and returns the
+// text. Each space is reported every 'poll' as it gets longer, as a receiver
+// waiting for the next edge would, or all at once if 'poll' is 0.
+func decode(d *Decoder, edges []float64, poll float64) string {
+	text := ""
+	for i := 1; i < len(edges); i++ {
+		length := edges[i] - edges[i-1]
+		if i%2 == 1 {
+			d.Mark(ms(length))
+			continue
+		}
+		if poll > 0 {
+			for waited := poll; waited < length; waited += poll {
+				text += d.Space(ms(waited))
+			}
+		}
+		text += d.Space(ms(length))
+	}
+	return text + d.Flush()
+}
+
+func ms(f float64) time.Duration {
+	return time.Duration(f * float64(time.Millisecond))
+}
+
+func TestDecodeRecorded(t *testing.T) {
+	// "CQ DE" hand sent at about 15 WPM (80ms dots), dashes a little short and the
+	// spaces uneven
+	edges := []float64{
+		0, 231, 318, 390, 462, 688, 775, 848, // C
+		1101, 1345, 1424, 1653, 1728, 1806, 1889, 2121, // Q
+		2696, 2922, 3006, 3083, 3159, 3235, // D
+		3497, 3575, // E
+	}
+
+	for _, poll := range []float64{0, 10} {
+		d := NewDecoder(15)
+		if got := decode(d, edges, poll); got != "CQ DE" {
+			t.Errorf("polling every %gms: got %q, want %q", poll, got, "CQ DE")
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	const text = "THE QUICK BROWN FOX JUMPS OVER THE LAZY DOG 0123456789"
+
+	tests := []struct {
+		name   string
+		timing Timing
+		wpm    float64 // the speed the decoder expects
+		jitter float64 // percent
+		poll   float64 // milliseconds
+	}{
+		{name: "exact", timing: Timing{WPM: 20}, wpm: 20},
+		{name: "jitter", timing: Timing{WPM: 20}, wpm: 20, jitter: 15},
+		{name: "jitter polled", timing: Timing{WPM: 20}, wpm: 20, jitter: 15, poll: 5},
+		{name: "faster than expected", timing: Timing{WPM: 30}, wpm: 15, jitter: 10},
+		{name: "slower than expected", timing: Timing{WPM: 10}, wpm: 25, jitter: 10},
+		{name: "farnsworth", timing: Timing{WPM: 20, FarnsworthWPM: 10}, wpm: 20},
+		{name: "farnsworth jitter", timing: Timing{WPM: 18, FarnsworthWPM: 5}, wpm: 18, jitter: 15},
+		{name: "farnsworth jitter polled", timing: Timing{WPM: 25, FarnsworthWPM: 8}, wpm: 25, jitter: 15, poll: 5},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for seed := int64(1); seed <= 20; seed++ {
+				d := NewDecoder(tc.wpm)
+				got := decode(d, record(t, "VVV "+text, tc.timing, tc.jitter, seed), tc.poll)
+				// The decoder is given a few characters to find the sender's speed
+				want := "VVV " + text
+				if len(got) < len(text) || got[len(got)-len(text):] != text {
+					t.Errorf("seed %d: got %q, want %q", seed, got, want)
+				}
+				if wpm := d.WPM(); wpm < tc.timing.WPM*0.8 || wpm > tc.timing.WPM*1.2 {
+					t.Errorf("seed %d: estimated %.1f WPM, want about %g", seed, wpm, tc.timing.WPM)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeProsigns(t *testing.T) {
+	tests := []struct {
+		code, want string
+	}{
+		{code: "...-.-", want: "<SK>"},
+		{code: "...---...", want: "<SOS>"},
+		{code: ".-.-.", want: "+"},
+		{code: "-..-", want: "X"},
+		{code: "........", want: "<HH>"},
+		{code: "..--..--", want: "[..--..--]"},
+	}
+	for _, tc := range tests {
+		if got := Decode(tc.code); got != tc.want {
+			t.Errorf("Decode(%q) = %q, want %q", tc.code, got, tc.want)
+		}
+	}
+}
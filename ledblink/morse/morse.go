@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package morse encodes text as International (ITU) Morse code and computes the
+// timing needed to send it, e.g., by blinking an LED.
+package morse
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// codes contains the ITU-R M.1677 letters, digits, and punctuation. '!', '&', ';',
+// '_', and '$' aren't part of the ITU standard but are in common use.
+var codes = map[rune]string{
+	'A': ".-", 'B': "-...", 'C': "-.-.", 'D': "-..", 'E': ".", 'F': "..-.",
+	'G': "--.", 'H': "....", 'I': "..", 'J': ".---", 'K': "-.-", 'L': ".-..",
+	'M': "--", 'N': "-.", 'O': "---", 'P': ".--.", 'Q': "--.-", 'R': ".-.",
+	'S': "...", 'T': "-", 'U': "..-", 'V': "...-", 'W': ".--", 'X': "-..-",
+	'Y': "-.--", 'Z': "--..", 'É': "..-..",
+
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-",
+	'5': ".....", '6': "-....", '7': "--...", '8': "---..", '9': "----.",
+
+	'.': ".-.-.-", ',': "--..--", ':': "---...", '?': "..--..", '\'': ".----.",
+	'-': "-....-", '/': "-..-.", '(': "-.--.", ')': "-.--.-", '"': ".-..-.",
+	'=': "-...-", '+': ".-.-.", '×': "-..-", '@': ".--.-.",
+	'!': "-.-.--", '&': ".-...", ';': "-.-.-.", '_': "..--.-", '$': "...-..-",
+}
+
+// Symbol is an encoded character or prosign. A word space is a Symbol whose Text
+// is " " and whose Code is empty.
+type Symbol struct {
+	Text string // the character, or the prosign in angle brackets, e.g., '<SK>'
+	Code string // dots and dashes, e.g., '...-.-'
+}
+
+// Encode encodes 'text' as Morse code. Letters are case insensitive and runs of
+// white space are sent as a single word space. A prosign is written as letters
+// in angle brackets, e.g., '<SOS>' or '<AR>', and is sent as one character, the
+// letters' codes run together without the usual space between them.
+func Encode(text string) ([]Symbol, error) {
+	symbols := []Symbol{}
+	runes := []rune(strings.ToUpper(strings.TrimSpace(text)))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			if symbols[len(symbols)-1].Code != "" {
+				symbols = append(symbols, Symbol{Text: " "})
+			}
+		case r == '<':
+			end := i + 1
+			for end < len(runes) && runes[end] != '>' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("prosign at character %d is missing its closing '>'", i+1)
+			}
+			letters := string(runes[i+1 : end])
+			if letters == "" {
+				return nil, fmt.Errorf("empty prosign at character %d", i+1)
+			}
+			code := ""
+			for _, l := range letters {
+				c, ok := codes[l]
+				if !ok || !unicode.IsLetter(l) {
+					return nil, fmt.Errorf("invalid prosign <%s>, prosigns must only contain letters", letters)
+				}
+				code += c
+			}
+			symbols = append(symbols, Symbol{Text: "<" + letters + ">", Code: code})
+			i = end
+		default:
+			code, ok := codes[r]
+			if !ok {
+				return nil, fmt.Errorf("%q can't be sent in Morse code", r)
+			}
+			symbols = append(symbols, Symbol{Text: string(r), Code: code})
+		}
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("nothing to send")
+	}
+	return symbols, nil
+}
+
+// Format returns the dots and dashes of 'symbols' with a space between
+// characters and ' / ' between words, e.g., '.... .. / - .... . .-. .'.
+func Format(symbols []Symbol) string {
+	var b strings.Builder
+	for i, sym := range symbols {
+		switch {
+		case sym.Code == "":
+			b.WriteString(" /")
+		case i > 0:
+			b.WriteString(" ")
+		}
+		b.WriteString(sym.Code)
+	}
+	return b.String()
+}
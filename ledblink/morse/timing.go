@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package morse
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timing is the speed Morse code is sent at. Speeds are in words per minute
+// using the standard word 'PARIS ', which is 50 dot lengths long.
+//
+// With Farnsworth timing the characters are sent at WPM but the spaces between
+// characters and words are stretched so the overall speed is FarnsworthWPM. It
+// helps when learning to copy code, each character's sound, or blink pattern,
+// is the same as it would be at full speed.
+type Timing struct {
+	WPM           float64 // character speed
+	FarnsworthWPM float64 // overall speed, 0 or equal to WPM for standard timing
+}
+
+// Validate checks that the speeds are usable
+func (t Timing) Validate() error {
+	if t.WPM < 1 || t.WPM > 100 {
+		return fmt.Errorf("invalid speed %g WPM, must be 1 thru 100", t.WPM)
+	}
+	if t.FarnsworthWPM < 0 || t.FarnsworthWPM > t.WPM {
+		return fmt.Errorf("invalid Farnsworth speed %g WPM, must be 0 thru the character speed (%g WPM)", t.FarnsworthWPM, t.WPM)
+	}
+	return nil
+}
+
+// Dot returns the length of a dot, which is also the space between the dots and
+// dashes of a character.
+func (t Timing) Dot() time.Duration {
+	return time.Duration(float64(1200*time.Millisecond) / t.WPM)
+}
+
+// Dash returns the length of a dash, 3 dots
+func (t Timing) Dash() time.Duration {
+	return 3 * t.Dot()
+}
+
+// CharSpace returns the space between the characters of a word, 3 dots with
+// standard timing.
+func (t Timing) CharSpace() time.Duration {
+	if !t.farnsworth() {
+		return 3 * t.Dot()
+	}
+	return 3 * t.farnsworthUnit()
+}
+
+// WordSpace returns the space between words, 7 dots with standard timing
+func (t Timing) WordSpace() time.Duration {
+	if !t.farnsworth() {
+		return 7 * t.Dot()
+	}
+	return 7 * t.farnsworthUnit()
+}
+
+func (t Timing) farnsworth() bool {
+	return t.FarnsworthWPM > 0 && t.FarnsworthWPM < t.WPM
+}
+
+// farnsworthUnit returns the stretched unit of space used with Farnsworth timing.
+// 'PARIS ' has 31 dot lengths of marks and intra-character spaces, sent at the
+// character speed, and 19 units of inter-character and word space, 4 character
+// spaces of 3 units and a word space of 7. The 19 units are stretched to fill
+// the rest of the time a word takes at the overall speed (see the ARRL's "A
+// Standard for Morse Timing Using the Farnsworth Technique").
+func (t Timing) farnsworthUnit() time.Duration {
+	word := float64(time.Minute) / t.FarnsworthWPM
+	marks := 31 * float64(t.Dot())
+	return time.Duration((word - marks) / 19)
+}
+
+// Element is a period of time that the output is either on, a dot or dash, or off,
+// a space.
+type Element struct {
+	On       bool
+	Duration time.Duration
+}
+
+// Elements returns the marks and spaces that send 'symbols[i]', followed by the
+// space before the next character, if there is one. A word space has no elements
+// of its own, the space is added to the character before it.
+func (t Timing) Elements(symbols []Symbol, i int) []Element {
+	sym := symbols[i]
+	elements := []Element{}
+	for j, c := range sym.Code {
+		if j > 0 {
+			elements = append(elements, Element{On: false, Duration: t.Dot()})
+		}
+		d := t.Dot()
+		if c == '-' {
+			d = t.Dash()
+		}
+		elements = append(elements, Element{On: true, Duration: d})
+	}
+
+	if sym.Code == "" || i == len(symbols)-1 {
+		return elements
+	}
+	space := t.CharSpace()
+	if symbols[i+1].Code == "" {
+		space = t.WordSpace()
+	}
+	return append(elements, Element{On: false, Duration: space})
+}
@@ -0,0 +1,294 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// morserx decodes Morse code sent with a button or a light sensor, e.g., a photodiode
+// and comparator watching the LED driven by 'blinkingled -morse'. The input is
+// sampled and the decoded text is printed as it's received.
+//
+// Run using 'go run morserx.go'. A button between BCM pin 18 and ground works with
+// the default settings. For a sensor whose output is HIGH when it sees light use
+// '-active high -pull off'.
+//
+// '-record FILE' saves the input's edges and '-edges FILE' decodes saved edges, no
+// Raspberry Pi needed. Each line of an edges file is the time in seconds since the
+// start of the recording and 1 when the input turned on, 0 when it turned off, e.g.,
+//
+//	0.000 1
+//	0.060 0
+//
+// Blank lines and lines starting with '#' are ignored.
+//
+// '-backend=cdev' reads the input through the GPIO character device, so root isn't
+// needed.
+//
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/ledblink/morse"
+)
+
+// edge is a change of the input to on or off, 'at' is relative to the start of the input
+type edge struct {
+	at time.Duration
+	on bool
+}
+
+// receiver passes the lengths of the marks and spaces between edges to a decoder
+type receiver struct {
+	dec  *morse.Decoder
+	last edge
+	// started is false until the first mark, the time before it isn't a space
+	started bool
+}
+
+// edge handles a change of the input and returns any text it completes
+func (r *receiver) edge(e edge) string {
+	if e.on == r.last.on {
+		return ""
+	}
+	text := ""
+	if e.on && r.started {
+		text = r.dec.Space(e.at - r.last.at)
+	}
+	if !e.on {
+		r.dec.Mark(e.at - r.last.at)
+		r.started = true
+	}
+	r.last = e
+	return text
+}
+
+// idle is called while the input is unchanged, it returns any text completed by
+// the space so far
+func (r *receiver) idle(at time.Duration) string {
+	if r.last.on || !r.started {
+		return ""
+	}
+	return r.dec.Space(at - r.last.at)
+}
+
+func main() {
+	var (
+		bcm      int
+		active   string
+		pull     string
+		sample   time.Duration
+		debounce time.Duration
+		wpm      float64
+		edgeFile string
+		record   string
+		backend  string
+		chipName string
+	)
+	flag.IntVar(&bcm, "pin", 18, "BCM pin the button or sensor is connected to")
+	flag.StringVar(&active, "active", "low", "input level, 'low' or 'high', when the button is pressed or the sensor sees light")
+	flag.StringVar(&pull, "pull", "up", "input pull resistor, 'up', 'down', or 'off'")
+	flag.DurationVar(&sample, "sample", time.Millisecond, "how often the input is sampled")
+	flag.DurationVar(&debounce, "debounce", 5*time.Millisecond, "how long the input must be steady for a change to count")
+	flag.Float64Var(&wpm, "wpm", 15, "expected speed in words per minute, the decoder adapts to the actual speed")
+	flag.StringVar(&edgeFile, "edges", "", "decode the edges in this file instead of sampling the input")
+	flag.StringVar(&record, "record", "", "save the input's edges to this file")
+	flag.StringVar(&backend, "backend", "rpio", "how the input pin is read, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	flag.Parse()
+
+	if active != "low" && active != "high" {
+		fmt.Printf("invalid active level %q, must be 'low' or 'high'\n", active)
+		os.Exit(1)
+	}
+	if pull != "up" && pull != "down" && pull != "off" {
+		fmt.Printf("invalid pull %q, must be 'up', 'down', or 'off'\n", pull)
+		os.Exit(1)
+	}
+	if wpm < 1 || wpm > 100 {
+		fmt.Printf("invalid speed %g WPM, must be 1 thru 100\n", wpm)
+		os.Exit(1)
+	}
+	if sample <= 0 || debounce < 0 {
+		fmt.Println("sample must be greater than 0 and debounce must not be negative")
+		os.Exit(1)
+	}
+
+	r := &receiver{dec: morse.NewDecoder(wpm)}
+
+	if edgeFile != "" {
+		edges, err := readEdges(edgeFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, e := range filterEdges(edges, debounce) {
+			fmt.Print(r.edge(e))
+		}
+		fmt.Println(r.dec.Flush())
+		fmt.Printf("Estimated speed: %.1f WPM\n", r.dec.WPM())
+		return
+	}
+
+	var rec io.Writer
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		rec = w
+	}
+
+	board, err := gpio.Open(backend, chipName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := board.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	pin, err := board.Pin(bcm)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	pin.Input()
+	switch pull {
+	case "up":
+		pin.Pull(gpio.PullUp)
+	case "down":
+		pin.Pull(gpio.PullDown)
+	default:
+		pin.Pull(gpio.PullOff)
+	}
+	onLevel := gpio.Low
+	if active == "high" {
+		onLevel = gpio.High
+	}
+
+	stop := make(chan interface{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+
+	fmt.Printf("Listening on BCM pin %d, ctl-C to stop\n", bcm)
+	receive(pin, onLevel, sample, debounce, r, rec, stop)
+	fmt.Println(r.dec.Flush())
+	fmt.Printf("Estimated speed: %.1f WPM\n", r.dec.WPM())
+	pin.Pull(gpio.PullOff)
+}
+
+// receive samples 'pin' every 'sample' until 'stop' is closed, printing the text
+// decoded by 'r'. A change of the input counts once it's been steady for 'debounce'.
+// The edges are written to 'rec' if it isn't nil.
+func receive(pin gpio.Pin, onLevel gpio.State, sample, debounce time.Duration, r *receiver, rec io.Writer, stop chan interface{}) {
+	ticker := time.NewTicker(sample)
+	defer ticker.Stop()
+
+	start := time.Now()
+	on := false
+	// changedAt is when the input last changed from 'on', it's only counted as an
+	// edge once it's been steady for 'debounce'
+	var changedAt time.Duration = -1
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Since(start)
+		level := pin.Read() == onLevel
+		switch {
+		case level == on:
+			changedAt = -1
+			fmt.Print(r.idle(now))
+		case changedAt < 0:
+			changedAt = now
+		case now-changedAt >= debounce:
+			on = level
+			e := edge{at: changedAt, on: on}
+			changedAt = -1
+			if rec != nil {
+				fmt.Fprintf(rec, "%.3f %d\n", e.at.Seconds(), boolToInt(e.on))
+			}
+			fmt.Print(r.edge(e))
+		}
+	}
+}
+
+// readEdges reads a file of recorded edges
+func readEdges(path string) ([]edge, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	edges := []edge{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s line %d: expected 'seconds level', got %q", path, lineNum, line)
+		}
+		secs, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || secs < 0 {
+			return nil, fmt.Errorf("%s line %d: invalid time %q", path, lineNum, fields[0])
+		}
+		if fields[1] != "0" && fields[1] != "1" {
+			return nil, fmt.Errorf("%s line %d: invalid level %q, must be 0 or 1", path, lineNum, fields[1])
+		}
+		at := time.Duration(secs * float64(time.Second))
+		if len(edges) > 0 && at < edges[len(edges)-1].at {
+			return nil, fmt.Errorf("%s line %d: edges must be in time order", path, lineNum)
+		}
+		edges = append(edges, edge{at: at, on: fields[1] == "1"})
+	}
+	return edges, scanner.Err()
+}
+
+// filterEdges drops the edges that aren't followed by 'debounce' of steady input,
+// the same as sampling the input would.
+func filterEdges(edges []edge, debounce time.Duration) []edge {
+	filtered := []edge{}
+	for i, e := range edges {
+		if i+1 < len(edges) && edges[i+1].at-e.at < debounce {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
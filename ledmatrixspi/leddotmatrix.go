@@ -5,22 +5,42 @@
 //
 // Run using 'go run leddotmatrix.go'
 //
+// '-backend=sim' runs the program on a simulated Raspberry Pi and '-backend=fake' records
+// the bytes sent to the MAX7219, no Raspberry Pi needed.
+//
+// '-trace=file.vcd' saves a trace of the chip select writes and the bytes sent with
+// SPI on exit, for GTKWave or PulseView. Any other file extension saves the trace
+// as a text log.
+//
+// The SPI pins can be claimed in a file shared with the other demos, '-claims' or
+// $GPIO_CLAIMS, e.g., /run/lock/gpio-claims, so that running this program at the same
+// time as one using any of them fails, e.g., ledbargraph, which uses BCM 8 (SPI CE0) for
+// a segment. The claims aren't shared by default.
+//
 
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
-const csPin = rpio.Pin(uint8(8)) //csPin represents the chip select pin and specifies it is on GPIO pin 8
-const NUM_CHARS = 37             // Number of characters that can be displayed
-const MATRIX_ROW = 8             // The number of rows of LEDs on the MAX7219
+const NUM_CHARS = 37 // Number of characters that can be displayed
+const MATRIX_ROW = 8 // The number of rows of LEDs on the MAX7219
+
+var (
+	board  gpio.Board     // board is the Raspberry Pi, or a fake or simulated one
+	trace  *gpio.Trace    // trace traces the board's calls if '-trace' is set
+	csPin  gpio.Pin       // csPin represents the chip select pin, it's GPIO pin 8
+	spi    gpio.SPI       // spi is the SPI0 controller the MAX7219 is connected to
+	claims *gpio.Registry // claims has the pins' claims, see '-claims'
+)
 
 // NUM_CHARS represents a specific character to create on the LED matrix display.
 // MATRIX_ROW contains the hex representation to create a display character. Each hex character
@@ -33,17 +53,17 @@ const MATRIX_ROW = 8             // The number of rows of LEDs on the MAX7219
 // following character in the LED Matrix display. In the representation below the 0's are replaced
 // with spaces:
 //
-//    1111
-//   1    1
-//   1    1
-//   1    1
-//   1    1
-//   1    1
-//   1    1
-//    1111
+//	  1111
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	 1    1
+//	  1111
 //
-//  If you follow the pattern of 1's in the above rows you can see that they represent the
-//  number 0. Recall that spaces replaced 0's.
+//	If you follow the pattern of 1's in the above rows you can see that they represent the
+//	number 0. Recall that spaces replaced 0's.
 var disp1 = [][]byte{
 	{0x3C, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x3C}, //0
 	{0x08, 0x18, 0x28, 0x08, 0x08, 0x08, 0x08, 0x08}, //1
@@ -87,34 +107,64 @@ var disp1 = [][]byte{
 }
 
 func main() {
+	backend := flag.String("backend", "rpio", "how the pins are driven, 'rpio' (the go-rpio library), 'fake', or 'sim'")
+	tracePath := flag.String("trace", "", "file the pin writes and SPI bytes are traced to, a VCD file if it ends in '.vcd', a text log otherwise")
+	claimFile := flag.String("claims", gpio.ClaimsFile(), "file the pins are claimed in, shared with other programs so that conflicting uses are caught, defaults to $GPIO_CLAIMS, '' to not share the claims")
+	flag.Parse()
+
+	// Claim the SPI pins, a fake board's pins aren't real so its claims aren't shared
+	if *backend == "fake" {
+		*claimFile = ""
+	}
+	var err error
+	if claims, err = gpio.OpenRegistry(*claimFile); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, w := range claims.Warnings() {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	if err = claims.ClaimSPI(0, "MAX7219 LED matrix"); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// stop channel is used to synchronize exiting the
 	// program so that the board is reset to the state
 	// it was in prior to the program starting.
 	stop := make(chan interface{})
 	// sigs is the channel used by Go's signals capability
 	// to notify the program that a signal has been raised.
-	sigs := make(chan os.Signal)
+	sigs := make(chan os.Signal, 1)
 
 	// signal.Notify() registers the program's interest
 	// in receiving signals and provides the channel used
 	// to send signals to the program.
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL)
-	go signalHandler(sigs, stop)
+	go signalHandler(sigs, stop, *tracePath)
 
-	// Initialize the rpio library
-	if err := rpio.Open(); err != nil {
+	// Initialize the board, e.g., the rpio library
+	if board, err = gpio.Open(*backend, ""); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if *tracePath != "" {
+		trace = gpio.NewTrace(board)
+		board = trace
+	}
 
 	// Initialize SPI on the SPI0 associated GPIO pins
-	if err := rpio.SpiBegin(rpio.Spi0); err != nil {
+	if spi, err = board.SPI(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	if csPin, err = board.Pin(gpio.SPI0CE0); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	csPin.Output()
-	rpio.SpiChipSelect(uint8(csPin)) // Select CE0 (csPin) as slave
+	spi.ChipSelect(0) // Select CE0 (csPin) as slave
 	initMax7219()
 
 	for {
@@ -134,9 +184,10 @@ func main() {
 		}
 	}
 	// Reset the SPI0 pins back to INPUT mode
-	rpio.SpiEnd(rpio.Spi0)
+	spi.Close()
 	// Release SPI resources (e.g., mapped memory)
-	rpio.Close()
+	board.Close()
+	claims.Close()
 }
 
 func initMax7219() {
@@ -160,15 +211,15 @@ func writeMax7219(addr byte, value byte) {
 }
 
 func writeMax7219Byte(b byte) {
-	rpio.SpiTransmit(b)
+	spi.Transmit(b)
 }
 
-func signalHandler(sigs chan os.Signal, stop chan interface{}) {
+func signalHandler(sigs chan os.Signal, stop chan interface{}, tracePath string) {
 	<-sigs
 	// notify all listeners that the program is stopping
 	close(stop)
 
-	fmt.Println("\nExiting...\n")
+	fmt.Println("\nExiting...")
 
 	// Turn off all LEDs on the MAX7219
 	for i := 1; i < MATRIX_ROW+1; i++ {
@@ -176,9 +227,17 @@ func signalHandler(sigs chan os.Signal, stop chan interface{}) {
 	}
 
 	// Reset the SPI0 pins back to INPUT mode
-	rpio.SpiEnd(rpio.Spi0)
-	// Release SPI resources (e.g., mapped memory)
-	rpio.Close()
+	spi.Close()
+	if trace != nil {
+		if err := trace.Save(tracePath); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Release SPI resources (e.g., mapped memory), a fake or simulated
+	// board reports the pins' final state first
+	gpio.Report(os.Stdout, board)
+	board.Close()
+	claims.Close()
 
 	os.Exit(0)
 }
@@ -0,0 +1,215 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sample is the pins' levels at a point in time, bit i is the level of the i'th
+// pin being captured
+type sample struct {
+	t      time.Duration
+	levels uint32
+}
+
+// triggerKind is what starts a capture
+type triggerKind int
+
+const (
+	triggerNone    triggerKind = iota // the capture starts with the first sample
+	triggerRising                     // a pin changes from LOW to HIGH
+	triggerFalling                    // a pin changes from HIGH to LOW
+	triggerPattern                    // the pins match a pattern
+)
+
+// trigger decides when a capture starts
+type trigger struct {
+	kind  triggerKind
+	bit   uint32 // the triggering pin's bit for a rising or falling trigger
+	mask  uint32 // the pins a pattern trigger cares about
+	value uint32 // their levels
+}
+
+// parseTrigger parses a trigger for 'pins', one of:
+//
+//	none            start immediately
+//	rising:<pin>    start when BCM pin <pin> goes from LOW to HIGH
+//	falling:<pin>   start when BCM pin <pin> goes from HIGH to LOW
+//	pattern:<bits>  start when the pins match <bits>, a '0', '1', or 'x' (don't
+//	                care) for each pin in the order they're listed
+func parseTrigger(s string, pins []int) (trigger, error) {
+	if s == "" || s == "none" {
+		return trigger{kind: triggerNone}, nil
+	}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return trigger{}, fmt.Errorf("invalid trigger %q, must be 'none', 'rising:<pin>', 'falling:<pin>', or 'pattern:<bits>'", s)
+	}
+
+	switch parts[0] {
+	case "rising", "falling":
+		bcm, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return trigger{}, fmt.Errorf("invalid trigger %q, %q isn't a pin", s, parts[1])
+		}
+		for i, p := range pins {
+			if p == bcm {
+				tr := trigger{kind: triggerRising, bit: 1 << uint(i)}
+				if parts[0] == "falling" {
+					tr.kind = triggerFalling
+				}
+				return tr, nil
+			}
+		}
+		return trigger{}, fmt.Errorf("invalid trigger %q, BCM pin %d isn't being captured", s, bcm)
+	case "pattern":
+		bits := parts[1]
+		if len(bits) != len(pins) {
+			return trigger{}, fmt.Errorf("invalid trigger %q, the pattern needs a '0', '1', or 'x' for each of the %d pins", s, len(pins))
+		}
+		tr := trigger{kind: triggerPattern}
+		for i, c := range bits {
+			bit := uint32(1) << uint(i)
+			switch c {
+			case '0':
+				tr.mask |= bit
+			case '1':
+				tr.mask |= bit
+				tr.value |= bit
+			case 'x', 'X':
+			default:
+				return trigger{}, fmt.Errorf("invalid trigger %q, %q must be '0', '1', or 'x'", s, c)
+			}
+		}
+		return tr, nil
+	}
+	return trigger{}, fmt.Errorf("invalid trigger %q, must be 'none', 'rising:<pin>', 'falling:<pin>', or 'pattern:<bits>'", s)
+}
+
+// fired returns true if the change from levels 'prev' to 'cur' fires the trigger.
+// 'first' is true for the first sample, which has no previous levels, it can only
+// fire a 'none' or pattern trigger.
+func (tr trigger) fired(prev, cur uint32, first bool) bool {
+	switch tr.kind {
+	case triggerNone:
+		return true
+	case triggerPattern:
+		return cur&tr.mask == tr.value
+	case triggerRising:
+		return !first && prev&tr.bit == 0 && cur&tr.bit != 0
+	case triggerFalling:
+		return !first && prev&tr.bit != 0 && cur&tr.bit == 0
+	}
+	return false
+}
+
+// recorder keeps the samples in the capture window, from 'pre' before the trigger
+// until 'length' after it. Only samples whose levels differ from the previous
+// sample's are kept.
+type recorder struct {
+	trigger trigger
+	pre     time.Duration
+	length  time.Duration
+
+	samples   []sample
+	last      sample        // the most recent sample added
+	seen      bool          // true once a sample has been added
+	known     time.Duration // the levels are known up until this time
+	triggered bool
+	trigTime  time.Duration
+}
+
+// add adds sample 's', its time must not be before the previous sample's. It
+// returns true once the capture is complete.
+func (r *recorder) add(s sample) bool {
+	r.known = s.t
+	changed := !r.seen || s.levels != r.last.levels
+	if !r.triggered {
+		fired := r.trigger.fired(r.last.levels, s.levels, !r.seen)
+		if changed {
+			r.samples = append(r.samples, s)
+		}
+		r.last, r.seen = s, true
+		if fired {
+			r.triggered, r.trigTime = true, s.t
+			return r.length == 0
+		}
+		r.trim(s.t - r.pre)
+		return false
+	}
+
+	if s.t > r.trigTime+r.length {
+		return true
+	}
+	if changed {
+		r.samples = append(r.samples, s)
+	}
+	r.last = s
+	return false
+}
+
+// unchanged records that the levels haven't changed since the last sample up
+// until time 't'. It returns true if the capture is complete.
+func (r *recorder) unchanged(t time.Duration) bool {
+	if t > r.known {
+		r.known = t
+	}
+	return r.triggered && r.known > r.trigTime+r.length
+}
+
+// trim drops the samples before 'start' that aren't needed to know the levels
+// at 'start'
+func (r *recorder) trim(start time.Duration) {
+	// The last sample at or before 'start' has the levels at 'start'
+	i := sort.Search(len(r.samples), func(i int) bool { return r.samples[i].t > start }) - 1
+	// The samples are only copied once half of them can be dropped
+	if i > 0 && i >= len(r.samples)/2 {
+		r.samples = append(r.samples[:0], r.samples[i:]...)
+	}
+}
+
+// result is a capture's samples and its trigger
+type result struct {
+	samples  []sample      // the first sample has the levels at the start of the window
+	trigTime time.Duration // when the trigger fired, if it did
+	end      time.Duration // the end of the window
+}
+
+// capture returns the samples in the capture window, their times are relative to
+// the window's start
+func (r *recorder) capture() result {
+	if len(r.samples) == 0 {
+		return result{}
+	}
+	start := r.samples[0].t
+	if r.triggered && r.trigTime-r.pre > start {
+		start = r.trigTime - r.pre
+	}
+	end := r.known
+	if r.triggered && r.trigTime+r.length < end {
+		end = r.trigTime + r.length
+	}
+
+	res := result{trigTime: r.trigTime - start, end: end - start}
+	for i, s := range r.samples {
+		if i+1 < len(r.samples) && r.samples[i+1].t <= start {
+			// Superseded before the window starts
+			continue
+		}
+		if s.t < start {
+			s.t = start
+		}
+		s.t -= start
+		res.samples = append(res.samples, s)
+	}
+	return res
+}
@@ -0,0 +1,314 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+const ms = time.Millisecond
+
+func TestParseTrigger(t *testing.T) {
+	pins := []int{17, 27, 22}
+
+	tests := []struct {
+		s       string
+		want    trigger
+		wantErr string
+	}{
+		{s: "", want: trigger{kind: triggerNone}},
+		{s: "none", want: trigger{kind: triggerNone}},
+		{s: "rising:17", want: trigger{kind: triggerRising, bit: 0b001}},
+		{s: "falling:22", want: trigger{kind: triggerFalling, bit: 0b100}},
+		{s: "pattern:1x0", want: trigger{kind: triggerPattern, mask: 0b101, value: 0b001}},
+		{s: "pattern:XX1", want: trigger{kind: triggerPattern, mask: 0b100, value: 0b100}},
+		{s: "pattern:xxx", want: trigger{kind: triggerPattern}},
+		{s: "rising", wantErr: "must be 'none'"},
+		{s: "high:17", wantErr: "must be 'none'"},
+		{s: "rising:pin17", wantErr: "\"pin17\" isn't a pin"},
+		{s: "falling:4", wantErr: "BCM pin 4 isn't being captured"},
+		{s: "pattern:10", wantErr: "needs a '0', '1', or 'x' for each of the 3 pins"},
+		{s: "pattern:1010", wantErr: "needs a '0', '1', or 'x' for each of the 3 pins"},
+		{s: "pattern:1z0", wantErr: "'z' must be '0', '1', or 'x'"},
+	}
+
+	for _, tc := range tests {
+		tr, err := parseTrigger(tc.s, pins)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q: got error %v, want one containing %q", tc.s, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tc.s, err)
+			continue
+		}
+		if tr != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.s, tr, tc.want)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	// smp returns a sample at 't' milliseconds
+	smp := func(t int, levels uint32) sample { return sample{t: time.Duration(t) * ms, levels: levels} }
+
+	tests := []struct {
+		name    string
+		trigger string // for pins 17, 27, and 22
+		pre     time.Duration
+		length  time.Duration
+		samples []sample
+		done    int // the index of the sample that completes the capture, -1 if none does
+		want    result
+	}{
+		{
+			name:    "none",
+			trigger: "none",
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b000), smp(5, 0b001), smp(10, 0b001), smp(12, 0b000)},
+			done:    3,
+			want:    result{samples: []sample{smp(0, 0b000), smp(5, 0b001)}, trigTime: 0, end: 10 * ms},
+		},
+		{
+			name:    "no length",
+			trigger: "none",
+			samples: []sample{smp(3, 0b101), smp(4, 0b000)},
+			done:    0,
+			want:    result{samples: []sample{smp(0, 0b101)}},
+		},
+		{
+			name:    "rising",
+			trigger: "rising:27",
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b010), smp(2, 0b000), smp(4, 0b001), smp(6, 0b011), smp(10, 0b001), smp(16, 0b001), smp(17, 0b000)},
+			done:    6,
+			want:    result{samples: []sample{smp(0, 0b011), smp(4, 0b001)}, trigTime: 0, end: 10 * ms},
+		},
+		{
+			// The first sample has no previous levels so it can't be an edge
+			name:    "falling",
+			trigger: "falling:17",
+			length:  2 * ms,
+			samples: []sample{smp(0, 0b000), smp(1, 0b001), smp(2, 0b000), smp(3, 0b001), smp(5, 0b001)},
+			done:    4,
+			want:    result{samples: []sample{smp(0, 0b000), smp(1, 0b001)}, trigTime: 0, end: 2 * ms},
+		},
+		{
+			name:    "pattern",
+			trigger: "pattern:1x0",
+			length:  5 * ms,
+			samples: []sample{smp(0, 0b000), smp(1, 0b101), smp(2, 0b011), smp(7, 0b000), smp(8, 0b000)},
+			done:    4,
+			want:    result{samples: []sample{smp(0, 0b011), smp(5, 0b000)}, trigTime: 0, end: 5 * ms},
+		},
+		{
+			name:    "pattern matching the first sample",
+			trigger: "pattern:1x0",
+			length:  1 * ms,
+			samples: []sample{smp(0, 0b011), smp(2, 0b011)},
+			done:    1,
+			want:    result{samples: []sample{smp(0, 0b011)}, trigTime: 0, end: 1 * ms},
+		},
+		{
+			// The samples before the window are dropped, except for the one with the
+			// levels at its start, which is moved to the start
+			name:    "pre-trigger",
+			trigger: "rising:27",
+			pre:     10 * ms,
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b000), smp(3, 0b001), smp(6, 0b000), smp(9, 0b001), smp(25, 0b011), smp(30, 0b010), smp(36, 0b000)},
+			done:    6,
+			want:    result{samples: []sample{smp(0, 0b001), smp(10, 0b011), smp(15, 0b010)}, trigTime: 10 * ms, end: 20 * ms},
+		},
+		{
+			name:    "pre-trigger sample at the start of the window",
+			trigger: "rising:27",
+			pre:     10 * ms,
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b000), smp(15, 0b001), smp(25, 0b011), smp(36, 0b000)},
+			done:    3,
+			want:    result{samples: []sample{smp(0, 0b001), smp(10, 0b011)}, trigTime: 10 * ms, end: 20 * ms},
+		},
+		{
+			// The window can't start before the first sample
+			name:    "pre-trigger longer than the samples",
+			trigger: "rising:27",
+			pre:     100 * ms,
+			length:  10 * ms,
+			samples: []sample{smp(5, 0b000), smp(8, 0b001), smp(25, 0b011), smp(40, 0b011)},
+			done:    3,
+			want:    result{samples: []sample{smp(0, 0b000), smp(3, 0b001), smp(20, 0b011)}, trigTime: 20 * ms, end: 30 * ms},
+		},
+		{
+			name:    "unchanged samples",
+			trigger: "none",
+			pre:     5 * ms,
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b100), smp(1, 0b100), smp(2, 0b100), smp(3, 0b000), smp(4, 0b000)},
+			done:    -1,
+			want:    result{samples: []sample{smp(0, 0b100), smp(3, 0b000)}, trigTime: 0, end: 4 * ms},
+		},
+		{
+			name:    "trigger didn't fire",
+			trigger: "rising:22",
+			pre:     5 * ms,
+			length:  10 * ms,
+			samples: []sample{smp(0, 0b000), smp(1, 0b001), smp(2, 0b000), smp(3, 0b001), smp(9, 0b000)},
+			done:    -1,
+			want:    result{samples: []sample{smp(0, 0b001), smp(6, 0b000)}, trigTime: -3 * ms, end: 6 * ms},
+		},
+		{name: "no samples", trigger: "none", done: -1, want: result{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := parseTrigger(tc.trigger, []int{17, 27, 22})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &recorder{trigger: tr, pre: tc.pre, length: tc.length}
+			done := -1
+			for i, s := range tc.samples {
+				if r.add(s) {
+					done = i
+					break
+				}
+			}
+			if done != tc.done {
+				t.Errorf("the capture was completed by sample %d, want %d", done, tc.done)
+			}
+			if res := r.capture(); !reflect.DeepEqual(res, tc.want) {
+				t.Errorf("got %+v, want %+v", res, tc.want)
+			}
+		})
+	}
+}
+
+func TestRecorderTrim(t *testing.T) {
+	tr, _ := parseTrigger("rising:27", []int{17, 27})
+	r := &recorder{trigger: tr, pre: 10 * ms, length: 5 * ms}
+	// A pin toggling every millisecond for a second before the trigger only keeps
+	// about the pre-trigger's worth of samples
+	for i := 0; i < 1000; i++ {
+		r.add(sample{t: time.Duration(i) * ms, levels: uint32(i % 2)})
+		if len(r.samples) > 25 {
+			t.Fatalf("%d samples are kept at %dms, with a 10ms pre-trigger", len(r.samples), i)
+		}
+	}
+	r.add(sample{t: 1000 * ms, levels: 0b10})
+	r.add(sample{t: 1010 * ms, levels: 0b10})
+
+	res := r.capture()
+	if res.trigTime != 10*ms || res.end != 15*ms {
+		t.Errorf("got trigger at %s, end %s, want 10ms and 15ms", res.trigTime, res.end)
+	}
+	if len(res.samples) != 11 {
+		t.Fatalf("got %d samples, want the last 10 toggles and the trigger", len(res.samples))
+	}
+	for i, s := range res.samples[:10] {
+		if want := (sample{t: time.Duration(i) * ms, levels: uint32(i % 2)}); s != want {
+			t.Errorf("got sample %d %+v, want %+v", i, s, want)
+		}
+	}
+}
+
+func TestRecorderUnchanged(t *testing.T) {
+	// Edge sources only add a sample when a pin changes
+	r := &recorder{trigger: trigger{kind: triggerNone}, length: 10 * ms}
+	r.add(sample{t: 0, levels: 1})
+	if r.unchanged(5 * ms) {
+		t.Error("the capture was completed before the end of the window")
+	}
+	if r.unchanged(3 * ms) {
+		t.Error("the capture was completed by an earlier time")
+	}
+	if !r.unchanged(11 * ms) {
+		t.Error("the capture wasn't completed after the end of the window")
+	}
+	if res := r.capture(); res.end != 10*ms || len(res.samples) != 1 {
+		t.Errorf("got %+v, want one sample and an end of 10ms", res)
+	}
+
+	// It can't complete a capture that hasn't triggered
+	tr, _ := parseTrigger("rising:17", []int{17})
+	r = &recorder{trigger: tr}
+	r.add(sample{t: 0, levels: 0})
+	if r.unchanged(time.Hour) {
+		t.Error("the capture was completed before the trigger")
+	}
+}
+
+func TestPoll(t *testing.T) {
+	board := gpio.NewFake()
+	pin, _ := board.Pin(17)
+	pin.Input()
+	pins := []gpio.Pin{pin}
+	rising, _ := parseTrigger("rising:17", []int{17})
+
+	t.Run("complete", func(t *testing.T) {
+		r := &recorder{trigger: trigger{kind: triggerNone}, length: 5 * ms}
+		n, err := poll(pins, ms, r, time.Second, nil)
+		if err != nil || n < 5 || !r.triggered {
+			t.Errorf("got %d samples, %v, want at least 5 samples and the trigger", n, err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := &recorder{trigger: rising, length: 5 * ms}
+		start := time.Now()
+		_, err := poll(pins, ms, r, 20*ms, nil)
+		if !errors.Is(err, errNoTrigger) {
+			t.Errorf("got %v, want errNoTrigger", err)
+		}
+		if elapsed := time.Since(start); elapsed < 20*ms || elapsed > time.Second {
+			t.Errorf("timed out after %s, want 20ms", elapsed)
+		}
+	})
+
+	t.Run("timeout after the trigger", func(t *testing.T) {
+		// The timeout only applies to waiting for the trigger
+		r := &recorder{trigger: trigger{kind: triggerNone}, length: 30 * ms}
+		if _, err := poll(pins, ms, r, 5*ms, nil); err != nil {
+			t.Errorf("unexpected error %s", err)
+		}
+		if r.known < 30*ms {
+			t.Errorf("stopped at %s, before the end of the capture", r.known)
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		r := &recorder{trigger: rising, length: 5 * ms}
+		stop := make(chan struct{})
+		close(stop)
+		if _, err := poll(pins, ms, r, time.Second, stop); !errors.Is(err, errInterrupted) {
+			t.Errorf("got %v, want errInterrupted", err)
+		}
+	})
+
+	t.Run("triggered", func(t *testing.T) {
+		r := &recorder{trigger: rising, pre: 5 * ms, length: 5 * ms}
+		go func() {
+			time.Sleep(20 * ms)
+			board.SetInput(17, gpio.High)
+		}()
+		if _, err := poll(pins, ms, r, time.Second, nil); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		res := r.capture()
+		if len(res.samples) != 2 || res.samples[1].levels != 1 || res.trigTime != res.samples[1].t {
+			t.Errorf("got %+v, want a LOW sample and the trigger", res)
+		}
+	})
+}
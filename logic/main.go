@@ -0,0 +1,204 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// logic is a software logic analyzer for GPIO inputs. It samples a set of pins,
+// waits for a trigger, and saves what happened around it as a Value Change Dump
+// (VCD), for GTKWave or PulseView, or as CSV. For example, to check the PWM output
+// of pwmexplorer on BCM 18 connect it to BCM 23 with a jumper wire and run:
+//
+//	sudo go run ./logic -pins=23 -trigger=rising:23 -pre=1ms -length=20ms -o=pwm.vcd
+//
+// By default the pins are polled in a tight loop, '-rate' times a second, using
+// '-backend'. Polling keeps a CPU busy and can miss pulses shorter than the sample
+// period, or that happen while the program isn't running. '-edges' uses the GPIO
+// character device's edge events instead, they're timestamped by the kernel so
+// short pulses and their timing aren't lost, although very fast signals can
+// overflow the kernel's event queue.
+//
+// Triggers are:
+//
+//	none            the capture starts immediately
+//	rising:<pin>    BCM pin <pin> goes from LOW to HIGH
+//	falling:<pin>   BCM pin <pin> goes from HIGH to LOW
+//	pattern:<bits>  the pins match <bits>, a '0', '1', or 'x' (don't care) for
+//	                each of the '-pins' in order, e.g., 'pattern:1x0'
+//
+// The capture includes '-pre' before the trigger and '-length' after it. Ctrl-C
+// stops a capture early, saving what's been captured so far.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/gpiocdev"
+)
+
+func main() {
+	var (
+		backend     string
+		chipName    string
+		pinList     string
+		pull        string
+		rate        int
+		useEdges    bool
+		triggerSpec string
+		pre         time.Duration
+		length      time.Duration
+		timeout     time.Duration
+		out         string
+	)
+	flag.StringVar(&backend, "backend", "rpio", "how the pins are polled, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-backend=cdev' and '-edges'")
+	flag.StringVar(&pinList, "pins", "", "comma separated BCM pins to capture, e.g., '23,24'")
+	flag.StringVar(&pull, "pull", "off", "the pins' pull resistors, 'off', 'up', or 'down'")
+	flag.IntVar(&rate, "rate", 1000000, "samples per second when polling, 0 samples as fast as possible")
+	flag.BoolVar(&useEdges, "edges", false, "capture the GPIO character device's edge events instead of polling")
+	flag.StringVar(&triggerSpec, "trigger", "none", "'none', 'rising:<pin>', 'falling:<pin>', or 'pattern:<bits>'")
+	flag.DurationVar(&pre, "pre", 0, "time captured before the trigger")
+	flag.DurationVar(&length, "length", 100*time.Millisecond, "time captured after the trigger")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "time to wait for the trigger")
+	flag.StringVar(&out, "o", "capture.vcd", "file the capture is saved to, VCD if it ends in '.vcd', CSV otherwise, '-' writes CSV to stdout")
+	flag.Parse()
+
+	pins, err := parsePins(pinList)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	tr, err := parseTrigger(triggerSpec, pins)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if rate < 0 || pre < 0 || length < 0 {
+		fmt.Println("-rate, -pre, and -length can't be negative")
+		os.Exit(1)
+	}
+	var pullUpDown gpio.Pull
+	var bias gpiocdev.Bias
+	switch pull {
+	case "off":
+		pullUpDown, bias = gpio.PullOff, gpiocdev.BiasDisabled
+	case "up":
+		pullUpDown, bias = gpio.PullUp, gpiocdev.PullUp
+	case "down":
+		pullUpDown, bias = gpio.PullDown, gpiocdev.PullDown
+	default:
+		fmt.Printf("invalid -pull %q, must be 'off', 'up', or 'down'\n", pull)
+		os.Exit(1)
+	}
+
+	// Ctrl-C stops the capture, what's been captured is still saved
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+
+	r := &recorder{trigger: tr, pre: pre, length: length}
+	var n int
+	if useEdges {
+		var chip *gpiocdev.Chip
+		if chip, err = gpiocdev.OpenChip(chipName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n, err = edges(chip, pins, bias, r, timeout, stop)
+		chip.Close()
+	} else {
+		var board gpio.Board
+		if board, err = gpio.Open(backend, chipName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n, err = pollBoard(board, pins, pullUpDown, rate, r, timeout, stop)
+		if cerr := board.Close(); err == nil {
+			err = cerr
+		}
+	}
+	switch {
+	case errors.Is(err, errInterrupted):
+		fmt.Println("Interrupted, saving the capture so far")
+	case err != nil:
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !r.triggered {
+		fmt.Println("The trigger didn't fire, nothing was captured")
+		os.Exit(1)
+	}
+
+	res := r.capture()
+	if err := save(out, pins, res, triggerSpec); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if out == "-" {
+		return
+	}
+	what := "samples"
+	if useEdges {
+		what = "edges"
+	}
+	fmt.Printf("%d %s in %s, %d changes captured, trigger at %s, saved to %s\n",
+		n, what, r.known.Round(time.Microsecond), len(res.samples)-1, res.trigTime.Round(time.Microsecond), out)
+	if !useEdges && r.known > 0 {
+		fmt.Printf("Average sample rate %.0f samples/s\n", float64(n)/r.known.Seconds())
+	}
+}
+
+// pollBoard polls BCM pins 'pins' of 'board', 'rate' times a second, see poll
+func pollBoard(board gpio.Board, pins []int, pull gpio.Pull, rate int, r *recorder, timeout time.Duration, stop <-chan struct{}) (int, error) {
+	gpins := make([]gpio.Pin, len(pins))
+	for i, bcm := range pins {
+		p, err := board.Pin(bcm)
+		if err != nil {
+			return 0, err
+		}
+		p.Input()
+		p.Pull(pull)
+		gpins[i] = p
+	}
+	var period time.Duration
+	if rate > 0 {
+		period = time.Second / time.Duration(rate)
+	}
+	return poll(gpins, period, r, timeout, stop)
+}
+
+// parsePins parses a comma separated list of BCM pins
+func parsePins(list string) ([]int, error) {
+	if list == "" {
+		return nil, errors.New("-pins is required, e.g., '-pins=23'")
+	}
+	var pins []int
+	seen := map[int]bool{}
+	for _, f := range strings.Split(list, ",") {
+		bcm, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pin %q", f)
+		}
+		if bcm < 0 || bcm >= gpio.HeaderPins {
+			return nil, fmt.Errorf("BCM pin %d isn't on the 40 pin header, must be 0 thru %d", bcm, gpio.HeaderPins-1)
+		}
+		if seen[bcm] {
+			return nil, fmt.Errorf("BCM pin %d is listed more than once", bcm)
+		}
+		seen[bcm] = true
+		pins = append(pins, bcm)
+	}
+	return pins, nil
+}
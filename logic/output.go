@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/youngkin/gpio/vcd"
+)
+
+// save writes capture 'res' of 'pins' to file 'path', as a VCD file if its extension
+// is '.vcd' and as CSV otherwise. A 'path' of '-' writes CSV to stdout. 'trigger'
+// describes the trigger, it's recorded in a VCD file's header.
+func save(path string, pins []int, res result, trigger string) error {
+	if path == "-" {
+		return writeCSV(os.Stdout, pins, res)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".vcd") {
+		err = writeVCD(f, pins, res, trigger)
+	} else {
+		err = writeCSV(f, pins, res)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeVCD writes 'res' to 'w' as a Value Change Dump. Each pin is a wire named
+// for its BCM number, e.g., 'gpio17', and the 'trigger' wire goes HIGH when the
+// trigger fires.
+func writeVCD(w io.Writer, pins []int, res result, trigger string) error {
+	vw := vcd.New()
+	vw.Comment(fmt.Sprintf("captured by logic, trigger %s at %dns", trigger, res.trigTime.Nanoseconds()))
+	for i, s := range res.samples {
+		for j, bcm := range pins {
+			bit := uint32(1) << uint(j)
+			if i > 0 && s.levels&bit == res.samples[i-1].levels&bit {
+				continue
+			}
+			level := byte('0')
+			if s.levels&bit != 0 {
+				level = '1'
+			}
+			vw.Wire(s.t, fmt.Sprintf("gpio%d", bcm), level)
+		}
+	}
+	vw.Wire(0, "trigger", '0')
+	vw.Wire(res.trigTime, "trigger", '1')
+	vw.End(res.end)
+	return vw.Write(w, "logic")
+}
+
+// writeCSV writes 'res' to 'w' as CSV, a header line followed by a line for each
+// change with its time in seconds and the pins' levels, e.g., '0.000125000,1,0'.
+// The last line has the levels at the end of the capture.
+func writeCSV(w io.Writer, pins []int, res result) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("time")
+	for _, bcm := range pins {
+		fmt.Fprintf(bw, ",gpio%d", bcm)
+	}
+	bw.WriteString("\n")
+
+	row := func(s sample) {
+		fmt.Fprintf(bw, "%.9f", s.t.Seconds())
+		for j := range pins {
+			fmt.Fprintf(bw, ",%d", s.levels>>uint(j)&1)
+		}
+		bw.WriteString("\n")
+	}
+	for _, s := range res.samples {
+		row(s)
+	}
+	if n := len(res.samples); n > 0 && res.end > res.samples[n-1].t {
+		row(sample{t: res.end, levels: res.samples[n-1].levels})
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/gpiocdev"
+)
+
+var (
+	errInterrupted = errors.New("interrupted")
+	errNoTrigger   = errors.New("timed out waiting for the trigger")
+)
+
+// poll samples 'pins' every 'period', or as fast as possible if 'period' is 0, and
+// adds the samples to 'r' until the capture is complete. It stops early if 'timeout'
+// passes before the trigger fires or 'stop' is closed. It returns the number of
+// samples taken.
+//
+// A sample's time is when it was started. Pacing is done by spinning rather than
+// sleeping, which is too coarse for fast sampling, so a CPU is kept busy. If a sample
+// is late, because the program was descheduled for example, the samples that were
+// missed are skipped.
+func poll(pins []gpio.Pin, period time.Duration, r *recorder, timeout time.Duration, stop <-chan struct{}) (n int, err error) {
+	start := time.Now()
+	next := time.Duration(0)
+	for {
+		now := time.Since(start)
+		if period > 0 {
+			for now < next {
+				// Let other goroutines run on a single core Pi
+				runtime.Gosched()
+				now = time.Since(start)
+			}
+			next += period
+			if next <= now {
+				next = now + period
+			}
+		}
+
+		var levels uint32
+		for i, p := range pins {
+			if p.Read() == gpio.High {
+				levels |= 1 << uint(i)
+			}
+		}
+		n++
+		if r.add(sample{t: now, levels: levels}) {
+			return n, nil
+		}
+
+		if !r.triggered && now > timeout {
+			return n, errNoTrigger
+		}
+		select {
+		case <-stop:
+			return n, errInterrupted
+		default:
+		}
+	}
+}
+
+// edges adds a sample to 'r' for each edge event on lines 'offsets' of 'chip' until
+// the capture is complete. It stops early if 'timeout' passes before the trigger
+// fires or 'stop' is closed. It returns the number of events received.
+//
+// The kernel timestamps the events, so they're accurate even if the program is
+// slow to read them. Each line's events are read separately though, so edges on
+// different lines that are closer together than the time taken to read an event
+// can be out of order, the later one is given the earlier one's time.
+func edges(chip *gpiocdev.Chip, offsets []int, bias gpiocdev.Bias, r *recorder, timeout time.Duration, stop <-chan struct{}) (n int, err error) {
+	cfg := gpiocdev.LineConfig{Bias: bias, Edge: gpiocdev.BothEdges}
+	var lines []*gpiocdev.Line
+	defer func() {
+		for _, l := range lines {
+			l.Close()
+		}
+	}()
+	var levels uint32
+	for i, offset := range offsets {
+		l, err := chip.RequestLine(offset, "logic", cfg)
+		if err != nil {
+			return 0, fmt.Errorf("unable to request line %d, %w", offset, err)
+		}
+		lines = append(lines, l)
+		v, err := l.Value()
+		if err != nil {
+			return 0, err
+		}
+		if v {
+			levels |= 1 << uint(i)
+		}
+	}
+
+	// The capture starts now, with the lines' current levels
+	base := chip.Now()
+	if r.add(sample{t: 0, levels: levels}) {
+		return 0, nil
+	}
+
+	type lineEvent struct {
+		bit uint32
+		ev  gpiocdev.Event
+	}
+	events := make(chan lineEvent, 1024)
+	errs := make(chan error, len(lines))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+	for i, l := range lines {
+		wg.Add(1)
+		go func(bit uint32, l *gpiocdev.Line) {
+			defer wg.Done()
+			for {
+				// Wake up now and then to see if the capture's finished
+				ev, err := l.ReadEvent(100 * time.Millisecond)
+				switch {
+				case errors.Is(err, gpiocdev.ErrTimeout):
+				case err != nil:
+					errs <- err
+					return
+				default:
+					select {
+					case events <- lineEvent{bit, ev}:
+					case <-done:
+						return
+					}
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+			}
+		}(1<<uint(i), l)
+	}
+
+	last := time.Duration(0)
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case le := <-events:
+			n++
+			if le.ev.Rising {
+				levels |= le.bit
+			} else {
+				levels &^= le.bit
+			}
+			t := le.ev.Timestamp - base
+			if t < last {
+				t = last
+			}
+			last = t
+			if r.add(sample{t: t, levels: levels}) {
+				return n, nil
+			}
+		case <-tick.C:
+			// The capture's complete if its end has passed without any more edges,
+			// ignoring the end while there are edges waiting to be added
+			now := chip.Now() - base
+			if len(events) == 0 && r.unchanged(now) {
+				return n, nil
+			}
+			if !r.triggered && now > timeout {
+				return n, errNoTrigger
+			}
+		case err := <-errs:
+			return n, err
+		case <-stop:
+			return n, errInterrupted
+		}
+	}
+}
@@ -5,12 +5,15 @@
 // This program uses a direct implementation of software PWM to vary
 // an LED's brightness.
 //
-// Run using 'go run dimled.go'
+// Run using 'go run dimled.go'. '-backend' selects how the pin is driven, e.g.,
+// '-backend=cdev' for the GPIO character device or '-backend=sim' for a simulated
+// Raspberry Pi.
 //
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -19,33 +22,42 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 func main() {
-	// Initialize the go-rpio library. By default it uses BCM pin numbering.
-	if err := rpio.Open(); err != nil {
+	backend := flag.String("backend", "rpio", "how the pin is driven, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	chipName := flag.String("chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	flag.Parse()
+
+	// Open the board, e.g., initialize the go-rpio library. Pins use BCM pin numbering.
+	board, err := gpio.Open(*backend, *chipName)
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// Release resources held by the go-rpio library obtained above after
+	// Release resources held by the board obtained above after
 	// 'main()' exits.
-	defer rpio.Close()
+	defer board.Close()
 
-	// Set the pin (BCM pin 17) to OUTPUT mode to allow writes to the pin,
+	// Set the pin (BCM pin 18) to OUTPUT mode to allow writes to the pin,
 	// e.g., to set the pin to LOW or HIGH
-	pin := rpio.Pin(18)
+	pin, err := board.Pin(18)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	pin.Output()
 	pin.Low()
 
 	// Initialize signal handling needed to catch ctl-C
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT)
-	go interruptHandler(sigs, pin)
+	go interruptHandler(sigs, board, pin)
 
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Hit ctl-C to exit\nEnter a brightness brightVal between 10 and 10000 (e.g., 25):\n")
+	fmt.Print("Hit ctl-C to exit\nEnter a brightness brightVal between 10 and 10000 (e.g., 25):\n\n")
 	// Bad practice to ignore errors!
 	brightValStr, _ := reader.ReadString('\n')
 	brightValStr = strings.TrimSuffix(brightValStr, "\n")
@@ -77,10 +89,13 @@ func main() {
 	}
 }
 
-func interruptHandler(sigs chan os.Signal, pin rpio.Pin) {
+func interruptHandler(sigs chan os.Signal, board gpio.Board, pin gpio.Pin) {
 	<-sigs
 	fmt.Println("\nExiting...")
 	// Turn off the LED
 	pin.High()
+	// A fake or simulated board reports the pin's final state
+	gpio.Report(os.Stdout, board)
+	board.Close()
 	os.Exit(0)
 }
@@ -44,12 +44,14 @@
 // BCM pin 18 is used as it is a hardware PWM pin. Any hardware PWM pin can be used if desired.
 // The other hardware PWM pins are BCM pins 12, 13, and 19.
 //
-// Run using 'sudo /usr/local/go/bin/go run freqtest.go'
+// Run using 'sudo /usr/local/go/bin/go run freqtest.go'. '-backend=sim' runs it on a
+// simulated Raspberry Pi, no sudo needed.
 
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -57,27 +59,37 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 var (
-	ledPinGreen = rpio.Pin(13)
+	// ledPinGreen is BCM pin 13, set by main
+	ledPinGreen gpio.PWMPin
 	// With these numbers the effective frequency at the LED is 4800 Hz (9,600,000/2000).
 	freq  = 9600000
 	cycle = 2000
 )
 
 func ledInit() {
-	ledPinGreen.Mode(rpio.Pwm)
+	ledPinGreen.Mode(gpio.PWM)
 	ledPinGreen.Freq(freq)
 	ledPinGreen.DutyCycle(uint32(cycle/4), uint32(cycle))
 }
 
 func main() {
-	if err := rpio.Open(); err != nil {
+	backend := flag.String("backend", "rpio", "how the pin is driven, 'rpio' (the go-rpio library), 'fake', or 'sim'")
+	flag.Parse()
+
+	board, err := gpio.Open(*backend, "")
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer rpio.Close()
+	defer board.Close()
+	if ledPinGreen, err = board.PWMPin(13); err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	ledInit()
 
@@ -88,7 +100,7 @@ func main() {
 	// Initialize signal handling needed to catch ctl-C
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT)
-	go interruptHandler(sigs, ledPinGreen)
+	go interruptHandler(sigs, board, ledPinGreen)
 
 	reader := bufio.NewReader(os.Stdin)
 
@@ -139,10 +151,13 @@ func main() {
 	}
 }
 
-func interruptHandler(sigs chan os.Signal, pin rpio.Pin) {
+func interruptHandler(sigs chan os.Signal, board gpio.Board, pin gpio.PWMPin) {
 	<-sigs
 	fmt.Println("\nExiting...")
 	// Turn off the LED
 	pin.DutyCycle(0, uint32(cycle))
+	// A fake or simulated board reports the pin's final state
+	gpio.Report(os.Stdout, board)
+	board.Close()
 	os.Exit(0)
 }
@@ -0,0 +1,46 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package measure
+
+// Expected is the signal that a PWM output's settings should produce. Times are in
+// seconds.
+type Expected struct {
+	Period float64 // the mean period, 0 if the output is always LOW or always HIGH
+	Duty   float64 // the fraction of the time the output is HIGH
+	Steady bool    // the period is the same every cycle, i.e., mark-space mode
+}
+
+// Expect returns what a PWM output with a clock of 'clockHz', a range of 'rng' clock
+// ticks, and a pulse width of 'pulseWidth' ticks should produce.
+//
+// In mark-space mode the output is HIGH for the first 'pulseWidth' ticks of every
+// 'rng' ticks. In balanced mode the HIGH ticks are spread evenly over the range:
+// each tick the PWM adds 'pulseWidth' to a counter and outputs HIGH, subtracting
+// 'rng', if the counter has reached 'rng'. So for a duty cycle of up to 50% the
+// HIGH ticks are single pulses, and above 50% the LOW ticks are, and the period
+// varies from cycle to cycle unless 'rng' is a multiple of the number of pulses.
+func Expect(clockHz, rng, pulseWidth int, balanced bool) Expected {
+	if clockHz <= 0 || rng <= 0 || pulseWidth <= 0 {
+		return Expected{Steady: !balanced}
+	}
+	if pulseWidth >= rng {
+		return Expected{Duty: 1, Steady: !balanced}
+	}
+	exp := Expected{Duty: float64(pulseWidth) / float64(rng), Steady: !balanced}
+	tick := 1 / float64(clockHz)
+	if !balanced {
+		exp.Period = float64(rng) * tick
+		return exp
+	}
+	pulses := pulseWidth
+	if rng-pulseWidth < pulses {
+		pulses = rng - pulseWidth
+	}
+	exp.Period = float64(rng) / float64(pulses) * tick
+	exp.Steady = rng%pulses == 0
+	return exp
+}
@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package measure measures a PWM signal from the times of its edges, e.g., edges
+// captured from an input pin connected to a PWM output. Each cycle's period, HIGH
+// time, and duty cycle are measured, along with how much they vary from cycle to
+// cycle (jitter), so they can be compared with what the PWM settings should produce.
+package measure
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Edge is a change in the signal's level
+type Edge struct {
+	At   time.Duration // when the edge happened, relative to any fixed time
+	High bool          // true for a rising edge, false for a falling edge
+	Lost bool          // edges were lost just before this one, e.g., the kernel's event queue overflowed
+}
+
+// Cycle is one PWM cycle, from a rising edge to the next rising edge
+type Cycle struct {
+	Start  time.Duration
+	Period time.Duration
+	High   time.Duration // from the rising edge to the falling edge
+}
+
+// Duty returns the fraction of the cycle the signal was HIGH
+func (c Cycle) Duty() float64 {
+	return float64(c.High) / float64(c.Period)
+}
+
+// Cycles returns the complete cycles in 'edges', which must be in time order. A
+// cycle is skipped if it doesn't have exactly one falling edge, because an edge was
+// missed, or if edges were lost during it. 'skipped' is the number of cycles skipped.
+func Cycles(edges []Edge) (cycles []Cycle, skipped int) {
+	return firstCycles(edges, 0)
+}
+
+// firstCycles returns the first 'max' complete cycles in 'edges', like Cycles, all
+// of them if 'max' is 0. Only the cycles skipped before the last one returned are
+// counted in 'skipped'.
+func firstCycles(edges []Edge, max int) (cycles []Cycle, skipped int) {
+	var (
+		start   time.Duration
+		fall    time.Duration
+		falls   int
+		started bool // true once the first rising edge has been seen
+		broken  bool // true if edges were lost during the current cycle
+	)
+	for _, e := range edges {
+		if e.Lost {
+			broken = true
+		}
+		if !e.High {
+			fall, falls = e.At, falls+1
+			continue
+		}
+		if started {
+			if broken || falls != 1 || e.At <= start {
+				skipped++
+			} else {
+				cycles = append(cycles, Cycle{Start: start, Period: e.At - start, High: fall - start})
+				if len(cycles) == max {
+					break
+				}
+			}
+		}
+		start, falls, started, broken = e.At, 0, true, false
+	}
+	return cycles, skipped
+}
+
+// Stats summarizes a set of values
+type Stats struct {
+	N      int
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64 // the population standard deviation
+}
+
+// NewStats returns the statistics of 'values'
+func NewStats(values []float64) Stats {
+	s := Stats{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	s.Min, s.Max = values[0], values[0]
+	sum := 0.0
+	for _, v := range values {
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+		sum += v
+	}
+	s.Mean = sum / float64(s.N)
+	sq := 0.0
+	for _, v := range values {
+		sq += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(sq / float64(s.N))
+	return s
+}
+
+// Bin is a histogram bin, it counts the values from 'Lo' up to, but not including,
+// 'Hi'. The last bin includes 'Hi'.
+type Bin struct {
+	Lo, Hi float64
+	Count  int
+}
+
+// Histogram sorts 'values' into 'bins' equal width bins spanning their range. All
+// of the values are in a single bin if they're the same.
+func Histogram(values []float64, bins int) []Bin {
+	if len(values) == 0 || bins < 1 {
+		return nil
+	}
+	s := NewStats(values)
+	if s.Max == s.Min {
+		return []Bin{{Lo: s.Min, Hi: s.Max, Count: len(values)}}
+	}
+	width := (s.Max - s.Min) / float64(bins)
+	hist := make([]Bin, bins)
+	for i := range hist {
+		hist[i].Lo = s.Min + float64(i)*width
+		hist[i].Hi = s.Min + float64(i+1)*width
+	}
+	hist[bins-1].Hi = s.Max
+	for _, v := range values {
+		i := int((v - s.Min) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		hist[i].Count++
+	}
+	return hist
+}
+
+// Result is a measurement of a PWM signal. Times are in seconds.
+type Result struct {
+	Cycles  []Cycle
+	Skipped int     // cycles skipped because edges were missed or lost, up to the last cycle measured
+	Period  Stats   // each cycle's period
+	High    Stats   // each cycle's HIGH time
+	Duty    Stats   // each cycle's duty cycle, as a fraction
+	Freq    float64 // the frequency, in Hz, from the mean period
+	AvgDuty float64 // the total HIGH time divided by the total time of the cycles
+}
+
+// ErrNoCycles is returned by Analyze if there isn't a complete cycle to measure
+var ErrNoCycles = errors.New("no complete PWM cycles")
+
+// Analyze measures the first 'max' complete cycles in 'edges', all of them if 'max'
+// is 0. 'edges' must be in time order. Only the cycles skipped before the last one
+// measured are counted.
+func Analyze(edges []Edge, max int) (Result, error) {
+	cycles, skipped := firstCycles(edges, max)
+	if len(cycles) == 0 {
+		return Result{Skipped: skipped}, ErrNoCycles
+	}
+
+	periods := make([]float64, len(cycles))
+	highs := make([]float64, len(cycles))
+	duties := make([]float64, len(cycles))
+	var total, high time.Duration
+	for i, c := range cycles {
+		periods[i] = c.Period.Seconds()
+		highs[i] = c.High.Seconds()
+		duties[i] = c.Duty()
+		total += c.Period
+		high += c.High
+	}
+	res := Result{
+		Cycles:  cycles,
+		Skipped: skipped,
+		Period:  NewStats(periods),
+		High:    NewStats(highs),
+		Duty:    NewStats(duties),
+		AvgDuty: float64(high) / float64(total),
+	}
+	res.Freq = 1 / res.Period.Mean
+	return res, nil
+}
+
+// Periods returns the cycles' periods in seconds, e.g., for a histogram
+func (r Result) Periods() []float64 {
+	periods := make([]float64, len(r.Cycles))
+	for i, c := range r.Cycles {
+		periods[i] = c.Period.Seconds()
+	}
+	return periods
+}
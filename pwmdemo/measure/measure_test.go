@@ -0,0 +1,221 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package measure
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const us = time.Microsecond
+
+// rise and fall return rising and falling edges at 'at' microseconds
+func rise(at int) Edge { return Edge{At: time.Duration(at) * us, High: true} }
+func fall(at int) Edge { return Edge{At: time.Duration(at) * us} }
+
+// lost returns 'e' marked as following lost edges
+func lost(e Edge) Edge {
+	e.Lost = true
+	return e
+}
+
+// cycle returns a cycle starting at 'start' microseconds
+func cycle(start, period, high int) Cycle {
+	return Cycle{Start: time.Duration(start) * us, Period: time.Duration(period) * us, High: time.Duration(high) * us}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name        string
+		edges       []Edge
+		want        []Cycle
+		wantSkipped int
+	}{
+		{name: "no edges"},
+		{name: "one rising edge", edges: []Edge{rise(0), fall(250)}},
+		{
+			// A 1kHz, 25% duty cycle signal captured a little after it started
+			name:  "recorded",
+			edges: []Edge{fall(120), rise(870), fall(1120), rise(1870), fall(2121), rise(2869), fall(3120), rise(3870)},
+			want:  []Cycle{cycle(870, 1000, 250), cycle(1870, 999, 251), cycle(2869, 1001, 251)},
+		},
+		{
+			name:        "missed falling edge",
+			edges:       []Edge{rise(0), fall(250), rise(1000), rise(2000), fall(2250), rise(3000)},
+			want:        []Cycle{cycle(0, 1000, 250), cycle(2000, 1000, 250)},
+			wantSkipped: 1,
+		},
+		{
+			name:        "missed rising edge",
+			edges:       []Edge{rise(0), fall(250), rise(1000), fall(1250), fall(2250), rise(3000), fall(3250), rise(4000)},
+			want:        []Cycle{cycle(0, 1000, 250), cycle(3000, 1000, 250)},
+			wantSkipped: 1,
+		},
+		{
+			name:        "lost edges",
+			edges:       []Edge{rise(0), fall(250), rise(1000), lost(fall(1250)), rise(2000), fall(2250), rise(3000)},
+			want:        []Cycle{cycle(0, 1000, 250), cycle(2000, 1000, 250)},
+			wantSkipped: 1,
+		},
+		{
+			name:        "lost edges before a rising edge",
+			edges:       []Edge{rise(0), fall(250), lost(rise(1000)), fall(1250), rise(2000)},
+			wantSkipped: 1,
+			want:        []Cycle{cycle(1000, 1000, 250)},
+		},
+		{
+			name:        "rising edges at the same time",
+			edges:       []Edge{rise(0), fall(0), rise(0), fall(250), rise(1000)},
+			want:        []Cycle{cycle(0, 1000, 250)},
+			wantSkipped: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cycles, skipped := Cycles(tc.edges)
+			if !reflect.DeepEqual(cycles, tc.want) || skipped != tc.wantSkipped {
+				t.Errorf("got %v, %d skipped, want %v, %d skipped", cycles, skipped, tc.want, tc.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	// 4 cycles, 1000, 999, 1001, and 1000us long, and an incomplete one
+	edges := []Edge{rise(0), fall(250), rise(1000), fall(1249), rise(1999), fall(2251), rise(3000), fall(3249), rise(4000), fall(4250)}
+	res, err := Analyze(edges, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Cycles) != 4 || res.Skipped != 0 {
+		t.Fatalf("got %d cycles, %d skipped, want 4 cycles", len(res.Cycles), res.Skipped)
+	}
+	near := func(name string, got, want float64) {
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("got %s %g, want %g", name, got, want)
+		}
+	}
+	near("period mean", res.Period.Mean, 1000e-6)
+	near("period min", res.Period.Min, 999e-6)
+	near("period max", res.Period.Max, 1001e-6)
+	near("period std dev", res.Period.StdDev, math.Sqrt(0.5)*1e-6)
+	near("HIGH mean", res.High.Mean, 250e-6)
+	near("HIGH min", res.High.Min, 249e-6)
+	near("HIGH max", res.High.Max, 252e-6)
+	near("frequency", res.Freq, 1000)
+	near("average duty cycle", res.AvgDuty, 0.25)
+	near("duty cycle min", res.Duty.Min, 249.0/1000)
+	near("duty cycle max", res.Duty.Max, 252.0/1001)
+	if got := res.Periods(); !reflect.DeepEqual(got, []float64{1000e-6, 999e-6, 1001e-6, 1000e-6}) {
+		t.Errorf("got periods %v", got)
+	}
+}
+
+func TestAnalyzeMax(t *testing.T) {
+	// Cycles at 0 and 2000us, with skipped cycles at 1000 and 3000us
+	edges := []Edge{rise(0), fall(250), rise(1000), rise(2000), fall(2500), rise(3000), lost(fall(3250)), rise(4000)}
+
+	tests := []struct {
+		max         int
+		wantCycles  []Cycle
+		wantSkipped int
+	}{
+		{max: 0, wantCycles: []Cycle{cycle(0, 1000, 250), cycle(2000, 1000, 500)}, wantSkipped: 2},
+		{max: 1, wantCycles: []Cycle{cycle(0, 1000, 250)}, wantSkipped: 0},
+		{max: 2, wantCycles: []Cycle{cycle(0, 1000, 250), cycle(2000, 1000, 500)}, wantSkipped: 1},
+		{max: 3, wantCycles: []Cycle{cycle(0, 1000, 250), cycle(2000, 1000, 500)}, wantSkipped: 2},
+	}
+
+	for _, tc := range tests {
+		res, err := Analyze(edges, tc.max)
+		if err != nil {
+			t.Fatalf("max %d: %s", tc.max, err)
+		}
+		if !reflect.DeepEqual(res.Cycles, tc.wantCycles) || res.Skipped != tc.wantSkipped {
+			t.Errorf("max %d: got %v, %d skipped, want %v, %d skipped", tc.max, res.Cycles, res.Skipped, tc.wantCycles, tc.wantSkipped)
+		}
+	}
+}
+
+func TestAnalyzeNoCycles(t *testing.T) {
+	tests := []struct {
+		name        string
+		edges       []Edge
+		wantSkipped int
+	}{
+		{name: "no edges"},
+		{name: "always HIGH", edges: []Edge{rise(0)}},
+		{name: "no falling edges", edges: []Edge{rise(0), rise(1000), rise(2000)}, wantSkipped: 2},
+		{name: "lost edges", edges: []Edge{rise(0), lost(fall(250)), rise(1000)}, wantSkipped: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := Analyze(tc.edges, 0)
+			if !errors.Is(err, ErrNoCycles) {
+				t.Fatalf("got error %v, want ErrNoCycles", err)
+			}
+			if res.Skipped != tc.wantSkipped {
+				t.Errorf("got %d skipped, want %d", res.Skipped, tc.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestNewStats(t *testing.T) {
+	if s := NewStats(nil); s != (Stats{}) {
+		t.Errorf("got %+v for no values", s)
+	}
+	s := NewStats([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if want := (Stats{N: 8, Min: 2, Max: 9, Mean: 5, StdDev: 2}); s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		bins   int
+		want   []Bin
+	}{
+		{name: "no values", values: nil, bins: 4},
+		{name: "no bins", values: []float64{1, 2}, bins: 0},
+		{
+			name:   "identical values",
+			values: []float64{1e-3, 1e-3, 1e-3},
+			bins:   4,
+			want:   []Bin{{Lo: 1e-3, Hi: 1e-3, Count: 3}},
+		},
+		{
+			name:   "one bin",
+			values: []float64{3, 1, 2},
+			bins:   1,
+			want:   []Bin{{Lo: 1, Hi: 3, Count: 3}},
+		},
+		{
+			// The maximum is in the last bin, and a value on a boundary is in the
+			// bin above it
+			name:   "bins",
+			values: []float64{0, 1, 1.5, 2, 3.9, 4},
+			bins:   4,
+			want:   []Bin{{Lo: 0, Hi: 1, Count: 1}, {Lo: 1, Hi: 2, Count: 2}, {Lo: 2, Hi: 3, Count: 1}, {Lo: 3, Hi: 4, Count: 2}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Histogram(tc.values, tc.bins); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@
 // sudo /usr/local/go/bin/go run apps/freqtest.go
 // Run example (See 'flag.*Var()' calls below for details regarding the meaning of the flags):
 // sudo /usr/local/go/bin/go run apps/freqtest.go -pwmType="hardware" -freq="5000" -range="100" -pulsewidth="2" -pin="18"
+// '-backend=sim' runs it on a simulated Raspberry Pi, no sudo needed.
 //
 
 package main
@@ -38,7 +39,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 func main() {
@@ -48,6 +49,7 @@ func main() {
 		pwmPin     int
 		pulsewidth int
 		pwmMode    bool
+		backend    string
 	)
 	pwmType := ""
 
@@ -56,44 +58,49 @@ func main() {
 	flag.IntVar(&rrange, "range", 10, "PWM range")
 	flag.IntVar(&pwmPin, "pin", 18, "BCM pin number")
 	flag.IntVar(&pulsewidth, "pulsewidth", 2, "PWM Pulse Width")
-	flag.BoolVar(&pwmMode, "pwmmode", rpio.Balanced, "PWM Mode, Balanced (true) or MarkSpace (false)")
+	flag.BoolVar(&pwmMode, "pwmmode", true, "PWM Mode, Balanced (true) or MarkSpace (false)")
+	flag.StringVar(&backend, "backend", "rpio", "how the pin is driven, 'rpio' (the go-rpio library), 'fake', or 'sim'")
 	flag.Parse()
 
 	fmt.Printf("Using: PWM pin: %d, PWM Type: %s, freq: %d, range: %d, pulse width: %d, pwm mode: %t\n",
 		pwmPin, pwmType, freq, rrange, pulsewidth, pwmMode)
 
 	// Obtain GPIO resources
-	if err := rpio.Open(); err != nil {
+	board, err := gpio.Open(backend, "")
+	if err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
-	defer rpio.Close()
+	defer board.Close()
 	if pwmType == "software" {
-		runSoftwarePWM(pwmPin, rrange, pulsewidth)
+		runSoftwarePWM(board, pwmPin, rrange, pulsewidth)
 		return
 	}
 
-	runHardwarePwm(pwmPin, freq, uint32(rrange), uint32(pulsewidth), pwmMode)
+	runHardwarePwm(board, pwmPin, freq, uint32(rrange), uint32(pulsewidth), pwmMode)
 }
 
 // runHardwarePWM starts PWM as implemented in the board hardware.
-func runHardwarePwm(gpin, freq int, rrange, pulsewidth uint32, pwmMode bool) {
+func runHardwarePwm(board gpio.Board, gpin, freq int, rrange, pulsewidth uint32, pwmMode bool) {
 	// Define the pin to be used,
 	// followed by setting its mode to PWM,
 	// then set directly set the PWM Clock frequency (note lack of divisor),
 	// finally set the range and pulse width (pin.DutyCycle())
 	// and send the PWM signal to the pin
-	pin := rpio.Pin(gpin)
-	pin.Mode(rpio.Pwm)
+	pin, err := board.PWMPin(gpin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pin.Mode(gpio.PWM)
 	pin.Freq(freq)
-	// To test rpio.SetDutyCycle() comment out the next line and uncomment the one below it.
-	rpio.SetDutyCycleWithPwmMode(pin, pulsewidth, rrange, pwmMode)
-	//rpio.SetDutyCycle(pin, pulsewidth, rrange)
+	// To test pin.DutyCycle() comment out the next line and uncomment the one below it.
+	pin.DutyCycleWithPWMMode(pulsewidth, rrange, pwmMode)
+	//pin.DutyCycle(pulsewidth, rrange)
 
 	// Initialize signal handling needed to catch ctl-C
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL)
-	go hardwareInterruptHandler(sigs, rrange, pin)
+	go hardwareInterruptHandler(sigs, board, rrange, pin)
 
 	// Sleep until ctl-C is caught
 	for {
@@ -102,9 +109,12 @@ func runHardwarePwm(gpin, freq int, rrange, pulsewidth uint32, pwmMode bool) {
 }
 
 // runSoftwarePWM starts PWM implemented by this function vs. via the board hardware
-func runSoftwarePWM(gpin, rrange, pulsewidth int) {
+func runSoftwarePWM(board gpio.Board, gpin, rrange, pulsewidth int) {
 	// Define the pin to be used for software PWM
-	pin := rpio.Pin(gpin)
+	pin, err := board.Pin(gpin)
+	if err != nil {
+		log.Fatal(err)
+	}
 	// Set the pin mode to output so it can accept write
 	// requests.
 	pin.Output()
@@ -112,7 +122,7 @@ func runSoftwarePWM(gpin, rrange, pulsewidth int) {
 	// Initialize signal handling needed to catch ctl-C
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL)
-	go softwareInterruptHandler(sigs, rrange, pin, rpio.Low)
+	go softwareInterruptHandler(sigs, board, rrange, pin, gpio.Low)
 
 	for {
 		// Execute the software driven duty cycle defined by rrange and
@@ -134,9 +144,9 @@ func runSoftwarePWM(gpin, rrange, pulsewidth int) {
 		//
 		// Loop until a ctl-C signal is caught
 		for {
-			rpio.WritePin(pin, rpio.High)
+			pin.Write(gpio.High)
 			time.Sleep((time.Microsecond * 100) * time.Duration(pulsewidth))
-			rpio.WritePin(pin, rpio.Low)
+			pin.Write(gpio.Low)
 			time.Sleep((time.Microsecond * 100) * time.Duration(rrange-pulsewidth))
 
 		}
@@ -147,13 +157,15 @@ func runSoftwarePWM(gpin, rrange, pulsewidth int) {
 // return the pin to it's state before the program started and release GPIO resources
 // before exiting. It is registered as the SIGINT handler when hardware PWM is
 // specified.
-func hardwareInterruptHandler(sigs chan os.Signal, rrange uint32, pin rpio.Pin) {
+func hardwareInterruptHandler(sigs chan os.Signal, board gpio.Board, rrange uint32, pin gpio.PWMPin) {
 	<-sigs
 	fmt.Println("\nExiting...")
 	// Turn off the LED
 	pin.DutyCycle(0, rrange)
-	//pin.Mode(rpio.Output)
-	rpio.Close()
+	//pin.Mode(gpio.Output)
+	// A fake or simulated board reports the pin's final state
+	gpio.Report(os.Stdout, board)
+	board.Close()
 	os.Exit(0)
 
 }
@@ -161,12 +173,14 @@ func hardwareInterruptHandler(sigs chan os.Signal, rrange uint32, pin rpio.Pin)
 // softwareInterruptHandler handles the SIGINT caught when ctl-C is entered. It will
 // return the pin to it's state before the program started and release GPIO resources
 // before exiting. It is registered as the SIGINT handler when softare PWM is specified.
-func softwareInterruptHandler(sigs chan os.Signal, rrange int, pin rpio.Pin, off rpio.State) {
+func softwareInterruptHandler(sigs chan os.Signal, board gpio.Board, rrange int, pin gpio.Pin, off gpio.State) {
 	<-sigs
 	fmt.Println("\nExiting...")
 	// Turn off the LED
-	rpio.WritePin(pin, off)
-	rpio.Close()
+	pin.Write(off)
+	// A fake or simulated board reports the pin's final state
+	gpio.Report(os.Stdout, board)
+	board.Close()
 	os.Exit(0)
 
 }
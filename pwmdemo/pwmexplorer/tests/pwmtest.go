@@ -7,6 +7,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -14,7 +15,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 const cycle = 2400000
@@ -22,14 +23,21 @@ const cycle = 2400000
 //const cycle = 2400000
 
 func main() {
-	if err := rpio.Open(); err != nil {
+	backend := flag.String("backend", "rpio", "how the pin is driven, 'rpio' (the go-rpio library), 'fake', or 'sim'")
+	flag.Parse()
+
+	board, err := gpio.Open(*backend, "")
+	if err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
-	defer rpio.Close()
+	defer board.Close()
 
-	ledPin := rpio.Pin(18)
-	ledPin.Mode(rpio.Pwm)
+	ledPin, err := board.PWMPin(18)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ledPin.Mode(gpio.PWM)
 
 	//ledPin.Freq(64000)
 	ledPin.Freq(9600000)
@@ -50,13 +58,13 @@ func main() {
 	//	}
 }
 
-func pwmInterruptHandler(sigs chan os.Signal, pin rpio.Pin) {
+func pwmInterruptHandler(sigs chan os.Signal, pin gpio.PWMPin) {
 	<-sigs
 	fmt.Println("\nExiting...")
 	// Turn off the LED
 	pin.DutyCycle(0, uint32(cycle))
-	pin.Mode(rpio.Output)
-	pin.Mode(rpio.Pwm)
+	pin.Mode(gpio.Output)
+	pin.Mode(gpio.PWM)
 	os.Exit(0)
 
 }
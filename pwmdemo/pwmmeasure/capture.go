@@ -0,0 +1,213 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/gpiocdev"
+	"github.com/youngkin/gpio/pwmdemo/measure"
+)
+
+var (
+	errInterrupted = errors.New("interrupted")
+	errTimeout     = errors.New("timed out")
+)
+
+// capturePoll reads 'pin' as fast as possible, recording its edges until there
+// are 'cycles' complete cycles, 'timeout' passes, or 'stop' is closed. An edge
+// is marked as lost if the pin wasn't read for 'gap' before it, e.g., because the
+// program was descheduled, as a pulse could have been missed. It returns the edges
+// and the average time between reads.
+//
+// An edge's time is when the new level was read, so the timing is only as good as
+// the time between reads.
+func capturePoll(pin gpio.Pin, cycles int, gap, timeout time.Duration, stop <-chan struct{}) (edges []measure.Edge, every time.Duration, err error) {
+	start := time.Now()
+	level := pin.Read()
+	last := time.Duration(0)
+	lost := false
+	rising, need := 0, cycles+1
+	n := 0
+	defer func() {
+		every = time.Since(start) / time.Duration(n)
+	}()
+	for {
+		s := pin.Read()
+		now := time.Since(start)
+		n++
+		if gap > 0 && now-last > gap {
+			lost = true
+		}
+		last = now
+		if s != level {
+			level = s
+			edges = append(edges, measure.Edge{At: now, High: s == gpio.High, Lost: lost})
+			lost = false
+			if s == gpio.High {
+				if rising++; rising >= need {
+					if need = rising + more(edges, cycles); need == rising {
+						return edges, 0, nil
+					}
+				}
+			}
+		}
+
+		// Checking for the end every read would slow the reads down
+		if n%1024 == 0 {
+			if now > timeout {
+				return edges, 0, errTimeout
+			}
+			select {
+			case <-stop:
+				return edges, 0, errInterrupted
+			default:
+			}
+		}
+	}
+}
+
+// captureEvents records the edge events of line 'offset' of 'chip' until there are
+// 'cycles' complete cycles, 'timeout' passes, or 'stop' is closed. The kernel
+// timestamps the events so their timing is accurate to within a few microseconds,
+// but fast signals can overflow the kernel's event queue. A gap in the events'
+// sequence numbers marks the next edge as lost.
+func captureEvents(chip *gpiocdev.Chip, offset int, bias gpiocdev.Bias, cycles int, timeout time.Duration, stop <-chan struct{}) ([]measure.Edge, error) {
+	l, err := chip.RequestLine(offset, "pwmmeasure", gpiocdev.LineConfig{Bias: bias, Edge: gpiocdev.BothEdges})
+	if err != nil {
+		return nil, fmt.Errorf("unable to request line %d, %w", offset, err)
+	}
+	defer l.Close()
+
+	var edges []measure.Edge
+	base := chip.Now()
+	var seqno uint32
+	rising, need := 0, cycles+1
+	for {
+		// Wake up now and then to check for the end
+		ev, err := l.ReadEvent(100 * time.Millisecond)
+		switch {
+		case errors.Is(err, gpiocdev.ErrTimeout):
+		case err != nil:
+			return edges, err
+		default:
+			edges = append(edges, measure.Edge{
+				At:   ev.Timestamp - base,
+				High: ev.Rising,
+				Lost: seqno != 0 && ev.Seqno != seqno+1,
+			})
+			seqno = ev.Seqno
+			if ev.Rising {
+				if rising++; rising >= need {
+					if need = rising + more(edges, cycles); need == rising {
+						return edges, nil
+					}
+				}
+			}
+		}
+
+		if chip.Now()-base > timeout {
+			return edges, errTimeout
+		}
+		select {
+		case <-stop:
+			return edges, errInterrupted
+		default:
+		}
+	}
+}
+
+// more returns the number of rising edges needed for 'edges' to have 'cycles'
+// complete cycles, a cycle ends with the next cycle's rising edge
+func more(edges []measure.Edge, cycles int) int {
+	got, _ := measure.Cycles(edges)
+	if len(got) >= cycles {
+		return 0
+	}
+	return cycles - len(got)
+}
+
+// writeEdges writes 'edges' to 'w', a line for each edge with its time in seconds,
+// relative to the first edge, and its level, followed by 'lost' if edges were lost
+// before it
+func writeEdges(w io.Writer, edges []measure.Edge) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range edges {
+		fmt.Fprintf(bw, "%.9f %d", (e.At - edges[0].At).Seconds(), boolToInt(e.High))
+		if e.Lost {
+			bw.WriteString(" lost")
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// saveEdges writes 'edges' to file 'path', see writeEdges
+func saveEdges(path string, edges []measure.Edge) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = writeEdges(f, edges)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readEdges reads a file of recorded edges, see writeEdges. Blank lines and lines
+// starting with '#' are ignored.
+func readEdges(path string) ([]measure.Edge, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	edges := []measure.Edge{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 && (len(fields) != 3 || fields[2] != "lost") {
+			return nil, fmt.Errorf("%s line %d: expected 'seconds level' or 'seconds level lost', got %q", path, lineNum, line)
+		}
+		secs, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || secs < 0 {
+			return nil, fmt.Errorf("%s line %d: invalid time %q", path, lineNum, fields[0])
+		}
+		if fields[1] != "0" && fields[1] != "1" {
+			return nil, fmt.Errorf("%s line %d: invalid level %q, must be 0 or 1", path, lineNum, fields[1])
+		}
+		at := time.Duration(secs*float64(time.Second) + 0.5)
+		if len(edges) > 0 && at < edges[len(edges)-1].At {
+			return nil, fmt.Errorf("%s line %d: edges must be in time order", path, lineNum)
+		}
+		edges = append(edges, measure.Edge{At: at, High: fields[1] == "1", Lost: len(fields) == 3})
+	}
+	return edges, scanner.Err()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
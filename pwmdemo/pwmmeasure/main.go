@@ -0,0 +1,299 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+// pwmmeasure checks that a hardware PWM output produces the frequency and duty cycle
+// its settings ask for. pwmexplorer reports the GPIO pin frequency as the PWM clock
+// frequency divided by the range, pwmmeasure measures it. Connect the PWM pin to an
+// input pin with a jumper wire and run, for example:
+//
+//	sudo go run ./pwmdemo/pwmmeasure -pin=18 -in=23 -freq=100000 -range=100 -pulsewidth=25
+//
+// The PWM output is started with the '-freq', '-range', '-pulsewidth', and
+// '-pwmmode' settings, the same as freqtest's, and '-cycles' cycles are captured
+// from the input. Each cycle's period, HIGH time, and duty cycle are measured, and
+// their mean, minimum, maximum, and standard deviation (the jitter) are reported
+// against what was asked for, along with a histogram of the periods. '-generate=false'
+// measures a PWM output started by another program, e.g., pwmexplorer, using the
+// settings to say what it should be.
+//
+// By default the input's edges are captured with the GPIO character device's edge
+// events, which the kernel timestamps. Very fast signals can overflow the kernel's
+// event queue, cycles with lost edges aren't measured. '-capture=poll' reads the
+// input in a tight loop using '-backend' instead, its timing is only as good as the
+// time between reads.
+//
+// '-record FILE' saves the captured edges and '-edges FILE' measures saved edges, no
+// Raspberry Pi needed. Each line of an edges file is the time in seconds since the
+// first edge and 1 for a rising edge, 0 for a falling edge, followed by 'lost' if
+// edges were lost before it, e.g.,
+//
+//	0.000000000 1
+//	0.000250000 0
+//	0.001000000 1
+//
+// Blank lines and lines starting with '#' are ignored.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+	"github.com/youngkin/gpio/gpiocdev"
+	"github.com/youngkin/gpio/pwmdemo/measure"
+)
+
+func main() {
+	var (
+		backend    string
+		chipName   string
+		pwmPin     int
+		inPin      int
+		freq       int
+		rrange     int
+		pulsewidth int
+		pwmMode    bool
+		generate   bool
+		method     string
+		pull       string
+		cycles     int
+		timeout    time.Duration
+		bins       int
+		record     string
+		edgeFile   string
+	)
+	flag.StringVar(&backend, "backend", "rpio", "how the PWM output is driven, and the input polled, 'rpio' (the go-rpio library), 'fake', or 'sim'")
+	flag.StringVar(&chipName, "chip", "gpiochip0", "GPIO character device used by '-capture=events'")
+	flag.IntVar(&pwmPin, "pin", 18, "BCM pin number of the PWM output, 12, 13, 18, or 19")
+	flag.IntVar(&inPin, "in", 23, "BCM pin number of the input the PWM output is connected to")
+	flag.IntVar(&freq, "freq", 100000, "PWM clock frequency")
+	flag.IntVar(&rrange, "range", 100, "PWM range")
+	flag.IntVar(&pulsewidth, "pulsewidth", 25, "PWM Pulse Width")
+	flag.BoolVar(&pwmMode, "pwmmode", false, "PWM Mode, Balanced (true) or MarkSpace (false)")
+	flag.BoolVar(&generate, "generate", true, "start the PWM output, false measures an output started by another program")
+	flag.StringVar(&method, "capture", "events", "how the input is captured, 'events' (the GPIO character device's edge events) or 'poll'")
+	flag.StringVar(&pull, "pull", "off", "the input's pull resistor, 'off', 'up', or 'down'")
+	flag.IntVar(&cycles, "cycles", 1000, "number of cycles measured")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "time allowed for the capture, the cycles captured by then are measured")
+	flag.IntVar(&bins, "bins", 10, "number of bins in the period histogram, 0 for no histogram")
+	flag.StringVar(&record, "record", "", "save the captured edges to this file")
+	flag.StringVar(&edgeFile, "edges", "", "measure the edges saved in this file instead of capturing them")
+	flag.Parse()
+
+	if cycles < 1 || rrange < 1 || pulsewidth < 0 || freq < 1 || bins < 0 {
+		fmt.Println("-cycles, -range, and -freq must be at least 1, -pulsewidth and -bins can't be negative")
+		os.Exit(1)
+	}
+	exp := measure.Expect(freq, rrange, pulsewidth, pwmMode)
+
+	if edgeFile != "" {
+		edges, err := readEdges(edgeFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := report(edges, cycles, freq, rrange, pulsewidth, pwmMode, exp, bins); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if _, ok := gpio.PWMChannel(pwmPin); !ok {
+		fmt.Printf("BCM pin %d isn't a hardware PWM pin, must be 12, 13, 18, or 19\n", pwmPin)
+		os.Exit(1)
+	}
+	if inPin < 0 || inPin >= gpio.HeaderPins || inPin == pwmPin {
+		fmt.Printf("invalid -in %d, must be a BCM pin from 0 thru %d other than the PWM pin\n", inPin, gpio.HeaderPins-1)
+		os.Exit(1)
+	}
+	var pullUpDown gpio.Pull
+	var bias gpiocdev.Bias
+	switch pull {
+	case "off":
+		pullUpDown, bias = gpio.PullOff, gpiocdev.BiasDisabled
+	case "up":
+		pullUpDown, bias = gpio.PullUp, gpiocdev.PullUp
+	case "down":
+		pullUpDown, bias = gpio.PullDown, gpiocdev.PullDown
+	default:
+		fmt.Printf("invalid -pull %q, must be 'off', 'up', or 'down'\n", pull)
+		os.Exit(1)
+	}
+	if method != "events" && method != "poll" {
+		fmt.Printf("invalid -capture %q, must be 'events' or 'poll'\n", method)
+		os.Exit(1)
+	}
+
+	// The board is only needed to start the PWM output or to poll the input
+	var board gpio.Board
+	var err error
+	if generate || method == "poll" {
+		if board, err = gpio.Open(backend, chipName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	var pwm gpio.PWMPin
+	if generate {
+		if pwm, err = board.PWMPin(pwmPin); err != nil {
+			board.Close()
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		pwm.Mode(gpio.PWM)
+		pwm.Freq(freq)
+		pwm.DutyCycleWithPWMMode(uint32(pulsewidth), uint32(rrange), pwmMode)
+		// Let the output settle before it's measured
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Ctrl-C stops the capture, the cycles captured so far are measured
+	stop := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		close(stop)
+	}()
+
+	var edges []measure.Edge
+	if method == "events" {
+		var chip *gpiocdev.Chip
+		if chip, err = gpiocdev.OpenChip(chipName); err == nil {
+			edges, err = captureEvents(chip, inPin, bias, cycles, timeout, stop)
+			chip.Close()
+		}
+	} else {
+		var in gpio.Pin
+		if in, err = board.Pin(inPin); err == nil {
+			in.Input()
+			in.Pull(pullUpDown)
+			var every time.Duration
+			edges, every, err = capturePoll(in, cycles, shortestPulse(exp, freq), timeout, stop)
+			fmt.Printf("Read the input every %s on average\n", every)
+		}
+	}
+
+	if pwm != nil {
+		// Turn off the PWM output
+		pwm.DutyCycle(0, uint32(rrange))
+	}
+	if board != nil {
+		if cerr := board.Close(); cerr != nil {
+			fmt.Println(cerr)
+		}
+	}
+	switch {
+	case errors.Is(err, errInterrupted):
+		fmt.Println("Interrupted, measuring the cycles captured so far")
+	case errors.Is(err, errTimeout):
+		fmt.Printf("Timed out after %s, measuring the cycles captured so far\n", timeout)
+	case err != nil:
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if record != "" && len(edges) > 0 {
+		if err := saveEdges(record, edges); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("%d edges saved to %s\n", len(edges), record)
+	}
+	if len(edges) == 0 {
+		fmt.Printf("BCM %d didn't change, is it connected to BCM %d? The output is constant if the duty cycle is 0%% or 100%%.\n", inPin, pwmPin)
+		os.Exit(1)
+	}
+	if err := report(edges, cycles, freq, rrange, pulsewidth, pwmMode, exp, bins); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// shortestPulse returns the shortest HIGH or LOW pulse expected, a pulse could have
+// been missed if the input isn't read for this long
+func shortestPulse(exp measure.Expected, freq int) time.Duration {
+	if !exp.Steady {
+		// A balanced mode pulse can be a single clock tick
+		return time.Duration(float64(time.Second) / float64(freq))
+	}
+	pulse := math.Min(exp.Duty, 1-exp.Duty) * exp.Period
+	return time.Duration(pulse * float64(time.Second))
+}
+
+// report measures the first 'cycles' cycles of 'edges' and prints the results
+// against 'exp', what the PWM settings should produce
+func report(edges []measure.Edge, cycles, freq, rrange, pulsewidth int, balanced bool, exp measure.Expected, bins int) error {
+	mode := "mark-space"
+	if balanced {
+		mode = "balanced"
+	}
+	fmt.Printf("Requested: PWM clock %d Hz, range %d, pulse width %d, %s mode\n", freq, rrange, pulsewidth, mode)
+	if exp.Period > 0 {
+		fmt.Printf("  frequency %s, period %s, duty cycle %.2f%%\n", hz(1/exp.Period), us(exp.Period), exp.Duty*100)
+		if !exp.Steady {
+			fmt.Println("  in balanced mode the period varies from cycle to cycle, these are averages")
+		}
+	} else {
+		fmt.Printf("  a constant output, duty cycle %.0f%%\n", exp.Duty*100)
+	}
+
+	res, err := measure.Analyze(edges, cycles)
+	if err != nil {
+		return fmt.Errorf("%w in %d edges, %d cycles skipped because of missed or lost edges", err, len(edges), res.Skipped)
+	}
+	fmt.Printf("Measured %d cycles", len(res.Cycles))
+	if res.Skipped > 0 {
+		fmt.Printf(", %d skipped because of missed or lost edges", res.Skipped)
+	}
+	fmt.Println()
+	fmt.Printf("  frequency %s", hz(res.Freq))
+	if exp.Period > 0 {
+		fmt.Printf(", %+.3f%% from requested", (res.Freq*exp.Period-1)*100)
+	}
+	fmt.Printf("\n  duty cycle %.2f%% overall", res.AvgDuty*100)
+	if exp.Period > 0 {
+		fmt.Printf(", %+.2f points from requested", (res.AvgDuty-exp.Duty)*100)
+	}
+	fmt.Println()
+	fmt.Printf("  %-10s %12s %12s %12s %12s\n", "", "mean", "min", "max", "std dev")
+	fmt.Printf("  %-10s %12s %12s %12s %12s\n", "period", us(res.Period.Mean), us(res.Period.Min), us(res.Period.Max), us(res.Period.StdDev))
+	fmt.Printf("  %-10s %12s %12s %12s %12s\n", "high time", us(res.High.Mean), us(res.High.Min), us(res.High.Max), us(res.High.StdDev))
+	fmt.Printf("  %-10s %11.2f%% %11.2f%% %11.2f%% %11.2f%%\n", "duty cycle", res.Duty.Mean*100, res.Duty.Min*100, res.Duty.Max*100, res.Duty.StdDev*100)
+	if bins == 0 {
+		return nil
+	}
+
+	hist := measure.Histogram(res.Periods(), bins)
+	most := 0
+	for _, b := range hist {
+		if b.Count > most {
+			most = b.Count
+		}
+	}
+	fmt.Println("Periods:")
+	for _, b := range hist {
+		fmt.Printf("  %12s - %-12s %7d %s\n", us(b.Lo), us(b.Hi), b.Count, strings.Repeat("#", (b.Count*40+most-1)/most))
+	}
+	return nil
+}
+
+// us formats 'secs' in microseconds
+func us(secs float64) string {
+	return fmt.Sprintf("%.3fµs", secs*1e6)
+}
+
+// hz formats frequency 'f'
+func hz(f float64) string {
+	return fmt.Sprintf("%.3fHz", f)
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/gif" // register the GIF, JPEG, and PNG decoders with image.Decode()
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxSamples limits the number of pixels sampled along each axis of an image.
+// Sampling a 64x64 grid gives the same color as sampling every pixel for all
+// practical purposes and keeps up with a video stream on a Pi.
+const maxSamples = 64
+
+// dirPollInterval is how often a watched directory is checked for a new image
+const dirPollInterval = 250 * time.Millisecond
+
+// ambientConfig contains the settings for the ambient (bias light) mode
+type ambientConfig struct {
+	source    string        // image file, directory to watch, or '-' for a PPM stream on stdin
+	method    string        // 'average' or 'dominant'
+	weight    string        // 'uniform', 'edges', or 'center'
+	rate      float64       // LED updates per second
+	smoothing time.Duration // time for the LED to move ~63% of the way to a new color
+}
+
+// validate checks the ambient mode settings
+func (cfg ambientConfig) validate() error {
+	if cfg.method != "average" && cfg.method != "dominant" {
+		return fmt.Errorf("invalid ambient method %q, must be 'average' or 'dominant'", cfg.method)
+	}
+	if cfg.weight != "uniform" && cfg.weight != "edges" && cfg.weight != "center" {
+		return fmt.Errorf("invalid ambient weighting %q, must be 'uniform', 'edges', or 'center'", cfg.weight)
+	}
+	if cfg.rate <= 0 || cfg.rate > 1000 {
+		return fmt.Errorf("ambient update rate must be greater than 0 and at most 1000, got %f", cfg.rate)
+	}
+	if cfg.smoothing < 0 {
+		return fmt.Errorf("ambient smoothing must not be negative, got %s", cfg.smoothing)
+	}
+	return nil
+}
+
+// ambient drives the LED to the color of the images from 'cfg.source' until the
+// program is stopped or, for a stream, the stream ends. Each new image sets a target
+// color and the LED moves smoothly towards it at 'cfg.rate' updates per second.
+func ambient(cfg ambientConfig, stop chan interface{}) {
+	colors := make(chan rgb)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- watchSource(cfg, colors, stop)
+		close(colors)
+	}()
+
+	interval := time.Duration(float64(time.Second) / cfg.rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// alpha is the fraction of the distance to the target color covered on each
+	// update. Computing it from the smoothing time constant, rather than using a
+	// fixed fraction, keeps the fade speed the same at any update rate.
+	alpha := 1.0
+	if cfg.smoothing > 0 {
+		alpha = 1 - math.Exp(-float64(interval)/float64(cfg.smoothing))
+	}
+
+	current := currentColor
+	target := current
+	for {
+		select {
+		case <-stop:
+			return
+		case c, ok := <-colors:
+			if !ok {
+				if err := <-errs; err != nil {
+					fmt.Println(err)
+				}
+				return
+			}
+			target = c
+		case <-ticker.C:
+			current = rgb{
+				red:   current.red + (target.red-current.red)*alpha,
+				green: current.green + (target.green-current.green)*alpha,
+				blue:  current.blue + (target.blue-current.blue)*alpha,
+			}
+			setColor(current)
+		}
+	}
+}
+
+// watchSource sends the color of each image read from 'cfg.source' to 'colors'.
+// A single image file is only read once. A directory is polled for images that are
+// newer than the last one read. '-' reads a stream of PPM images from stdin, in
+// which case watchSource returns at the end of the stream.
+func watchSource(cfg ambientConfig, colors chan<- rgb, stop chan interface{}) error {
+	send := func(img image.Image) bool {
+		select {
+		case <-stop:
+			return false
+		case colors <- imageColor(img, cfg.method, cfg.weight):
+			return true
+		}
+	}
+
+	if cfg.source == "-" {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			img, err := decodePPM(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading PPM stream: %s", err)
+			}
+			if !send(img) {
+				return nil
+			}
+		}
+	}
+
+	info, err := os.Stat(cfg.source)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		img, err := readImage(cfg.source)
+		if err != nil {
+			return err
+		}
+		if send(img) {
+			<-stop
+		}
+		return nil
+	}
+
+	var lastMod time.Time
+	for {
+		path, mod, err := newestImage(cfg.source)
+		if err != nil {
+			return err
+		}
+		if path != "" && mod.After(lastMod) {
+			// A file that's still being written won't decode, it'll be tried again
+			// on the next poll.
+			if img, err := readImage(path); err == nil {
+				lastMod = mod
+				if !send(img) {
+					return nil
+				}
+			}
+		}
+		if !sleep(dirPollInterval, stop) {
+			return nil
+		}
+	}
+}
+
+// newestImage returns the path and modification time of the most recently modified
+// image in 'dir'. path is empty if there are no images in 'dir'.
+func newestImage(dir string) (path string, mod time.Time, err error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	for _, info := range infos {
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".ppm":
+		default:
+			continue
+		}
+		if !info.IsDir() && info.ModTime().After(mod) {
+			path, mod = filepath.Join(dir, info.Name()), info.ModTime()
+		}
+	}
+	return path, mod, nil
+}
+
+// readImage decodes the PNG, JPEG, GIF, or PPM image in the file at 'path'
+func readImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".ppm" {
+		return decodePPM(bufio.NewReader(f))
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", path, err)
+	}
+	return img, nil
+}
+
+// imageColor returns the color that best represents 'img'. The 'average' method
+// returns the weighted mean of all the sampled pixels. The 'dominant' method
+// groups the pixels into buckets of similar colors and returns the mean of the
+// heaviest bucket. Near black pixels, e.g., letterbox bars, are ignored by the
+// 'dominant' method since they'd otherwise usually win. 'weight' controls how
+// much each region of the image contributes, 'edges' favors the border of the
+// image, which suits a light mounted behind a screen, and 'center' favors the
+// middle of the image.
+func imageColor(img image.Image, method, weight string) rgb {
+	b := img.Bounds()
+	stepX, stepY := b.Dx()/maxSamples, b.Dy()/maxSamples
+	if stepX < 1 {
+		stepX = 1
+	}
+	if stepY < 1 {
+		stepY = 1
+	}
+
+	type bucket struct {
+		r, g, b, w float64
+	}
+	var total bucket
+	buckets := map[int]*bucket{}
+
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r16, g16, b16, _ := img.At(x, y).RGBA()
+			r, g, bl := float64(r16)/0xffff, float64(g16)/0xffff, float64(b16)/0xffff
+			w := regionWeight(x, y, b, weight)
+
+			if method == "dominant" {
+				if r+g+bl < 0.1 {
+					continue
+				}
+				// 8 levels per channel, 512 buckets
+				key := int(r*7.99)<<6 | int(g*7.99)<<3 | int(bl*7.99)
+				bk, ok := buckets[key]
+				if !ok {
+					bk = &bucket{}
+					buckets[key] = bk
+				}
+				bk.r, bk.g, bk.b, bk.w = bk.r+r*w, bk.g+g*w, bk.b+bl*w, bk.w+w
+				continue
+			}
+			total.r, total.g, total.b, total.w = total.r+r*w, total.g+g*w, total.b+bl*w, total.w+w
+		}
+	}
+
+	if method == "dominant" {
+		for _, bk := range buckets {
+			if bk.w > total.w {
+				total = *bk
+			}
+		}
+	}
+	if total.w == 0 {
+		return rgb{}
+	}
+	return rgb{red: total.r / total.w, green: total.g / total.w, blue: total.b / total.w}
+}
+
+// regionWeight returns how much the pixel at (x, y) contributes to the color of an
+// image with bounds 'b'.
+func regionWeight(x, y int, b image.Rectangle, weight string) float64 {
+	if weight == "uniform" {
+		return 1
+	}
+	// d is 0 at the center of the image and 1 at its edges
+	dx := math.Abs(float64(x-b.Min.X)/float64(b.Dx())*2 - 1)
+	dy := math.Abs(float64(y-b.Min.Y)/float64(b.Dy())*2 - 1)
+	d := math.Max(dx, dy)
+	if weight == "edges" {
+		return 0.1 + d*d
+	}
+	return 1.1 - d*d
+}
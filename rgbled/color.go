@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color temperatures outside of this range either can't be reproduced by an
+// RGB LED or aren't distinguishable from the range endpoints.
+const (
+	minKelvin = 1500
+	maxKelvin = 10000
+)
+
+// rgb represents a color with each channel normalized to the range 0.0 to 1.0.
+type rgb struct {
+	red, green, blue float64
+}
+
+// calibration holds per-channel gains. The red, green, and blue dies in an RGB
+// LED aren't equally bright for a given duty cycle (green is usually much brighter
+// than red), so without compensation "white" comes out with a blue-green tint.
+// A gain of 1.0 leaves the channel unchanged, lower values dim it.
+type calibration struct {
+	red, green, blue float64
+}
+
+// parseCalibration parses a calibration of the form "red,green,blue", e.g., "1.0,0.6,0.5".
+func parseCalibration(s string) (calibration, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return calibration{}, fmt.Errorf("calibration %q must have 3 comma separated values", s)
+	}
+	gains := make([]float64, 3)
+	for i, p := range parts {
+		g, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return calibration{}, fmt.Errorf("invalid calibration gain %q: %s", p, err)
+		}
+		if g < 0 || g > 1 {
+			return calibration{}, fmt.Errorf("calibration gain %q must be between 0.0 and 1.0", p)
+		}
+		gains[i] = g
+	}
+	return calibration{red: gains[0], green: gains[1], blue: gains[2]}, nil
+}
+
+// apply returns 'c' adjusted by the calibration gains and 'brightness' (0.0 to 1.0).
+func (cal calibration) apply(c rgb, brightness float64) rgb {
+	return rgb{
+		red:   clamp(c.red * cal.red * brightness),
+		green: clamp(c.green * cal.green * brightness),
+		blue:  clamp(c.blue * cal.blue * brightness),
+	}
+}
+
+// parseKelvin parses a color temperature such as "2700K" or "2700k". ok is false
+// if 's' isn't a color temperature at all.
+func parseKelvin(s string) (kelvin float64, ok bool, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasSuffix(s, "K") && !strings.HasSuffix(s, "k") {
+		return 0, false, nil
+	}
+	kelvin, err = strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid color temperature %q: %s", s, err)
+	}
+	if kelvin < minKelvin || kelvin > maxKelvin {
+		return 0, true, fmt.Errorf("color temperature %q must be between %dK and %dK", s, minKelvin, maxKelvin)
+	}
+	return kelvin, true, nil
+}
+
+// kelvinToRGB converts a color temperature to the color of a black body radiator
+// at that temperature. It uses Tanner Helland's curve fit of Mitchell Charity's
+// black body data, which is accurate to within a few percent over the supported
+// range and cheap enough to compute on every color change.
+func kelvinToRGB(kelvin float64) rgb {
+	kelvin = math.Max(minKelvin, math.Min(maxKelvin, kelvin))
+	t := kelvin / 100
+
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	return rgb{red: clamp(r / 255), green: clamp(g / 255), blue: clamp(b / 255)}
+}
+
+// clamp limits 'v' to the range 0.0 to 1.0
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fadeStep is how often the LED color is updated during a transition. 50 updates
+// per second is fast enough that the eye sees a smooth fade.
+const fadeStep = 20 * time.Millisecond
+
+// namedColors are the colors that can be referred to by name in a color spec
+var namedColors = map[string]rgb{
+	"off":     {0, 0, 0},
+	"black":   {0, 0, 0},
+	"white":   {1, 1, 1},
+	"red":     {1, 0, 0},
+	"green":   {0, 1, 0},
+	"blue":    {0, 0, 1},
+	"yellow":  {1, 1, 0},
+	"cyan":    {0, 1, 1},
+	"magenta": {1, 0, 1},
+	"orange":  {1, 0.5, 0},
+	"purple":  {0.5, 0, 1},
+}
+
+// scene is a single entry in a playlist. The LED fades from the previous scene's
+// color to 'color' over 'transition' and then holds 'color' for 'duration'.
+type scene struct {
+	color      rgb
+	duration   time.Duration
+	transition time.Duration
+}
+
+// parseColor parses a color spec. A color spec is one of:
+//   - a color name, e.g., 'orange' (see namedColors)
+//   - a color temperature, e.g., '2700K'
+//   - a hex color, e.g., '#ff8000'
+//   - comma separated red, green, and blue values from 0 to 1023, e.g., '1023,512,0'
+func parseColor(s string) (rgb, error) {
+	s = strings.TrimSpace(s)
+
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
+	kelvin, isKelvin, err := parseKelvin(s)
+	if err != nil {
+		return rgb{}, err
+	}
+	if isKelvin {
+		return kelvinToRGB(kelvin), nil
+	}
+
+	if strings.HasPrefix(s, "#") {
+		if len(s) != 7 {
+			return rgb{}, fmt.Errorf("hex color %q must have the form #rrggbb", s)
+		}
+		v, err := strconv.ParseUint(s[1:], 16, 32)
+		if err != nil {
+			return rgb{}, fmt.Errorf("invalid hex color %q: %s", s, err)
+		}
+		return rgb{
+			red:   float64(v>>16&0xff) / 255,
+			green: float64(v>>8&0xff) / 255,
+			blue:  float64(v&0xff) / 255,
+		}, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return rgb{}, fmt.Errorf("unrecognized color %q", s)
+	}
+	vals := make([]float64, 3)
+	max := float64(cycle - 1)
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > cycle-1 {
+			return rgb{}, fmt.Errorf("color value %q in %q must be an integer from 0 to %d", p, s, cycle-1)
+		}
+		vals[i] = float64(v) / max
+	}
+	return rgb{red: vals[0], green: vals[1], blue: vals[2]}, nil
+}
+
+// parsePlaylist reads a playlist. Each line has the form:
+//
+//	color duration [transition]
+//
+// where 'color' is a color spec (see parseColor) and 'duration' and the optional
+// 'transition' are Go durations, e.g., '1.5s' or '200ms'. Blank lines and lines
+// starting with '#' that don't start with a hex color are ignored. At least one
+// scene must take some time.
+func parsePlaylist(r io.Reader) ([]scene, error) {
+	scenes := []scene{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, "#") {
+			if _, err := parseColor(fields[0]); err != nil {
+				continue // comment
+			}
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected 'color duration [transition]', got %q", lineNum, line)
+		}
+
+		color, err := parseColor(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err)
+		}
+		duration, err := time.ParseDuration(fields[1])
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("line %d: invalid duration %q", lineNum, fields[1])
+		}
+		var transition time.Duration
+		if len(fields) == 3 {
+			transition, err = time.ParseDuration(fields[2])
+			if err != nil || transition < 0 {
+				return nil, fmt.Errorf("line %d: invalid transition %q", lineNum, fields[2])
+			}
+		}
+
+		scenes = append(scenes, scene{color: color, duration: duration, transition: transition})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(scenes) == 0 {
+		return nil, fmt.Errorf("playlist is empty")
+	}
+	// A playlist that doesn't take any time would keep a CPU busy when it's looped
+	// forever. A transition that's too short for an intermediate color doesn't take
+	// any time either, see fade.
+	for _, s := range scenes {
+		if s.duration > 0 || s.transition >= 2*fadeStep {
+			return scenes, nil
+		}
+	}
+	return nil, fmt.Errorf("playlist doesn't take any time, at least one scene needs a duration or a transition of at least %s", 2*fadeStep)
+}
+
+// playPlaylist plays 'scenes' in order 'loops' times, or forever if 'loops' is 0.
+// It returns early if the program is stopping.
+func playPlaylist(scenes []scene, loops int, stop chan interface{}) {
+	for i := 0; loops == 0 || i < loops; i++ {
+		for _, s := range scenes {
+			if !fade(currentColor, s.color, s.transition, stop) {
+				return
+			}
+			if !sleep(s.duration, stop) {
+				return
+			}
+		}
+	}
+}
+
+// fade changes the LED's color from 'from' to 'to' in equal steps over 'd'. It
+// returns false, leaving the LED at an intermediate color, if the program is stopping.
+func fade(from, to rgb, d time.Duration, stop chan interface{}) bool {
+	steps := int(d / fadeStep)
+	for i := 1; i < steps; i++ {
+		f := float64(i) / float64(steps)
+		setColor(rgb{
+			red:   from.red + (to.red-from.red)*f,
+			green: from.green + (to.green-from.green)*f,
+			blue:  from.blue + (to.blue-from.blue)*f,
+		})
+		if !sleep(fadeStep, stop) {
+			return false
+		}
+	}
+	setColor(to)
+	return true
+}
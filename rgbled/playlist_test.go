@@ -0,0 +1,131 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    rgb
+		wantErr string
+	}{
+		{s: "orange", want: rgb{1, 0.5, 0}},
+		{s: " Purple ", want: rgb{0.5, 0, 1}},
+		{s: "off", want: rgb{0, 0, 0}},
+		{s: "#ff8000", want: rgb{1, 128.0 / 255, 0}},
+		{s: "#00FF00", want: rgb{0, 1, 0}},
+		{s: "1023,0,512", want: rgb{1, 0, 512.0 / 1023}},
+		{s: "0, 1023 ,0", want: rgb{0, 1, 0}},
+		{s: "6500K", want: kelvinToRGB(6500)},
+		{s: "2700k", want: kelvinToRGB(2700)},
+		{s: "mauve", wantErr: "unrecognized color"},
+		{s: "", wantErr: "unrecognized color"},
+		{s: "#ff80", wantErr: "must have the form #rrggbb"},
+		{s: "#ff80001", wantErr: "must have the form #rrggbb"},
+		{s: "#gg8000", wantErr: "invalid hex color"},
+		{s: "1023,0", wantErr: "unrecognized color"},
+		{s: "1023,0,0,0", wantErr: "unrecognized color"},
+		{s: "1024,0,0", wantErr: "must be an integer from 0 to 1023"},
+		{s: "-1,0,0", wantErr: "must be an integer from 0 to 1023"},
+		{s: "0.5,0,0", wantErr: "must be an integer from 0 to 1023"},
+		{s: "1000K", wantErr: "must be between 1500K and 10000K"},
+		{s: "warmK", wantErr: "invalid color temperature"},
+	}
+
+	for _, tc := range tests {
+		got, err := parseColor(tc.s)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q: got error %v, want one containing %q", tc.s, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tc.s, err)
+			continue
+		}
+		if math.Abs(got.red-tc.want.red) > 1e-9 || math.Abs(got.green-tc.want.green) > 1e-9 || math.Abs(got.blue-tc.want.blue) > 1e-9 {
+			t.Errorf("%q: got %+v, want %+v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		want    []scene
+		wantErr string
+	}{
+		{
+			name:  "scenes",
+			lines: []string{"red 1s", "blue 500ms 2s", "0,0,1023 0s 1m"},
+			want: []scene{
+				{color: rgb{1, 0, 0}, duration: time.Second},
+				{color: rgb{0, 0, 1}, duration: 500 * time.Millisecond, transition: 2 * time.Second},
+				{color: rgb{0, 0, 1}, transition: time.Minute},
+			},
+		},
+		{
+			name:  "comments and blank lines",
+			lines: []string{"# sunrise", "", "#", "  # dim red", "  red 1s  ", "#not a color 1s", "\t"},
+			want:  []scene{{color: rgb{1, 0, 0}, duration: time.Second}},
+		},
+		{
+			// A line starting with a hex color is a scene, not a comment
+			name:  "hex colors",
+			lines: []string{"# white", "#ffffff 1s 100ms"},
+			want:  []scene{{color: rgb{1, 1, 1}, duration: time.Second, transition: 100 * time.Millisecond}},
+		},
+		{
+			name:  "only a transition",
+			lines: []string{"red 0s 40ms", "blue 0s"},
+			want:  []scene{{color: rgb{1, 0, 0}, transition: 2 * fadeStep}, {color: rgb{0, 0, 1}}},
+		},
+		{name: "empty", lines: nil, wantErr: "playlist is empty"},
+		{name: "only comments", lines: []string{"# nothing", ""}, wantErr: "playlist is empty"},
+		{name: "no duration", lines: []string{"red 1s", "blue"}, wantErr: "line 2: expected 'color duration [transition]'"},
+		{name: "too many fields", lines: []string{"red 1s 1s 1s"}, wantErr: "line 1: expected"},
+		{name: "hex color with a comment", lines: []string{"#ff0000 1s red"}, wantErr: "line 1: invalid transition"},
+		{name: "bad color", lines: []string{"# a comment", "mauve 1s"}, wantErr: "line 2: unrecognized color"},
+		{name: "bad duration", lines: []string{"red 1"}, wantErr: "line 1: invalid duration \"1\""},
+		{name: "negative duration", lines: []string{"red -1s"}, wantErr: "line 1: invalid duration \"-1s\""},
+		{name: "bad transition", lines: []string{"red 1s soon"}, wantErr: "line 1: invalid transition \"soon\""},
+		{name: "negative transition", lines: []string{"red 1s -5ms"}, wantErr: "line 1: invalid transition \"-5ms\""},
+		{name: "no time", lines: []string{"red 0s", "blue 0ms"}, wantErr: "playlist doesn't take any time"},
+		{
+			// A transition shorter than two fade steps has no intermediate colors
+			name:    "transitions too short to fade",
+			lines:   []string{"red 0s 39ms", "blue 0s 20ms"},
+			wantErr: "playlist doesn't take any time",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scenes, err := parsePlaylist(strings.NewReader(strings.Join(tc.lines, "\n")))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if !reflect.DeepEqual(scenes, tc.want) {
+				t.Errorf("got scenes %+v, want %+v", scenes, tc.want)
+			}
+		})
+	}
+}
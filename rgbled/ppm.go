@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// maxPPMSize is the largest width or height accepted by decodePPM, the image is
+// allocated before its pixels are read so a corrupt header could otherwise ask for
+// more memory than there is
+const maxPPMSize = 4096
+
+// maxPPMToken is the longest token accepted in a PPM header, which only holds the
+// magic number and decimal numbers, so a corrupt header isn't read into memory
+const maxPPMToken = 16
+
+// decodePPM reads a single binary (P6) or plain (P3) PPM image from 'r'. PPM images
+// have no end marker, so a stream of frames is simply one image after another,
+// which is what tools like ffmpeg produce with '-f image2pipe -vcodec ppm'. io.EOF
+// is returned if 'r' is at the end of the stream before the image starts.
+func decodePPM(r *bufio.Reader) (image.Image, error) {
+	magic, err := ppmToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if magic != "P6" && magic != "P3" {
+		return nil, fmt.Errorf("unsupported PPM format %q, expected P6 or P3", magic)
+	}
+
+	header := make([]int, 3) // width, height, maxval
+	for i := range header {
+		tok, err := ppmToken(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if header[i], err = strconv.Atoi(tok); err != nil || header[i] <= 0 {
+			return nil, fmt.Errorf("invalid PPM header value %q", tok)
+		}
+	}
+	width, height, maxval := header[0], header[1], header[2]
+	if maxval > 65535 {
+		return nil, fmt.Errorf("invalid PPM maxval %d", maxval)
+	}
+	if width > maxPPMSize || height > maxPPMSize {
+		return nil, fmt.Errorf("PPM image is %dx%d, it can't be larger than %dx%d", width, height, maxPPMSize, maxPPMSize)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	sample := func() (uint8, error) {
+		var v int
+		switch {
+		case magic == "P3":
+			tok, err := ppmToken(r)
+			if err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			if v, err = strconv.Atoi(tok); err != nil {
+				return 0, fmt.Errorf("invalid PPM sample %q", tok)
+			}
+		case maxval < 256:
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			v = int(b)
+		default:
+			var b [2]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			v = int(b[0])<<8 | int(b[1])
+		}
+		if v < 0 || v > maxval {
+			return 0, fmt.Errorf("invalid PPM sample %d, must be 0 thru %d", v, maxval)
+		}
+		return uint8(v * 255 / maxval), nil
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var px [3]uint8
+			for i := range px {
+				if px[i], err = sample(); err != nil {
+					return nil, err
+				}
+			}
+			img.SetRGBA(x, y, color.RGBA{R: px[0], G: px[1], B: px[2], A: 0xff})
+		}
+	}
+
+	return img, nil
+}
+
+// ppmToken returns the next whitespace delimited token in a PPM header. Comments
+// run from '#' to the end of the line. For P6 images exactly one whitespace
+// character separates the header from the pixel data, so that's all that's consumed
+// after the last token. Comments are skipped without being kept, and tokens can't be
+// longer than maxPPMToken.
+func ppmToken(r *bufio.Reader) (string, error) {
+	tok := []byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(tok) > 0 {
+				return string(tok), nil
+			}
+			return "", err
+		}
+		switch {
+		case b == '#' && len(tok) == 0:
+			if err := skipLine(r); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if len(tok) > 0 {
+				return string(tok), nil
+			}
+		case len(tok) == maxPPMToken:
+			return "", fmt.Errorf("invalid PPM header, %q... is longer than %d characters", tok, maxPPMToken)
+		default:
+			tok = append(tok, b)
+		}
+	}
+}
+
+// skipLine reads up to and including the next newline
+func skipLine(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			return nil
+		}
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
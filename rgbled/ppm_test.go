@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodePPM(t *testing.T) {
+	// The images are 2x1, an orange pixel followed by a dark blue one
+	want := []color.RGBA{{R: 255, G: 128, B: 0, A: 255}, {R: 0, G: 0, B: 64, A: 255}}
+
+	tests := []struct {
+		name    string
+		data    string
+		pixels  []color.RGBA // 'want' if not set
+		wantErr string
+	}{
+		{name: "P6", data: "P6 2 1 255\n\xff\x80\x00\x00\x00\x40"},
+		{name: "P3", data: "P3\n2 1\n255\n255 128 0\n0 0 64\n"},
+		{name: "P3 without a final newline", data: "P3 2 1 255 255 128 0 0 0 64"},
+		{name: "comments", data: "# made by hand\nP6 # binary\n2 # wide\n1\n# the maxval's next\n255\n\xff\x80\x00\x00\x00\x40"},
+		{
+			name:   "P6 data that looks like whitespace and comments",
+			data:   "P6 2 1 255\n#\n \t\r#",
+			pixels: []color.RGBA{{R: '#', G: '\n', B: ' ', A: 255}, {R: '\t', G: '\r', B: '#', A: 255}},
+		},
+		{
+			name:   "maxval 15",
+			data:   "P3 2 1 15 15 8 0 0 0 4",
+			pixels: []color.RGBA{{R: 255, G: 136, B: 0, A: 255}, {R: 0, G: 0, B: 68, A: 255}},
+		},
+		{name: "16 bit samples", data: "P6 2 1 65535\n\xff\xff\x80\x80\x00\x00\x00\x00\x00\x00\x40\x40"},
+		{name: "16 bit plain samples", data: "P3 2 1 65535 65535 32896 0 0 0 16448"},
+		{name: "P5", data: "P5 2 1 255\n\xff\x00", wantErr: "unsupported PPM format \"P5\""},
+		{name: "not a PPM", data: "GIF89a", wantErr: "unsupported PPM format"},
+		{name: "no width", data: "P6 x 1 255\n", wantErr: "invalid PPM header value \"x\""},
+		{name: "zero height", data: "P6 2 0 255\n", wantErr: "invalid PPM header value \"0\""},
+		{name: "negative maxval", data: "P6 2 1 -255\n", wantErr: "invalid PPM header value \"-255\""},
+		{name: "maxval too big", data: "P6 2 1 65536\n", wantErr: "invalid PPM maxval 65536"},
+		{name: "too wide", data: "P6 4097 1 255\n", wantErr: "can't be larger than 4096x4096"},
+		{name: "too high", data: "P6 1 100000000 255\n", wantErr: "can't be larger than 4096x4096"},
+		{name: "overflowing size", data: "P6 99999999999999999999 1 255\n", wantErr: "longer than 16 characters"},
+		{name: "long header token", data: "P6 " + strings.Repeat("9", 1<<20) + " 1 255\n", wantErr: "longer than 16 characters"},
+		{name: "long magic number", data: strings.Repeat("P", 1<<20), wantErr: "longer than 16 characters"},
+		{name: "truncated header", data: "P6 2 1", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated P6 data", data: "P6 2 1 255\n\xff\x80\x00\x00", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated 16 bit data", data: "P6 2 1 65535\n\xff\xff\x80\x80\x00\x00\x00\x00\x00\x00\x40", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated P3 data", data: "P3 2 1 255 255 128 0 0 0", wantErr: io.ErrUnexpectedEOF.Error()},
+		{name: "P3 sample above maxval", data: "P3 2 1 15 16 8 0 0 0 4", wantErr: "invalid PPM sample 16, must be 0 thru 15"},
+		{name: "P6 sample above maxval", data: "P6 2 1 100\n\x65\x00\x00\x00\x00\x00", wantErr: "invalid PPM sample 101, must be 0 thru 100"},
+		{name: "P3 sample not a number", data: "P3 2 1 255 255 x 0 0 0 64", wantErr: "invalid PPM sample \"x\""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := decodePPM(bufio.NewReader(strings.NewReader(tc.data)))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if b := img.Bounds(); b != image.Rect(0, 0, 2, 1) {
+				t.Fatalf("got a %s image, want 2x1", b.Size())
+			}
+			pixels := tc.pixels
+			if pixels == nil {
+				pixels = want
+			}
+			for x, c := range pixels {
+				if got := img.(*image.RGBA).RGBAAt(x, 0); got != c {
+					t.Errorf("pixel %d: got %v, want %v", x, got, c)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodePPMStream(t *testing.T) {
+	// Frames are one image after another
+	r := bufio.NewReader(strings.NewReader("P6 1 1 255\n\x01\x02\x03P3 1 1 255 4 5 6\n"))
+	for i, want := range []color.RGBA{{1, 2, 3, 255}, {4, 5, 6, 255}} {
+		img, err := decodePPM(r)
+		if err != nil {
+			t.Fatalf("frame %d: %s", i, err)
+		}
+		if got := img.(*image.RGBA).RGBAAt(0, 0); got != want {
+			t.Errorf("frame %d: got %v, want %v", i, got, want)
+		}
+	}
+	if _, err := decodePPM(r); err != io.EOF {
+		t.Errorf("got %v at the end of the stream, want io.EOF", err)
+	}
+}
@@ -10,27 +10,117 @@
 // be set, but the dependent pins won't always be set correctly. This could be a result of timing issues
 // that affect the ordering of when signals are sent to pins on the same channel.
 //
+// White can also be set by color temperature, e.g., entering '2700K' at the red value
+// prompt sets the LED to a warm white. The '-cal' flag balances the 3 channels so that
+// color temperatures look right on a particular LED, and '-brightness' dims all colors.
+//
+// The Go and C programs don't agree on how the LED is wired. This program defaults to a common
+// cathode LED (HIGH is on), use '-polarity=anode' for a common anode LED (LOW is on). All colors,
+// including "off", are the same for both types of LED.
+//
+// Besides the interactive prompts, the color can be set from the command line with
+// '-color' (the LED is left on) or '-off', and a playlist file of 'color duration [transition]'
+// lines can be played with '-playlist', e.g.:
+//
+//	# warm sunrise
+//	2200K  10s  5s
+//	#ff8000 2s  500ms
+//	white  30s  10s
+//
+// '-ambient' turns the LED into a bias light. It follows the color of an image, the newest
+// image in a directory, or a stream of PPM frames on stdin, e.g.:
+//
+//	ffmpeg -i movie.mp4 -vf fps=10,scale=64:-1 -f image2pipe -vcodec ppm - | go run *.go -ambient=- -ambient-weight=edges
+//
+// On exit, whether from 'q', end of input on stdin, or SIGINT/SIGTERM/SIGHUP, the LED
+// fades to off and its pins are released. '-color' is the exception, it leaves the LED lit.
+//
+// '-backend=sim' runs the program on a simulated Raspberry Pi and '-backend=fake' records
+// what the program does, the pins' final state is printed on exit.
+//
+// Run using 'go run *.go -brightness=0.5 -cal=1.0,0.6,0.5'
+// or 'go run *.go -color=2700K', or 'go run *.go -playlist=scenes.txt -loops=3'
+//
 
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
+	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 var (
-	ledPinRed   = rpio.Pin(19)
-	ledPinGreen = rpio.Pin(18)
-	ledPinBlue  = rpio.Pin(13)
+	// board is the Raspberry Pi, or a fake or simulated one, the LED is connected to
+	board gpio.Board
+
+	// The LED's pins, BCM pins 19, 18, and 13, set by initPins
+	ledPinRed   gpio.PWMPin
+	ledPinGreen gpio.PWMPin
+	ledPinBlue  gpio.PWMPin
 	freq        = 100000
 	cycle       = 1024
+
+	// brightness and cal are applied to every color before it's written to the LED
+	brightness = 1.0
+	cal        = calibration{red: 1.0, green: 1.0, blue: 1.0}
+
+	ledPolarity = commonCathode
+
+	// currentColor is the color most recently set by setColor
+	currentColor rgb
 )
 
+// polarity describes how an RGB LED is wired. A common cathode LED shares a ground
+// pin and each color lights up when its GPIO pin is HIGH. A common anode LED shares
+// a 3.3V pin and each color lights up when its GPIO pin is LOW, so its duty cycles
+// must be inverted.
+type polarity int
+
+const (
+	commonCathode polarity = iota
+	commonAnode
+)
+
+// parsePolarity converts the '-polarity' flag value to a polarity
+func parsePolarity(s string) (polarity, error) {
+	switch s {
+	case "cathode":
+		return commonCathode, nil
+	case "anode":
+		return commonAnode, nil
+	default:
+		return commonCathode, fmt.Errorf("invalid polarity %q, must be 'cathode' or 'anode'", s)
+	}
+}
+
+// duty returns the duty length that results in a brightness of 'val' (0 to cycle-1)
+// for the LED's polarity. A common anode LED with a duty length equal to the cycle
+// length is held HIGH for the entire cycle, i.e., it's fully off.
+func duty(val uint32) uint32 {
+	if val > uint32(cycle-1) {
+		val = uint32(cycle - 1)
+	}
+	if ledPolarity == commonAnode {
+		return uint32(cycle) - val
+	}
+	return val
+}
+
+// setColor sets the LED to 'c' after adjusting it for brightness and the channel calibration.
+func setColor(c rgb) {
+	currentColor = c
+	c = cal.apply(c, brightness)
+	max := float64(cycle - 1)
+	ledColorSet(uint32(c.red*max+0.5), uint32(c.green*max+0.5), uint32(c.blue*max+0.5))
+}
+
 func ledColorSet(redVal, greenVal, blueVal uint32) {
 	// This doesn't work as expected because GPIO pins 19 & 13 are essentially linked. This
 	// is also true for GPIO pins 18 & 12, but since pin 12 isn't used here pin 18, green,
@@ -39,13 +129,13 @@ func ledColorSet(redVal, greenVal, blueVal uint32) {
 	// is 255, both the red and blue leds will light up (purple).
 	//
 	// Uncomment these lines if you want to see this behavior.
-	ledPinRed.Mode(rpio.Pwm)
-	ledPinGreen.Mode(rpio.Pwm)
-	ledPinBlue.Mode(rpio.Pwm)
+	ledPinRed.Mode(gpio.PWM)
+	ledPinGreen.Mode(gpio.PWM)
+	ledPinBlue.Mode(gpio.PWM)
 
-	ledPinRed.DutyCycle(redVal, uint32(cycle))
-	ledPinGreen.DutyCycle(greenVal, uint32(cycle))
-	ledPinBlue.DutyCycle(blueVal, uint32(cycle))
+	ledPinRed.DutyCycle(duty(redVal), uint32(cycle))
+	ledPinGreen.DutyCycle(duty(greenVal), uint32(cycle))
+	ledPinBlue.DutyCycle(duty(blueVal), uint32(cycle))
 
 	// Given the explanation above, a workaround is to set only accept a redVal of
 	// 255. When this is the case the blue and green pins are changed to output mode
@@ -57,103 +147,226 @@ func ledColorSet(redVal, greenVal, blueVal uint32) {
 	//
 	// Comment these lines if you don't want to see this behavior.
 	//	if redVal == 255 {
-	//		ledPinRed.Mode(rpio.Pwm)
+	//		ledPinRed.Mode(gpio.PWM)
 	//		ledPinRed.DutyCycle(redVal, cycle)
 	//
-	//		//ledPinGreen.Mode(rpio.Output)
+	//		//ledPinGreen.Mode(gpio.Output)
 	//		ledPinGreen.DutyCycle(greenVal, cycl)
-	//		ledPinBlue.Mode(rpio.Output)
+	//		ledPinBlue.Mode(gpio.Output)
 	//		ledPinBlue.Low()
 	//	} else {
-	//		ledPinRed.Mode(rpio.Output)
+	//		ledPinRed.Mode(gpio.Output)
 	//		ledPinRed.Low()
 	//
-	//		ledPinGreen.Mode(rpio.Pwm)
-	//		ledPinBlue.Mode(rpio.Pwm)
+	//		ledPinGreen.Mode(gpio.PWM)
+	//		ledPinBlue.Mode(gpio.PWM)
 	//		ledPinGreen.DutyCycle(greenVal, cycle)
 	//		ledPinBlue.DutyCycle(blueVal, cycle)
 	//	}
 }
 
+// initPins gets the LED's pins from 'board'
+func initPins() error {
+	var err error
+	if ledPinRed, err = board.PWMPin(19); err != nil {
+		return err
+	}
+	if ledPinGreen, err = board.PWMPin(18); err != nil {
+		return err
+	}
+	ledPinBlue, err = board.PWMPin(13)
+	return err
+}
+
+// ledInit puts the LED pins in PWM mode with the LED turned off
 func ledInit() {
-	ledPinRed.Mode(rpio.Pwm)
+	ledPinRed.Mode(gpio.PWM)
 	ledPinRed.Freq(freq)
-	ledPinRed.DutyCycle(0, uint32(cycle))
+	ledPinRed.DutyCycle(duty(0), uint32(cycle))
 
-	ledPinGreen.Mode(rpio.Pwm)
+	ledPinGreen.Mode(gpio.PWM)
 	ledPinGreen.Freq(freq)
-	ledPinGreen.DutyCycle(1, uint32(cycle))
+	ledPinGreen.DutyCycle(duty(0), uint32(cycle))
 
-	ledPinBlue.Mode(rpio.Pwm)
+	ledPinBlue.Mode(gpio.PWM)
 	ledPinBlue.Freq(freq)
-	ledPinBlue.DutyCycle(1023, uint32(cycle))
+	ledPinBlue.DutyCycle(duty(0), uint32(cycle))
 }
 
 func main() {
-	if err := rpio.Open(); err != nil {
+	var (
+		calStr       string
+		polarityStr  string
+		colorStr     string
+		off          bool
+		playlistFile string
+		loops        int
+		ambientCfg   ambientConfig
+		backend      string
+	)
+	flag.StringVar(&backend, "backend", "rpio", "how the LED's pins are driven, 'rpio' (the go-rpio library), 'fake', or 'sim'")
+	flag.StringVar(&colorStr, "color", "", "set the LED to this color and exit, e.g., 'orange', '2700K', '#ff8000', or '1023,512,0'")
+	flag.BoolVar(&off, "off", false, "turn the LED off and exit")
+	flag.StringVar(&playlistFile, "playlist", "", "play the colors in this playlist file, one 'color duration [transition]' per line")
+	flag.IntVar(&loops, "loops", 0, "number of times to play the playlist, 0 to play it forever")
+	flag.StringVar(&ambientCfg.source, "ambient", "", "set the LED to the color of an image file, the newest image in a directory, or '-' for a stream of PPM images on stdin")
+	flag.StringVar(&ambientCfg.method, "ambient-method", "average", "how an image's color is chosen, 'average' or 'dominant'")
+	flag.StringVar(&ambientCfg.weight, "ambient-weight", "uniform", "image region that contributes most to its color, 'uniform', 'edges', or 'center'")
+	flag.Float64Var(&ambientCfg.rate, "ambient-rate", 30, "ambient LED updates per second")
+	flag.DurationVar(&ambientCfg.smoothing, "ambient-smoothing", 300*time.Millisecond, "how quickly the LED follows ambient color changes, 0 for no smoothing")
+	flag.StringVar(&polarityStr, "polarity", "cathode", "LED type, common 'cathode' or common 'anode'")
+	flag.Float64Var(&brightness, "brightness", 1.0, "LED brightness, 0.0 (off) to 1.0 (full)")
+	flag.StringVar(&calStr, "cal", "1.0,1.0,1.0", "red,green,blue channel gains (0.0 to 1.0) used to balance the LED's colors")
+	flag.Parse()
+
+	if brightness < 0 || brightness > 1 {
+		fmt.Printf("Brightness must be between 0.0 and 1.0, got %f\n", brightness)
+		os.Exit(1)
+	}
+	var err error
+	if cal, err = parseCalibration(calStr); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if ledPolarity, err = parsePolarity(polarityStr); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer rpio.Close()
-
-	ledInit()
-
-	reader := bufio.NewReader(os.Stdin)
 
-	for {
-		//
-		// Get RGB values
-		//
-		fmt.Println("Enter red value (0 to 1023):")
-		red, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error reading from StdIn, %s", err)
+	var color rgb
+	if colorStr != "" {
+		if color, err = parseColor(colorStr); err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
-		red = strings.TrimSuffix(red, "\n")
-
-		fmt.Println("Enter green value (0 to 1023):")
-		green, err := reader.ReadString('\n')
+	}
+	if ambientCfg.source != "" {
+		if err := ambientCfg.validate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	var scenes []scene
+	if playlistFile != "" {
+		f, err := os.Open(playlistFile)
 		if err != nil {
-			fmt.Printf("Error reading from StdIn, %s", err)
+			fmt.Println(err)
 			os.Exit(1)
 		}
-		green = strings.TrimSuffix(green, "\n")
-
-		fmt.Println("Enter blue value (0 to 1023):")
-		blue, err := reader.ReadString('\n')
+		scenes, err = parsePlaylist(f)
+		f.Close()
 		if err != nil {
-			fmt.Printf("Error reading from StdIn, %s", err)
+			fmt.Printf("Error reading playlist %s: %s\n", playlistFile, err)
 			os.Exit(1)
 		}
-		blue = strings.TrimSuffix(blue, "\n")
+	}
+
+	if board, err = gpio.Open(backend, ""); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := initPins(); err != nil {
+		fmt.Println(err)
+		board.Close()
+		os.Exit(1)
+	}
+
+	ledInit()
+
+	// stop channel is used to synchronize exiting the
+	// program so that the board is reset to the state
+	// it was in prior to the program starting.
+	stop := make(chan interface{})
 
-		fmt.Printf("You entered red: %s, green: %s, blue: %s\n", red, green, blue)
+	// sigs is the channel used by Go's signals capability
+	// to notify the program that a signal has been raised.
+	// SIGKILL can't be caught so it isn't included.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go signalHandler(sigs, stop)
 
+	//
+	// Non-interactive modes. The PWM hardware keeps running after the program exits,
+	// so a color set with '-color' stays lit until changed.
+	//
+	switch {
+	case off:
+	case colorStr != "":
+		setColor(color)
+		gpio.Report(os.Stdout, board)
+		board.Close()
+		return
+	case playlistFile != "":
+		playPlaylist(scenes, loops, stop)
+	case ambientCfg.source != "":
+		ambient(ambientCfg, stop)
+	default:
+		interactive(readLines(os.Stdin), stop)
+	}
+
+	// The LED is turned off and the pins are reset whether the program ended
+	// normally, stdin was closed, or a signal was received.
+	shutdown()
+}
+
+// interactive prompts for colors until the user quits, stdin is closed, or the
+// program is stopped.
+func interactive(lines <-chan string, stop chan interface{}) {
+	for {
 		//
-		// Convert string RGB values to int
+		// Get RGB values
 		//
-		blueNum, _ := strconv.Atoi(blue)
-		redNum, _ := strconv.Atoi(red)
-		greenNum, _ := strconv.Atoi(green)
-		fmt.Printf("red: %x, green: %x, blue: %x\n", redNum, greenNum, blueNum)
+		red, ok := prompt("Enter red value (0 to 1023), or a color temperature (1500K to 10000K):", lines, stop)
+		if !ok {
+			return
+		}
 
 		//
-		// Set LED color
+		// A color temperature sets all 3 channels at once
 		//
-		ledColorSet(uint32(redNum), uint32(greenNum), uint32(blueNum))
+		kelvin, isKelvin, err := parseKelvin(red)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if isKelvin {
+			c := kelvinToRGB(kelvin)
+			fmt.Printf("Color temperature %.0fK is red: %.3f, green: %.3f, blue: %.3f\n", kelvin, c.red, c.green, c.blue)
+			setColor(c)
+		} else {
+			green, ok := prompt("Enter green value (0 to 1023):", lines, stop)
+			if !ok {
+				return
+			}
+
+			blue, ok := prompt("Enter blue value (0 to 1023):", lines, stop)
+			if !ok {
+				return
+			}
+
+			fmt.Printf("You entered red: %s, green: %s, blue: %s\n", red, green, blue)
+
+			//
+			// Convert string RGB values to int
+			//
+			blueNum, _ := strconv.Atoi(blue)
+			redNum, _ := strconv.Atoi(red)
+			greenNum, _ := strconv.Atoi(green)
+			fmt.Printf("red: %x, green: %x, blue: %x\n", redNum, greenNum, blueNum)
+
+			//
+			// Set LED color
+			//
+			max := float64(cycle - 1)
+			setColor(rgb{red: float64(redNum) / max, green: float64(greenNum) / max, blue: float64(blueNum) / max})
+		}
 
 		//
 		// Quit?
 		//
-		fmt.Printf("Enter 'q' to quit\n")
-		quit, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error reading from StdIn, %s, err")
-			os.Exit(1)
-		}
-		if quit == "q\n" {
-			ledColorSet(0, 0, 0)
-			break
+		quit, ok := prompt("Enter 'q' to quit", lines, stop)
+		if !ok || quit == "q" {
+			return
 		}
 	}
 }
@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/youngkin/gpio/gpio"
+)
+
+// shutdownFade is how long it takes the LED to fade to off when the program exits
+const shutdownFade = 500 * time.Millisecond
+
+// signalHandler notifies all listeners on 'stop' that the program is stopping when
+// a signal is received. Unlike the other demos it doesn't reset the board and exit
+// itself. The main goroutine may be in the middle of changing the LED's color so
+// it's left to main to turn the LED off and release the pins.
+func signalHandler(sigs chan os.Signal, stop chan interface{}) {
+	sig := <-sigs
+	fmt.Printf("\nReceived %s, exiting...\n", sig)
+	close(stop)
+}
+
+// readLines sends each line read from 'r', without its trailing newline, to the
+// returned channel. The channel is closed when 'r' reaches EOF or an error occurs.
+// Reading in a separate goroutine allows the main goroutine to wait for input and
+// a stop notification at the same time.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					fmt.Printf("Error reading from StdIn, %s\n", err)
+				}
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+	return lines
+}
+
+// prompt prints 'msg' and waits for the next line of input. ok is false if
+// stdin was closed or the program is stopping.
+func prompt(msg string, lines <-chan string, stop chan interface{}) (line string, ok bool) {
+	fmt.Println(msg)
+	select {
+	case <-stop:
+		return "", false
+	case line, ok = <-lines:
+		return line, ok
+	}
+}
+
+// sleep pauses for 'd' and returns true, or returns false as soon as the program is stopping.
+func sleep(d time.Duration, stop chan interface{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// shutdown fades the LED to off and returns the LED pins to the state they were in
+// before the program started. For a common cathode LED that's OUTPUT and LOW. A
+// common anode LED would light up if its pins were LOW, so its pins are returned
+// to INPUT mode instead, which leaves them floating and the LED off.
+func shutdown() {
+	fade(currentColor, rgb{}, shutdownFade, nil)
+
+	for _, pin := range []gpio.PWMPin{ledPinRed, ledPinGreen, ledPinBlue} {
+		if ledPolarity == commonAnode {
+			pin.Input()
+			continue
+		}
+		pin.Output()
+		pin.Low()
+	}
+
+	// Release the board's resources, e.g., the rpio library's, a fake or
+	// simulated board reports the pins' final state first
+	gpio.Report(os.Stdout, board)
+	if err := board.Close(); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -8,10 +8,24 @@
 //
 // Run: go run sevensegdisplay.go
 //
+// '-backend=cdev' drives the shift register through the GPIO character device, '-chip',
+// instead of the go-rpio library, e.g., 'go run sevensegdisplay.go -backend=cdev'.
+// '-backend=fake' and '-backend=sim' run the program without a Raspberry Pi.
+//
+// '-trace=file.vcd' saves a trace of every pin write on exit, e.g., to examine the
+// SER, SRCLK, and RCLK sequence in GTKWave or PulseView. Any other file extension
+// saves the trace as a text log, which can be compared with another run's.
+//
+// The pins can be claimed in a file shared with the other demos, '-claims' or $GPIO_CLAIMS,
+// e.g., /run/lock/gpio-claims, so that running this program at the same time as one using
+// any of the same pins fails. The claims aren't shared by default. BCM 19 is a PWM pin,
+// sharing PWM channel 1 with BCM 13, it's used here as a GPIO pin.
+//
 package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -19,7 +33,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/stianeikeland/go-rpio/v4"
+	"github.com/youngkin/gpio/gpio"
 )
 
 // segcode contains the hexidecimal codes that will be left-shifted into the shift register. They
@@ -28,20 +42,65 @@ var segcode = []int{0x3f, 0x06, 0x5b, 0x4f, 0x66, 0x6d, 0x7d, 0x07, 0x7f, 0x6f,
 	0x7c, 0x39, 0x5e, 0x79, 0x71, 0x80}
 
 func main() {
-	// Initialize the go-rpio library, exiting if there's a problem.
-	if err := rpio.Open(); err != nil {
+	backend := flag.String("backend", "rpio", "how the pins are driven, 'rpio' (the go-rpio library), 'cdev' (the GPIO character device), 'fake', or 'sim'")
+	chipName := flag.String("chip", "gpiochip0", "GPIO character device used by '-backend=cdev'")
+	tracePath := flag.String("trace", "", "file the pin writes are traced to, a VCD file if it ends in '.vcd', a text log otherwise")
+	claimFile := flag.String("claims", gpio.ClaimsFile(), "file the pins are claimed in, shared with other programs so that conflicting uses are caught, defaults to $GPIO_CLAIMS, '' to not share the claims")
+	flag.Parse()
+
+	// A fake board's pins aren't real so its claims aren't shared
+	if *backend == "fake" {
+		*claimFile = ""
+	}
+	claims, err := gpio.OpenRegistry(*claimFile)
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
+	}
+	for _, w := range claims.Warnings() {
+		fmt.Printf("Warning: %s\n", w)
+	}
 
+	// Open the board, e.g., initialize the go-rpio library, exiting if there's a problem.
+	board, err := gpio.Open(*backend, *chipName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var trace *gpio.Trace
+	if *tracePath != "" {
+		trace = gpio.NewTrace(board)
+		board = trace
 	}
-	// Release go-rpio resources prior to exiting program
-	defer rpio.Close()
+	// release releases the board's resources, a fake or simulated board reports
+	// the pins' final state first
+	release := func() {
+		if trace != nil {
+			if err := trace.Save(*tracePath); err != nil {
+				fmt.Println(err)
+			}
+		}
+		gpio.Report(os.Stdout, board)
+		if err := board.Close(); err != nil {
+			fmt.Println(err)
+		}
+		if err := claims.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	// Release the board's resources prior to exiting program
+	defer release()
 
 	// sdiPin   => Serial data input pin (aka SER or DS)
 	// rclkPin  => Output Register Clock/Latch pin (st_cp)
 	// srclkPin => Shift Register Clock pin (sh_cp)
 	// srclrPin => Shift Register Clear pin
 	// oePin    => Output Enable Pin
-	sdiPin, rclkPin, srclkPin, srclrPin, oePin := initShiftRegister()
+	sdiPin, rclkPin, srclkPin, srclrPin, oePin, err := initShiftRegister(board, claims)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// stop channel is used to synchronize exiting the
 	// program so that the board is reset to the state
@@ -50,13 +109,13 @@ func main() {
 
 	// sigs is the channel used by Go's signals capability
 	// to notify the program that a signal has been raised.
-	sigs := make(chan os.Signal)
+	sigs := make(chan os.Signal, 1)
 
 	// signal.Notify() registers the program's interest
 	// in receiving signals and provides the channel used
 	// to send signals to the program.
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGKILL)
-	go signalHandler(sigs, stop, rclkPin, srclrPin)
+	go signalHandler(sigs, stop, rclkPin, srclrPin, release)
 
 	reader := bufio.NewReader(os.Stdin)
 	for {
@@ -111,6 +170,7 @@ func main() {
 				break
 			case "q":
 				fmt.Println("Goodbye!")
+				release()
 				os.Exit(0)
 			default:
 				fmt.Printf("\tInvalid choice, try again\n")
@@ -120,12 +180,20 @@ func main() {
 	}
 }
 
-func initShiftRegister() (sdiPin, rclkPin, srclkPin, srclrPin, oePin rpio.Pin) {
-	sdiPin = rpio.Pin(17) // Associate GPIO pins with the go-rpio implemetation
-	rclkPin = rpio.Pin(18)
-	srclkPin = rpio.Pin(27)
-	srclrPin = rpio.Pin(19)
-	oePin = rpio.Pin(21)
+func initShiftRegister(board gpio.Board, claims *gpio.Registry) (sdiPin, rclkPin, srclkPin, srclrPin, oePin gpio.Pin, err error) {
+	// Associate GPIO pins with the board's implemetation, claiming them first
+	bcmPins := []int{17, 18, 27, 19, 21}
+	names := []string{"SER", "RCLK", "SRCLK", "SRCLR", "OE"}
+	gpins := make([]gpio.Pin, len(bcmPins))
+	for i, bcm := range bcmPins {
+		if err = claims.Claim(bcm, gpio.FuncGPIO, "74HC595 "+names[i]); err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
+		if gpins[i], err = board.Pin(bcm); err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
+	}
+	sdiPin, rclkPin, srclkPin, srclrPin, oePin = gpins[0], gpins[1], gpins[2], gpins[3], gpins[4]
 
 	sdiPin.Output() // Pins are set to OUTPUT so they can be written to
 	rclkPin.Output()
@@ -139,19 +207,19 @@ func initShiftRegister() (sdiPin, rclkPin, srclkPin, srclrPin, oePin rpio.Pin) {
 	srclrPin.High() // SRCLR must be set to HIGH before the sdiPin can be written to
 	oePin.Low()     // OE must be set to low to enable the output register
 
-	return sdiPin, rclkPin, srclkPin, srclrPin, oePin
+	return sdiPin, rclkPin, srclkPin, srclrPin, oePin, nil
 }
 
 // testWriteNums displays hexidecimal digits 0-F in turn followed by a decimal point. The
 // test ends with the registers and display being cleared.
-func testWriteNums(sdiPin, rclkPin, srclkPin, srclrPin rpio.Pin) {
+func testWriteNums(sdiPin, rclkPin, srclkPin, srclrPin gpio.Pin) {
 	writeNums(sdiPin, rclkPin, srclkPin)
 	shiftRegClr(rclkPin, srclrPin)
 }
 
 // testShiftRegClr first writes an '8' to the 7-segment display and then clears the
 // display by clearing the shift register via the SRCLR pin
-func testShiftRegClr(sdiPin, rclkPin, srclkPin, srclrPin rpio.Pin) {
+func testShiftRegClr(sdiPin, rclkPin, srclkPin, srclrPin gpio.Pin) {
 	hc595_shift(segcode[8], sdiPin, rclkPin, srclkPin)
 	time.Sleep(time.Millisecond * 500) // Sleep a while so the effect can be observed
 	shiftRegClr(rclkPin, srclrPin)
@@ -160,7 +228,7 @@ func testShiftRegClr(sdiPin, rclkPin, srclkPin, srclrPin rpio.Pin) {
 // testZeroClr writes zeros into the shift register to demonstrate writing zeros to the
 // shift register as an alternative to SRCLR. It first writes an '8' to the display so
 // the effect is visible.
-func testZeroClr(sdiPin, rclkPin, srclkPin rpio.Pin) {
+func testZeroClr(sdiPin, rclkPin, srclkPin gpio.Pin) {
 	hc595_shift(segcode[8], sdiPin, rclkPin, srclkPin)
 	time.Sleep(time.Millisecond * 500) // Sleep a while so the effect can be observed
 	// populate the shift register 1 bit at a time with zeros
@@ -168,7 +236,7 @@ func testZeroClr(sdiPin, rclkPin, srclkPin rpio.Pin) {
 }
 
 // testWriteOnes displays '8.' before clearing the display
-func testWriteOnes(sdiPin, rclkPin, srclkPin, srclrPin rpio.Pin) {
+func testWriteOnes(sdiPin, rclkPin, srclkPin, srclrPin gpio.Pin) {
 	// populate the shift register 1 bit at a time with ones
 	hc595_shift(0xff, sdiPin, rclkPin, srclkPin)
 	time.Sleep(time.Second)
@@ -179,7 +247,7 @@ func testWriteOnes(sdiPin, rclkPin, srclkPin, srclrPin rpio.Pin) {
 // First it writes an '8' to the display, toggles the OE pin to HIGH, pauses, then
 // toggles the OE pin back to low to demonstrate that the contents of the output register
 // were only blocked, not cleared.
-func testOEToggle(sdiPin, rclkPin, srclkPin, srclrPin, oePin rpio.Pin) {
+func testOEToggle(sdiPin, rclkPin, srclkPin, srclrPin, oePin gpio.Pin) {
 	hc595_shift(segcode[8], sdiPin, rclkPin, srclkPin)
 	time.Sleep(time.Millisecond * 500)
 	oePin.High()
@@ -195,26 +263,30 @@ func testOEToggle(sdiPin, rclkPin, srclkPin, srclrPin, oePin rpio.Pin) {
 // clock (SRCLK) by toggling it from LOW to HIGH to LOW again. The
 // contents of the shift register are finally made available to connected
 // devices by toggling the output register clock (RCLK).
-func hc595_shift(dat int, sdiPin, rclkPin, srclkPin rpio.Pin) {
+func hc595_shift(dat int, sdiPin, rclkPin, srclkPin gpio.Pin) {
 	// Populate the input shift registers 1 bit at a time
 	for i := 0; i < 8; i++ {
 		// Populate shift register, bit 'i' (0 thru 7)
-		sdiPin.Write(rpio.State(0x80 & (dat << i)))
+		if 0x80&(dat<<i) != 0 {
+			sdiPin.High()
+		} else {
+			sdiPin.Low()
+		}
 		// Advance shift register clock
-		srclkPin.Write(1)
+		srclkPin.High()
 		time.Sleep(time.Microsecond)
-		srclkPin.Write(0)
+		srclkPin.Low()
 	}
 	// Advance storage/output register clock to transfer input shift register
 	// contents to the output register
-	rclkPin.Write(1)
+	rclkPin.High()
 	time.Sleep(time.Microsecond)
-	rclkPin.Write(0)
+	rclkPin.Low()
 }
 
 // writeNums writes hexidecimal digits 0-F and a decimal point to a 7-segment display
 // by way of the shift register.
-func writeNums(sdiPin, rclkPin, srclkPin rpio.Pin) {
+func writeNums(sdiPin, rclkPin, srclkPin gpio.Pin) {
 	for i := 0; i < 17; i++ {
 		hc595_shift(segcode[i], sdiPin, rclkPin, srclkPin)
 		time.Sleep(time.Millisecond * 500)
@@ -223,7 +295,7 @@ func writeNums(sdiPin, rclkPin, srclkPin rpio.Pin) {
 
 // shiftRegClr clears the contents of the shift register with the side effect of clearing
 // the attached 7-segment display
-func shiftRegClr(rclkPin, srclrPin rpio.Pin) {
+func shiftRegClr(rclkPin, srclrPin gpio.Pin) {
 	srclrPin.Low()
 	rclkPin.High()
 	time.Sleep(time.Microsecond)
@@ -233,15 +305,15 @@ func shiftRegClr(rclkPin, srclrPin rpio.Pin) {
 
 // Handles 'ctl-C' entered at the terminal by exiting the program after directing the main
 // goroutine (listening on the 'stop' channel) to exit.
-func signalHandler(sigs chan os.Signal, stop chan interface{}, rclkPin, srclrPin rpio.Pin) {
+func signalHandler(sigs chan os.Signal, stop chan interface{}, rclkPin, srclrPin gpio.Pin, release func()) {
 	<-sigs
 	// notify all listeners that the program is stopping
 	close(stop)
 
 	fmt.Printf("\n!!!INTERRUPTED!!! Clear display, then exit\n")
 	shiftRegClr(rclkPin, srclrPin)
-	// Release rpio library resources
-	rpio.Close()
+	// Release rpio library, or GPIO character device, resources
+	release()
 
 	os.Exit(0)
 
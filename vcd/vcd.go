@@ -0,0 +1,170 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+// Package vcd writes Value Change Dump (VCD) files, as described in IEEE 1364, which
+// can be viewed with GTKWave or PulseView. Value changes are collected in any order
+// and written sorted by time with a 1ns timescale. Every variable's value is unknown
+// until it's first changed. White space can't be used in a name, it's replaced with
+// '_'.
+package vcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Writer collects a VCD file's variables and their value changes
+type Writer struct {
+	vars     map[string]*variable
+	changes  []change
+	comments []string
+	end      time.Duration
+}
+
+// variable is a 'width' bit wire, or a real if 'width' is 0
+type variable struct {
+	name  string
+	width int
+	id    string
+}
+
+type change struct {
+	t     time.Duration
+	v     *variable
+	value string // the value as written, including a trailing space for a vector or a real
+}
+
+// New returns an empty VCD file
+func New() *Writer {
+	return &Writer{vars: map[string]*variable{}}
+}
+
+// Wire changes 1 bit wire 'name' to 'value', '0', '1', 'x' (unknown), or 'z' (high
+// impedance), at time 't'
+func (w *Writer) Wire(t time.Duration, name string, value byte) {
+	w.change(t, name, 1, string(value))
+}
+
+// Vector changes 'width' bit wire 'name' to 'value' at time 't'
+func (w *Writer) Vector(t time.Duration, name string, width int, value uint64) {
+	w.change(t, name, width, fmt.Sprintf("b%0*b ", width, value))
+}
+
+// Real changes real variable 'name' to 'value' at time 't'
+func (w *Writer) Real(t time.Duration, name string, value float64) {
+	w.change(t, name, 0, "r"+strconv.FormatFloat(value, 'g', -1, 64)+" ")
+}
+
+// End sets the time the file ends, so that viewers show the variables' last values
+// until then
+func (w *Writer) End(t time.Duration) {
+	w.end = t
+}
+
+// Comment adds a comment to the file's header
+func (w *Writer) Comment(comment string) {
+	w.comments = append(w.comments, comment)
+}
+
+// change changes variable 'name' to 'value' at time 't', declaring the variable
+// if it's new
+func (w *Writer) change(t time.Duration, name string, width int, value string) {
+	name = identName(name)
+	v := w.vars[name]
+	if v == nil {
+		v = &variable{name: name, width: width, id: identifier(len(w.vars))}
+		w.vars[name] = v
+	}
+	w.changes = append(w.changes, change{t, v, value})
+}
+
+// identName returns 'name' with the characters that would end it in a VCD file,
+// white space and control characters, replaced with '_'
+func identName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// identifier returns the n'th identifier code, made of the printable ASCII
+// characters '!' thru '~'
+func identifier(n int) string {
+	id := ""
+	for {
+		id += string(rune('!' + n%94))
+		n /= 94
+		if n == 0 {
+			return id
+		}
+		n--
+	}
+}
+
+// Write writes the file to 'out'. 'module' is the scope the variables are declared
+// in, they're declared in name order.
+func (w *Writer) Write(out io.Writer, module string) error {
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, "$date %s $end\n", time.Now().Format(time.RFC1123))
+	fmt.Fprintf(bw, "$version github.com/youngkin/gpio $end\n")
+	for _, c := range w.comments {
+		fmt.Fprintf(bw, "$comment %s $end\n", c)
+	}
+	fmt.Fprintf(bw, "$timescale 1ns $end\n")
+	fmt.Fprintf(bw, "$scope module %s $end\n", identName(module))
+
+	var vars []*variable
+	for _, v := range w.vars {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].name < vars[j].name })
+	for _, v := range vars {
+		if v.width == 0 {
+			fmt.Fprintf(bw, "$var real 64 %s %s $end\n", v.id, v.name)
+		} else {
+			fmt.Fprintf(bw, "$var wire %d %s %s $end\n", v.width, v.id, v.name)
+		}
+	}
+	fmt.Fprintf(bw, "$upscope $end\n$enddefinitions $end\n")
+
+	fmt.Fprintf(bw, "#0\n$dumpvars\n")
+	for _, v := range vars {
+		switch v.width {
+		case 0:
+			fmt.Fprintf(bw, "r0 %s\n", v.id)
+		case 1:
+			fmt.Fprintf(bw, "x%s\n", v.id)
+		default:
+			fmt.Fprintf(bw, "bx %s\n", v.id)
+		}
+	}
+	fmt.Fprintf(bw, "$end\n")
+
+	sort.SliceStable(w.changes, func(i, j int) bool { return w.changes[i].t < w.changes[j].t })
+	last := time.Duration(0)
+	for _, c := range w.changes {
+		if c.t != last {
+			fmt.Fprintf(bw, "#%d\n", c.t.Nanoseconds())
+			last = c.t
+		}
+		fmt.Fprintf(bw, "%s%s\n", c.value, c.v.id)
+	}
+	if w.end > last {
+		fmt.Fprintf(bw, "#%d\n", w.end.Nanoseconds())
+	}
+	return bw.Flush()
+}
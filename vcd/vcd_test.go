@@ -0,0 +1,154 @@
+//
+// Copyright (c) 2021 Richard Youngkin. All rights reserved.
+// Use of this source code is governed by the GPL 3.0
+// license that can be found in the LICENSE file.
+//
+
+package vcd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// write returns the file written by 'w', without its date
+func write(t *testing.T, w *Writer, module string) string {
+	var buf bytes.Buffer
+	if err := w.Write(&buf, module); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "$date ") {
+		t.Fatalf("the file doesn't start with its date:\n%s", out)
+	}
+	return out[strings.Index(out, "\n")+1:]
+}
+
+func TestWrite(t *testing.T) {
+	w := New()
+	w.Comment("captured by a test")
+	w.Wire(10, "clk", '1')
+	w.Vector(5, "data", 4, 0xa)
+	w.Real(10, "duty", 0.25)
+	w.Wire(20, "clk", '0')
+	w.Wire(0, "en", 'z')
+	w.Vector(20, "data", 4, 1)
+	w.End(30)
+
+	want := `$version github.com/youngkin/gpio $end
+$comment captured by a test $end
+$timescale 1ns $end
+$scope module top $end
+$var wire 1 ! clk $end
+$var wire 4 " data $end
+$var real 64 # duty $end
+$var wire 1 $ en $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+x!
+bx "
+r0 #
+x$
+$end
+z$
+#5
+b1010 "
+#10
+1!
+r0.25 #
+#20
+0!
+b0001 "
+#30
+`
+	if got := write(t, w, "top"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteEnd(t *testing.T) {
+	// An end before the last change is ignored
+	w := New()
+	w.Wire(20*time.Nanosecond, "a", '1')
+	w.End(10)
+	if got := write(t, w, "top"); !strings.HasSuffix(got, "#20\n1!\n") {
+		t.Errorf("got:\n%s\nwant it to end at the last change", got)
+	}
+
+	// So is one for an empty file
+	w = New()
+	if got := write(t, w, "top"); !strings.HasSuffix(got, "$dumpvars\n$end\n") {
+		t.Errorf("got:\n%s\nwant no changes", got)
+	}
+}
+
+func TestNames(t *testing.T) {
+	w := New()
+	w.Wire(0, "bar graph\tsegment 1", '1')
+	w.Wire(1, "bar graph segment\n1", '0')
+	w.Wire(2, "", '1')
+	w.Wire(3, "gpio17", '0')
+
+	got := write(t, w, "demo board")
+	for _, want := range []string{
+		"$scope module demo_board $end\n",
+		"$var wire 1 ! bar_graph_segment_1 $end\n",
+		"$var wire 1 \" _ $end\n",
+		"$var wire 1 # gpio17 $end\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant it to contain %q", got, want)
+		}
+	}
+	// The names that are the same once they're changed are the same variable
+	if len(w.vars) != 3 {
+		t.Errorf("got %d variables, want 3", len(w.vars))
+	}
+	// Every declaration has a type, size, identifier, and name
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, "$var ") && len(strings.Fields(line)) != 6 {
+			t.Errorf("invalid declaration %q", line)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "!"},
+		{1, "\""},
+		{93, "~"},
+		{94, "!!"},
+		{95, "\"!"},
+		{187, "~!"},
+		{188, "!\""},
+		{94 + 94*94 - 1, "~~"},
+		{94 + 94*94, "!!!"},
+	}
+	for _, tc := range tests {
+		if got := identifier(tc.n); got != tc.want {
+			t.Errorf("identifier(%d): got %q, want %q", tc.n, got, tc.want)
+		}
+	}
+
+	// The identifiers are unique and printable
+	seen := map[string]int{}
+	for n := 0; n < 94+94*94+94; n++ {
+		id := identifier(n)
+		if prev, ok := seen[id]; ok {
+			t.Fatalf("identifier(%d) and identifier(%d) are both %q", prev, n, id)
+		}
+		seen[id] = n
+		for _, c := range id {
+			if c < '!' || c > '~' {
+				t.Fatalf("identifier(%d), %q, has character %q", n, id, c)
+			}
+		}
+	}
+}